@@ -0,0 +1,62 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ClusterPodPresetSpec defines the desired state of ClusterPodPreset
+type ClusterPodPresetSpec struct {
+	PodPresetSpec `json:",inline"`
+
+	// NamespaceSelector selects the namespaces whose pods are subject to the
+	// ClusterPodPreset. An empty selector matches every namespace.
+	// +kubebuilder:validation:Optional
+	NamespaceSelector metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:path=clusterpodpresets,scope=Cluster
+// +kubebuilder:printcolumn:name="Priority",type=integer,JSONPath=`.spec.priority`
+// +kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+// +kubebuilder:printcolumn:name="Matching",type=integer,JSONPath=`.status.matchingPods`
+// +kubebuilder:printcolumn:name="Stale",type=integer,JSONPath=`.status.stalePods`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// ClusterPodPreset is the Schema for the clusterpodpresets API
+type ClusterPodPreset struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ClusterPodPresetSpec `json:"spec,omitempty"`
+	Status PodPresetStatus      `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// ClusterPodPresetList contains a list of ClusterPodPreset
+type ClusterPodPresetList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ClusterPodPreset `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ClusterPodPreset{}, &ClusterPodPresetList{})
+}
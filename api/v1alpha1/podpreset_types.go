@@ -21,11 +21,69 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+// ConflictPolicy describes how a PodPreset is applied when the data it injects
+// conflicts with data already present on the pod.
+// +kubebuilder:validation:Enum=Ignore;Reject;Override;SkipPreset
+type ConflictPolicy string
+
+const (
+	// ConflictPolicyIgnore keeps the value already present on the pod and
+	// applies the remaining, non conflicting data of the PodPreset.
+	ConflictPolicyIgnore ConflictPolicy = "Ignore"
+
+	// ConflictPolicyReject rejects the admission of the pod.
+	ConflictPolicyReject ConflictPolicy = "Reject"
+
+	// ConflictPolicyOverride replaces the value present on the pod with the
+	// value from the PodPreset.
+	ConflictPolicyOverride ConflictPolicy = "Override"
+
+	// ConflictPolicySkipPreset does not apply the conflicting PodPreset at all.
+	ConflictPolicySkipPreset ConflictPolicy = "SkipPreset"
+)
+
+// InitContainersOrder describes where the init containers of a PodPreset are
+// placed relative to the init containers of the pod.
+// +kubebuilder:validation:Enum=Before;After
+type InitContainersOrder string
+
+const (
+	// InitContainersOrderBefore runs the init containers of the PodPreset
+	// before the init containers of the pod.
+	InitContainersOrderBefore InitContainersOrder = "Before"
+
+	// InitContainersOrderAfter runs the init containers of the PodPreset after
+	// the init containers of the pod.
+	InitContainersOrderAfter InitContainersOrder = "After"
+)
+
+// RolloutPolicyType describes whether workloads are restarted when the
+// PodPreset changes.
+// +kubebuilder:validation:Enum=Never;Restart
+type RolloutPolicyType string
+
+const (
+	// RolloutPolicyNever leaves existing pods untouched. Changes are picked up
+	// by pods created afterwards.
+	RolloutPolicyNever RolloutPolicyType = "Never"
+
+	// RolloutPolicyRestart triggers a rolling restart of the Deployments,
+	// StatefulSets and DaemonSets owning pods injected with a previous version
+	// of the PodPreset.
+	RolloutPolicyRestart RolloutPolicyType = "Restart"
+)
+
 // PodPresetSpec defines the desired state of PodPreset
 type PodPresetSpec struct {
 	// +kubebuilder:validation:Required
 	Selector metav1.LabelSelector `json:"selector,omitempty" protobuf:"bytes,1,opt,name=selector"`
 
+	// AnnotationSelector is a query over the annotations of the pod. When set,
+	// the PodPreset only applies to the pods whose annotations also match it,
+	// so that pods have to request the PodPreset explicitly.
+	// +kubebuilder:validation:Optional
+	AnnotationSelector *metav1.LabelSelector `json:"annotationSelector,omitempty"`
+
 	// +patchMergeKey=name
 	// +patchStrategy=merge
 	// +kubebuilder:validation:Optional
@@ -45,6 +103,261 @@ type PodPresetSpec struct {
 	// +patchStrategy=merge
 	// +kubebuilder:validation:Optional
 	VolumeMounts []corev1.VolumeMount `json:"volumeMounts,omitempty" protobuf:"bytes,5,rep,name=volumeMounts"`
+
+	// Labels are added to the labels of the pod.
+	// +kubebuilder:validation:Optional
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// Annotations are added to the annotations of the pod.
+	// +kubebuilder:validation:Optional
+	Annotations map[string]string `json:"annotations,omitempty"`
+
+	// ContainerSelector selects the containers which receive Env, EnvFrom,
+	// VolumeMounts and Resources. Every container and init container is
+	// selected when not set.
+	// +kubebuilder:validation:Optional
+	ContainerSelector *ContainerSelector `json:"containerSelector,omitempty"`
+
+	// ImageSelector selects the containers which receive Env, EnvFrom,
+	// VolumeMounts and Resources by their image. When set, the PodPreset only
+	// applies to the pods with at least one container selected by both the
+	// ContainerSelector and the ImageSelector.
+	// +kubebuilder:validation:Optional
+	ImageSelector *ImageSelector `json:"imageSelector,omitempty"`
+
+	// OwnerSelector is a query over the workload controlling the pod. When
+	// set, the PodPreset only applies to the pods of the selected workloads.
+	// +kubebuilder:validation:Optional
+	OwnerSelector *OwnerSelector `json:"ownerSelector,omitempty"`
+
+	// ServiceAccountSelector is a query over the ServiceAccount the pod runs
+	// as. When set, the PodPreset only applies to the pods running as a
+	// selected ServiceAccount.
+	// +kubebuilder:validation:Optional
+	ServiceAccountSelector *ServiceAccountSelector `json:"serviceAccountSelector,omitempty"`
+
+	// Resources sets default compute resources on containers and bounds the
+	// compute resources of containers.
+	// +kubebuilder:validation:Optional
+	Resources *ResourcesPreset `json:"resources,omitempty"`
+
+	// Tolerations are added to the tolerations of the pod.
+	// +kubebuilder:validation:Optional
+	Tolerations []corev1.Toleration `json:"tolerations,omitempty"`
+
+	// NodeSelector is merged into the node selector of the pod.
+	// +kubebuilder:validation:Optional
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+
+	// Affinity sets the node affinity, pod affinity and pod anti-affinity of
+	// the pod.
+	// +kubebuilder:validation:Optional
+	Affinity *corev1.Affinity `json:"affinity,omitempty"`
+
+	// TopologySpreadConstraints are added to the topology spread constraints
+	// of the pod.
+	// +kubebuilder:validation:Optional
+	TopologySpreadConstraints []corev1.TopologySpreadConstraint `json:"topologySpreadConstraints,omitempty"`
+
+	// Containers are added to the containers of the pod. Containers are
+	// identified by their name.
+	// +patchMergeKey=name
+	// +patchStrategy=merge
+	// +kubebuilder:validation:Optional
+	Containers []corev1.Container `json:"containers,omitempty"`
+
+	// InitContainers are added to the init containers of the pod. Init
+	// containers are identified by their name.
+	// +patchMergeKey=name
+	// +patchStrategy=merge
+	// +kubebuilder:validation:Optional
+	InitContainers []corev1.Container `json:"initContainers,omitempty"`
+
+	// InitContainersOrder determines whether InitContainers run before or after
+	// the init containers of the pod. Defaults to After.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default=After
+	InitContainersOrder InitContainersOrder `json:"initContainersOrder,omitempty"`
+
+	// Priority orders the PodPresets applied to a pod. PodPresets are applied
+	// in ascending priority, so that a PodPreset with a higher priority and
+	// the Override conflict policy replaces the values injected by PodPresets
+	// of lower priority. PodPresets of equal priority are applied
+	// ClusterPodPresets first, then by name. Defaults to 0.
+	// +kubebuilder:validation:Optional
+	Priority int32 `json:"priority,omitempty"`
+
+	// ConflictPolicy determines what happens when the PodPreset conflicts with
+	// data already present on the pod. Defaults to Ignore.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default=Ignore
+	ConflictPolicy ConflictPolicy `json:"conflictPolicy,omitempty"`
+
+	// RolloutPolicy determines whether workloads are restarted to pick up
+	// changes of the PodPreset. Workloads are never restarted when not set.
+	// +kubebuilder:validation:Optional
+	RolloutPolicy *RolloutPolicy `json:"rolloutPolicy,omitempty"`
+}
+
+// RolloutPolicy describes how workloads are restarted when the PodPreset
+// changes.
+type RolloutPolicy struct {
+	// Type determines whether workloads are restarted. Defaults to Never.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default=Never
+	Type RolloutPolicyType `json:"type,omitempty"`
+
+	// MinInterval is the minimum time between two workload restarts triggered
+	// by the PodPreset. Defaults to 1m.
+	// +kubebuilder:validation:Optional
+	MinInterval *metav1.Duration `json:"minInterval,omitempty"`
+
+	// MaintenanceWindow restricts workload restarts to a daily time window.
+	// Workloads can be restarted at any time when not set.
+	// +kubebuilder:validation:Optional
+	MaintenanceWindow *MaintenanceWindow `json:"maintenanceWindow,omitempty"`
+}
+
+// MaintenanceWindowLayout is the time layout of the start of a
+// MaintenanceWindow.
+const MaintenanceWindowLayout = "15:04"
+
+// MaintenanceWindow describes a daily time window.
+type MaintenanceWindow struct {
+	// Start is the time of day the window opens, formatted as HH:MM in UTC.
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Pattern=`^([01][0-9]|2[0-3]):[0-5][0-9]$`
+	Start string `json:"start"`
+
+	// Duration is how long the window stays open.
+	// +kubebuilder:validation:Required
+	Duration metav1.Duration `json:"duration"`
+}
+
+// ContainerSelector selects containers of a pod by name.
+type ContainerSelector struct {
+	// Include lists the names of the selected containers. Names may be glob
+	// patterns such as "app-*". Every container is selected when empty.
+	// +kubebuilder:validation:Optional
+	Include []string `json:"include,omitempty"`
+
+	// Exclude lists the names of containers which are not selected, even when
+	// they are included. Names may be glob patterns.
+	// +kubebuilder:validation:Optional
+	Exclude []string `json:"exclude,omitempty"`
+
+	// InitContainers determines whether init containers can be selected.
+	// Defaults to true.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default=true
+	InitContainers *bool `json:"initContainers,omitempty"`
+
+	// EphemeralContainers determines whether ephemeral containers can be
+	// selected. Defaults to false.
+	// +kubebuilder:validation:Optional
+	EphemeralContainers bool `json:"ephemeralContainers,omitempty"`
+}
+
+// ImageSelector selects containers by their image, as written in the pod
+// spec. A container is selected when its image matches one of the patterns or
+// regular expressions.
+type ImageSelector struct {
+	// Patterns lists glob patterns matched against the image of containers,
+	// such as "registry.corp/java-*". A "*" does not match a "/".
+	// +kubebuilder:validation:Optional
+	Patterns []string `json:"patterns,omitempty"`
+
+	// Regexps lists regular expressions matched against the whole image of
+	// containers, such as "registry.corp/.+/java-.*".
+	// +kubebuilder:validation:Optional
+	Regexps []string `json:"regexps,omitempty"`
+}
+
+// OwnerSelector selects pods by the workload controlling them, according to
+// the controller owner reference of the pod.
+type OwnerSelector struct {
+	// Include lists the workloads whose pods are selected. Every pod is
+	// selected when empty.
+	// +kubebuilder:validation:Optional
+	Include []WorkloadSelector `json:"include,omitempty"`
+
+	// Exclude lists the workloads whose pods are not selected, even when they
+	// are included.
+	// +kubebuilder:validation:Optional
+	Exclude []WorkloadSelector `json:"exclude,omitempty"`
+}
+
+// WorkloadSelector selects workloads by kind and name.
+type WorkloadSelector struct {
+	// Kind is the kind of the workload, such as Deployment, StatefulSet,
+	// DaemonSet, Job or ReplicaSet. The pods of a ReplicaSet created by a
+	// Deployment belong to the Deployment. Pod selects the pods without
+	// controller.
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+	Kind string `json:"kind"`
+
+	// Name is the name of the workload and may be a glob pattern such as
+	// "batch-*". Every workload of the kind is selected when empty.
+	// +kubebuilder:validation:Optional
+	Name string `json:"name,omitempty"`
+}
+
+// ServiceAccountSelector selects pods by the ServiceAccount they run as. A
+// ServiceAccount is selected when it matches both the names and the selector.
+type ServiceAccountSelector struct {
+	// Names lists the names of the selected ServiceAccounts. Names may be glob
+	// patterns such as "app-*". Every name is selected when empty.
+	// +kubebuilder:validation:Optional
+	Names []string `json:"names,omitempty"`
+
+	// Selector is a query over the labels of the ServiceAccounts. Every
+	// ServiceAccount is selected when not set.
+	// +kubebuilder:validation:Optional
+	Selector *metav1.LabelSelector `json:"selector,omitempty"`
+}
+
+// ResourcesPreset describes the compute resources injected into containers.
+type ResourcesPreset struct {
+	// Requests are the default resource requests of containers which do not
+	// request the resource themselves.
+	// +kubebuilder:validation:Optional
+	Requests corev1.ResourceList `json:"requests,omitempty"`
+
+	// Limits are the default resource limits of containers which do not limit
+	// the resource themselves.
+	// +kubebuilder:validation:Optional
+	Limits corev1.ResourceList `json:"limits,omitempty"`
+
+	// Min is the lower bound the resource requests and limits of containers are
+	// raised to, including the values set by the containers. Raising a value is
+	// not a conflict.
+	// +kubebuilder:validation:Optional
+	Min corev1.ResourceList `json:"min,omitempty"`
+
+	// Max is the upper bound the resource requests and limits of containers are
+	// lowered to, including the values set by the containers. Lowering a value
+	// is not a conflict.
+	// +kubebuilder:validation:Optional
+	Max corev1.ResourceList `json:"max,omitempty"`
+}
+
+// GetRolloutPolicyType returns the type of the RolloutPolicy of the PodPreset,
+// falling back to Never when none has been set.
+func (in *PodPresetSpec) GetRolloutPolicyType() RolloutPolicyType {
+	if in.RolloutPolicy == nil || in.RolloutPolicy.Type == "" {
+		return RolloutPolicyNever
+	}
+	return in.RolloutPolicy.Type
+}
+
+// GetConflictPolicy returns the ConflictPolicy of the PodPreset, falling back
+// to Ignore when none has been set.
+func (in *PodPresetSpec) GetConflictPolicy() ConflictPolicy {
+	if in.ConflictPolicy == "" {
+		return ConflictPolicyIgnore
+	}
+	return in.ConflictPolicy
 }
 
 // PodPresetStatus defines the observed state of PodPreset
@@ -56,11 +369,56 @@ type PodPresetStatus struct {
 	// +kubebuilder:validation:Optional
 	// +operator-sdk:csv:customresourcedefinitions:type=status,displayName="Conditions",xDescriptors={"urn:alm:descriptor:io.kubernetes.conditions"}
 	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
+
+	// ObservedGeneration is the most recent generation observed by the
+	// controller.
+	// +kubebuilder:validation:Optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// SpecResourceVersion is the resourceVersion of the PodPreset when its
+	// current generation was observed. Pods are annotated with it when the
+	// PodPreset is injected, pods annotated with another resourceVersion were
+	// injected with a previous version of the PodPreset.
+	// +kubebuilder:validation:Optional
+	SpecResourceVersion string `json:"specResourceVersion,omitempty"`
+
+	// MatchingPods is the number of pods currently selected by the PodPreset.
+	// +kubebuilder:validation:Optional
+	MatchingPods int32 `json:"matchingPods"`
+
+	// StalePods is the number of pods injected with a previous version of the
+	// PodPreset.
+	// +kubebuilder:validation:Optional
+	StalePods int32 `json:"stalePods"`
+
+	// LastRolloutTime is the last time a workload was restarted to pick up
+	// changes of the PodPreset.
+	// +kubebuilder:validation:Optional
+	LastRolloutTime *metav1.Time `json:"lastRolloutTime,omitempty"`
 }
 
+// Condition types of PodPresets and ClusterPodPresets.
+const (
+	// PodPresetConditionReady indicates the PodPreset is valid and does not
+	// conflict.
+	PodPresetConditionReady = "Ready"
+
+	// PodPresetConditionValid indicates the spec of the PodPreset is valid.
+	PodPresetConditionValid = "Valid"
+
+	// PodPresetConditionConflicting indicates the PodPreset conflicts with
+	// other PodPresets or with the pods it selects.
+	PodPresetConditionConflicting = "Conflicting"
+)
+
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
 // +kubebuilder:resource:path=podpresets,scope=Namespaced
+// +kubebuilder:printcolumn:name="Priority",type=integer,JSONPath=`.spec.priority`
+// +kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+// +kubebuilder:printcolumn:name="Matching",type=integer,JSONPath=`.status.matchingPods`
+// +kubebuilder:printcolumn:name="Stale",type=integer,JSONPath=`.status.stalePods`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // PodPreset is the Schema for the podpresets API
 type PodPreset struct {
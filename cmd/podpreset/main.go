@@ -0,0 +1,167 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Command podpreset injects PodPresets and ClusterPodPresets into manifests
+// without a cluster, using the same logic as the admission webhook.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/redhat-cop/podpreset-webhook/pkg/podpreset"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const usage = `Usage: podpreset apply --presets FILE [--namespace NAMESPACE] [--namespace-injection MODE] [--diff] [FILE...]
+
+Injects the PodPresets and ClusterPodPresets of the presets files into the
+Pods, Deployments, StatefulSets, DaemonSets, ReplicaSets, Jobs and CronJobs of
+the manifest files and prints the mutated manifests, or a unified diff with
+--diff. Manifests are read from stdin when no file, or "-", is given.
+Namespaces defined in the presets or manifest files are used to evaluate the
+namespaceSelector of ClusterPodPresets and the podpreset.admission.kubernetes.io/injection
+label selecting the namespaces subject to PodPresets. ServiceAccounts defined
+in the presets or manifest files are used to evaluate the serviceAccountSelector
+of PodPresets.
+
+Flags:
+`
+
+// stringSliceFlag is a flag which can be set multiple times.
+type stringSliceFlag []string
+
+func (s *stringSliceFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringSliceFlag) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+func main() {
+	if err := run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	flags := flag.NewFlagSet("apply", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		flags.PrintDefaults()
+	}
+
+	var presetFiles stringSliceFlag
+	flags.Var(&presetFiles, "presets", "File containing PodPresets, ClusterPodPresets and Namespaces, \"-\" for stdin. Can be repeated.")
+	namespace := flags.String("namespace", "default", "Namespace of the manifests which do not set one.")
+	namespaceInjection := flags.String("namespace-injection", string(podpreset.NamespaceInjectionOptOut), "Namespaces subject to PodPresets, opt-out or opt-in, as configured on the webhook.")
+	diff := flags.Bool("diff", false, "Print a unified diff instead of the mutated manifests.")
+
+	if len(args) == 0 || args[0] != "apply" {
+		flags.Usage()
+		return fmt.Errorf("expected the apply command")
+	}
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+	if len(presetFiles) == 0 {
+		flags.Usage()
+		return fmt.Errorf("at least one presets file is required")
+	}
+
+	manifestFiles := flags.Args()
+	if len(manifestFiles) == 0 {
+		manifestFiles = []string{"-"}
+	}
+	if containsStdin(presetFiles) && containsStdin(manifestFiles) {
+		return fmt.Errorf("presets and manifests cannot both be read from stdin")
+	}
+
+	namespaceInjectionMode, err := podpreset.ParseNamespaceInjectionMode(*namespaceInjection)
+	if err != nil {
+		return err
+	}
+
+	inj := newInjector(*namespace, podpreset.NamespaceSelection{
+		Mode:               namespaceInjectionMode,
+		ExcludedNamespaces: []string{metav1.NamespaceSystem},
+	})
+	for _, file := range presetFiles {
+		docs, err := readDocuments(file, stdin)
+		if err != nil {
+			return err
+		}
+		for _, doc := range docs {
+			if err := inj.addPreset(doc); err != nil {
+				return fmt.Errorf("%s: %v", file, err)
+			}
+		}
+	}
+
+	var docs []*document
+	for _, file := range manifestFiles {
+		fileDocs, err := readDocuments(file, stdin)
+		if err != nil {
+			return err
+		}
+		docs = append(docs, fileDocs...)
+	}
+	for _, doc := range docs {
+		inj.addContext(doc)
+	}
+
+	for i, doc := range docs {
+		warnings, err := inj.inject(doc)
+		for _, warning := range warnings {
+			fmt.Fprintf(stderr, "Warning: %s: %s\n", doc.description(), warning)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %v", doc.description(), err)
+		}
+
+		if *diff {
+			if err := writeDiff(stdout, doc); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if i > 0 {
+			fmt.Fprintln(stdout, "---")
+		}
+		if err := writeDocument(stdout, doc); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func containsStdin(files []string) bool {
+	for _, file := range files {
+		if file == "-" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,166 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update the golden files of testdata")
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		err  string
+	}{
+		{
+			name: "apply",
+			args: []string{"apply", "--presets", "testdata/presets.yaml", "testdata/deployment.yaml"},
+		},
+		{
+			name: "apply-diff",
+			args: []string{"apply", "--presets", "testdata/presets.yaml", "--diff", "testdata/deployment.yaml"},
+		},
+		{
+			name: "apply-injected",
+			args: []string{"apply", "--presets", "testdata/presets.yaml", "--diff", "testdata/injected.yaml"},
+		},
+		{
+			name: "apply-opt-in",
+			args: []string{"apply", "--presets", "testdata/presets.yaml", "--namespace-injection", "opt-in", "--diff", "testdata/deployment.yaml"},
+		},
+		{
+			name: "apply-rejected",
+			args: []string{"apply", "--presets", "testdata/rejected.yaml", "testdata/deployment.yaml"},
+			err:  "Deployment/shop/web: rejected, PodPreset log-level conflicts with pod",
+		},
+		{
+			name: "no presets",
+			args: []string{"apply", "testdata/deployment.yaml"},
+			err:  "at least one presets file is required",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			err := run(tt.args, strings.NewReader(""), &stdout, &stderr)
+			if tt.err == "" && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+
+			expectGolden(t, tt.name+".stdout", stdout.Bytes())
+			expectGolden(t, tt.name+".stderr", stderr.Bytes())
+		})
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	lines := func(n int) []string {
+		var l []string
+		for i := 1; i <= n; i++ {
+			l = append(l, "line "+strings.Repeat("x", i))
+		}
+		return l
+	}
+	replace := func(l []string, i int, line string) []string {
+		l = append([]string(nil), l...)
+		l[i] = line
+		return l
+	}
+
+	tests := []struct {
+		name     string
+		from, to []string
+	}{
+		{
+			name: "equal",
+			from: lines(5),
+			to:   lines(5),
+		},
+		{
+			name: "changed line",
+			from: lines(10),
+			to:   replace(lines(10), 4, "changed"),
+		},
+		{
+			name: "added lines",
+			from: lines(4),
+			to:   append(lines(4), "added", "added again"),
+		},
+		{
+			name: "removed first line",
+			from: lines(5),
+			to:   lines(5)[1:],
+		},
+		{
+			name: "from empty",
+			to:   lines(2),
+		},
+		{
+			name: "distant changes",
+			from: lines(20),
+			to:   replace(replace(lines(20), 1, "changed"), 17, "changed"),
+		},
+		{
+			name: "close changes",
+			from: lines(20),
+			to:   replace(replace(lines(20), 5, "changed"), 11, "changed"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diff := unifiedDiff("a/file", "b/file", tt.from, tt.to)
+			expectGolden(t, filepath.Join("diff", strings.ReplaceAll(tt.name, " ", "-")+".diff"), []byte(diff))
+		})
+	}
+}
+
+// expectGolden compares actual with the golden file of testdata, which is
+// written instead with -update.
+func expectGolden(t *testing.T, name string, actual []byte) {
+	t.Helper()
+
+	golden := filepath.Join("testdata", name)
+	if *update {
+		if err := ioutil.WriteFile(golden, actual, 0644); err != nil {
+			t.Fatalf("unable to update golden file: %v", err)
+		}
+		return
+	}
+
+	expected, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("unable to read golden file: %v", err)
+	}
+	if !bytes.Equal(actual, expected) {
+		t.Errorf("%s does not match, got:\n%s", golden, actual)
+	}
+}
@@ -0,0 +1,291 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/yaml"
+
+	redhatcopv1alpha1 "github.com/redhat-cop/podpreset-webhook/api/v1alpha1"
+	"github.com/redhat-cop/podpreset-webhook/pkg/podpreset"
+)
+
+var (
+	scheme = runtime.NewScheme()
+	codecs = serializer.NewCodecFactory(scheme)
+)
+
+func init() {
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(redhatcopv1alpha1.AddToScheme(scheme))
+}
+
+// document is a manifest read from a file. Objects of a kind which is not
+// registered in the scheme are kept as raw data.
+type document struct {
+	raw []byte
+
+	// original is the decoded object before injection and object the object
+	// after injection. Both are nil when the kind is not registered.
+	original runtime.Object
+	object   runtime.Object
+}
+
+// readDocuments reads the YAML or JSON documents of a file, or of stdin when
+// the file is "-".
+func readDocuments(file string, stdin io.Reader) ([]*document, error) {
+	r := stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var docs []*document
+	reader := utilyaml.NewYAMLReader(bufio.NewReader(r))
+	for {
+		raw, err := reader.Read()
+		if err == io.EOF {
+			return docs, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", file, err)
+		}
+		if len(bytes.TrimSpace(raw)) == 0 {
+			continue
+		}
+
+		doc := &document{raw: raw}
+		obj, gvk, err := codecs.UniversalDeserializer().Decode(raw, nil, nil)
+		switch {
+		case runtime.IsNotRegisteredError(err):
+		case err != nil:
+			return nil, fmt.Errorf("%s: %v", file, err)
+		default:
+			obj.GetObjectKind().SetGroupVersionKind(*gvk)
+			doc.original = obj
+			doc.object = obj.DeepCopyObject()
+		}
+		docs = append(docs, doc)
+	}
+}
+
+// description identifies the document in messages.
+func (d *document) description() string {
+	if d.object == nil {
+		return "document"
+	}
+
+	kind := d.object.GetObjectKind().GroupVersionKind().Kind
+	accessor, ok := d.object.(metav1.Object)
+	if !ok {
+		return kind
+	}
+	if accessor.GetNamespace() == "" {
+		return fmt.Sprintf("%s/%s", kind, accessor.GetName())
+	}
+	return fmt.Sprintf("%s/%s/%s", kind, accessor.GetNamespace(), accessor.GetName())
+}
+
+// podTemplate returns the metadata and the spec of the pods created from the
+// object, or false when the object does not create pods.
+func podTemplate(obj runtime.Object) (*metav1.ObjectMeta, *corev1.PodSpec, bool) {
+	if pod, ok := obj.(*corev1.Pod); ok {
+		return &pod.ObjectMeta, &pod.Spec, true
+	}
+	if template := podpreset.PodTemplate(obj); template != nil {
+		return &template.ObjectMeta, &template.Spec, true
+	}
+	return nil, nil, false
+}
+
+// injector injects PodPresets and ClusterPodPresets into manifests.
+type injector struct {
+	defaultNamespace   string
+	namespaceSelection podpreset.NamespaceSelection
+
+	podPresets        map[string]*redhatcopv1alpha1.PodPresetList
+	clusterPodPresets redhatcopv1alpha1.ClusterPodPresetList
+	namespaces        map[string]*corev1.Namespace
+	serviceAccounts   map[types.NamespacedName]*corev1.ServiceAccount
+}
+
+func newInjector(defaultNamespace string, namespaceSelection podpreset.NamespaceSelection) *injector {
+	return &injector{
+		defaultNamespace:   defaultNamespace,
+		namespaceSelection: namespaceSelection,
+		podPresets:         map[string]*redhatcopv1alpha1.PodPresetList{},
+		namespaces:         map[string]*corev1.Namespace{},
+		serviceAccounts:    map[types.NamespacedName]*corev1.ServiceAccount{},
+	}
+}
+
+// addPreset registers a PodPreset, ClusterPodPreset, Namespace or
+// ServiceAccount read from a presets file.
+func (i *injector) addPreset(doc *document) error {
+	switch o := doc.original.(type) {
+	case *redhatcopv1alpha1.PodPreset:
+		namespace := o.Namespace
+		if namespace == "" {
+			namespace = i.defaultNamespace
+		}
+		if i.podPresets[namespace] == nil {
+			i.podPresets[namespace] = &redhatcopv1alpha1.PodPresetList{}
+		}
+		i.podPresets[namespace].Items = append(i.podPresets[namespace].Items, *o)
+	case *redhatcopv1alpha1.ClusterPodPreset:
+		i.clusterPodPresets.Items = append(i.clusterPodPresets.Items, *o)
+	case *corev1.Namespace, *corev1.ServiceAccount:
+		i.addContext(doc)
+	default:
+		return fmt.Errorf("unexpected %s in presets, only PodPresets, ClusterPodPresets, Namespaces and ServiceAccounts are supported", doc.description())
+	}
+	return nil
+}
+
+// addContext registers the document when it is a Namespace or a
+// ServiceAccount, which select the PodPresets applied to pods.
+func (i *injector) addContext(doc *document) {
+	switch o := doc.original.(type) {
+	case *corev1.Namespace:
+		i.namespaces[o.Name] = o
+	case *corev1.ServiceAccount:
+		namespace := o.Namespace
+		if namespace == "" {
+			namespace = i.defaultNamespace
+		}
+		i.serviceAccounts[types.NamespacedName{Namespace: namespace, Name: o.Name}] = o
+	}
+}
+
+// inject injects the matching PodPresets into the pods created from the
+// document, like the admission webhook would when the pods are created. It
+// returns the conflicts as warnings, or an error when the pods would be
+// rejected.
+func (i *injector) inject(doc *document) ([]string, error) {
+	meta, spec, ok := podTemplate(doc.object)
+	if !ok {
+		return nil, nil
+	}
+
+	namespace := doc.object.(metav1.Object).GetNamespace()
+	if namespace == "" {
+		namespace = i.defaultNamespace
+	}
+
+	pod := &corev1.Pod{ObjectMeta: *meta.DeepCopy(), Spec: *spec.DeepCopy()}
+	pod.Namespace = namespace
+	if _, isPod := doc.object.(*corev1.Pod); !isPod {
+		pod.OwnerReferences = podpreset.TemplateOwners(doc.object)
+	}
+
+	if _, isMirrorPod := pod.Annotations[corev1.MirrorPodAnnotationKey]; isMirrorPod {
+		return nil, nil
+	}
+	if podpreset.IsOptedOut(pod) {
+		return nil, nil
+	}
+
+	ns, ok := i.namespaces[namespace]
+	if !ok {
+		ns = &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}}
+	}
+	if !i.namespaceSelection.Selects(ns) {
+		return nil, nil
+	}
+
+	serviceAccount := i.serviceAccounts[types.NamespacedName{Namespace: namespace, Name: podpreset.ServiceAccountName(pod)}]
+
+	podPresets := redhatcopv1alpha1.PodPresetList{}
+	if list := i.podPresets[namespace]; list != nil {
+		podPresets = *list
+	}
+
+	// the PodPresets with an invalid selector are skipped and reported in the
+	// warnings
+	injection, _ := podpreset.Inject(pod, ns, serviceAccount, podPresets, i.clusterPodPresets)
+	if rejection := injection.Rejection; rejection != nil {
+		return injection.Warnings, fmt.Errorf("rejected, %s %s conflicts with pod: %s", podpreset.Kind(rejection.PodPreset), rejection.PodPreset.GetName(), rejection.Error())
+	}
+	if len(injection.Candidates) == 0 {
+		return injection.Warnings, nil
+	}
+	pod = injection.Pod
+
+	meta.Labels = pod.Labels
+	meta.Annotations = pod.Annotations
+	*spec = pod.Spec
+
+	return injection.Warnings, nil
+}
+
+// writeDocument writes the document as YAML.
+func writeDocument(w io.Writer, doc *document) error {
+	if doc.object == nil {
+		_, err := w.Write(append(bytes.TrimRight(doc.raw, "\n"), '\n'))
+		return err
+	}
+
+	data, err := yaml.Marshal(doc.object)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// writeDiff writes the changes made to the document as a unified diff.
+func writeDiff(w io.Writer, doc *document) error {
+	if doc.object == nil {
+		return nil
+	}
+
+	original, err := yaml.Marshal(doc.original)
+	if err != nil {
+		return err
+	}
+	mutated, err := yaml.Marshal(doc.object)
+	if err != nil {
+		return err
+	}
+
+	name := strings.ToLower(doc.description())
+	_, err = io.WriteString(w, unifiedDiff("a/"+name, "b/"+name, splitLines(string(original)), splitLines(string(mutated))))
+	return err
+}
+
+// splitLines returns the lines of s, without their line terminator.
+func splitLines(s string) []string {
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
@@ -0,0 +1,197 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	redhatcopv1alpha1 "github.com/redhat-cop/podpreset-webhook/api/v1alpha1"
+	"github.com/redhat-cop/podpreset-webhook/pkg/metrics"
+	"github.com/redhat-cop/podpreset-webhook/pkg/podpreset"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// ClusterPodPresetReconciler reconciles the status of a ClusterPodPreset object
+type ClusterPodPresetReconciler struct {
+	client.Client
+	Log    logr.Logger
+	Scheme *runtime.Scheme
+
+	// NamespaceSelection selects the namespaces whose pods are subject to
+	// PodPresets, like the admission webhook does.
+	NamespaceSelection podpreset.NamespaceSelection
+}
+
+// +kubebuilder:rbac:groups=redhatcop.redhat.io,resources=clusterpodpresets/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=serviceaccounts,verbs=get;list;watch
+
+// Reconcile updates the conditions and pod counts of a ClusterPodPreset. Only
+// the pods of the namespaces the ClusterPodPreset applies to are counted and
+// restarted, which saves listing every pod of the cluster.
+func (r *ClusterPodPresetReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := r.Log.WithValues("clusterpodpreset", req.NamespacedName)
+
+	cpp := &redhatcopv1alpha1.ClusterPodPreset{}
+	if err := r.Get(ctx, req.NamespacedName, cpp); err != nil {
+		if apierrors.IsNotFound(err) {
+			metrics.InvalidSelectorPresets.DeleteLabelValues("", "ClusterPodPreset", req.Name)
+		}
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	clusterPodPresetList := &redhatcopv1alpha1.ClusterPodPresetList{}
+	if err := r.List(ctx, clusterPodPresetList); err != nil {
+		return ctrl.Result{}, err
+	}
+	var others []*redhatcopv1alpha1.PodPreset
+	for i := range clusterPodPresetList.Items {
+		others = append(others, podpreset.FromClusterPodPreset(&clusterPodPresetList.Items[i]))
+	}
+
+	errs := podpreset.ValidateClusterPodPresetSpec(&cpp.Spec, field.NewPath("spec"))
+
+	selector, err := podpreset.NewClusterPodPresetSelector(cpp)
+	setInvalidSelector("", "ClusterPodPreset", req.Name, err != nil)
+
+	// an invalid ClusterPodPreset applies to no namespace
+	namespaceList := &corev1.NamespaceList{}
+	if err := r.List(ctx, namespaceList); err != nil {
+		return ctrl.Result{}, err
+	}
+	namespaces := map[string]*corev1.Namespace{}
+	var pods []corev1.Pod
+	for i := range namespaceList.Items {
+		namespace := &namespaceList.Items[i]
+		if selector == nil || !r.NamespaceSelection.Selects(namespace) || !selector.SelectsNamespace(namespace) {
+			continue
+		}
+		namespaces[namespace.Name] = namespace
+
+		podList := &corev1.PodList{}
+		if err := r.List(ctx, podList, client.InNamespace(namespace.Name)); err != nil {
+			return ctrl.Result{}, err
+		}
+		pods = append(pods, podList.Items...)
+	}
+
+	serviceAccounts, err := listServiceAccounts(ctx, r.Client, &cpp.Spec.PodPresetSpec)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	pp := podpreset.FromClusterPodPreset(cpp)
+	status := podPresetStatus(pp, cpp.Status, errs, podpreset.DescribePresetConflicts(pp, others), pods, func(pod *corev1.Pod) bool {
+		namespace, ok := namespaces[pod.Namespace]
+		return ok && isInjectable(pod) && isSelected(selector, pod, namespace, podServiceAccount(serviceAccounts, pod))
+	})
+
+	requeueAfter, rolloutErr := rolloutStalePods(ctx, r.Client, pp, &status, pods, time.Now())
+
+	if !equality.Semantic.DeepEqual(status, cpp.Status) {
+		cpp.Status = status
+		if err := r.Status().Update(ctx, cpp); err != nil {
+			return ctrl.Result{}, err
+		}
+		log.V(1).Info("updated status", "matchingPods", status.MatchingPods, "stalePods", status.StalePods)
+	}
+
+	// a failed rollout is retried with the backoff of the work queue
+	if rolloutErr != nil {
+		return ctrl.Result{}, fmt.Errorf("unable to restart workloads: %v", rolloutErr)
+	}
+	return ctrl.Result{RequeueAfter: requeueAfter}, nil
+}
+
+// clusterPodPresetsForPod enqueues the ClusterPodPresets whose status may be
+// changed by the pod: the ones injected into the pod or selecting it. The pods
+// of the namespaces which are not subject to PodPresets are selected by none.
+func (r *ClusterPodPresetReconciler) clusterPodPresetsForPod(obj client.Object) []reconcile.Request {
+	pod, ok := obj.(*corev1.Pod)
+	if !ok {
+		return nil
+	}
+
+	clusterPodPresetList := &redhatcopv1alpha1.ClusterPodPresetList{}
+	if err := r.List(context.TODO(), clusterPodPresetList); err != nil {
+		r.Log.Error(err, "unable to list clusterpodpresets")
+		return nil
+	}
+
+	namespace := &corev1.Namespace{}
+	if err := r.Get(context.TODO(), types.NamespacedName{Name: pod.Namespace}, namespace); err != nil {
+		// the ClusterPodPresets injected into the pod are enqueued regardless
+		r.Log.Error(err, "unable to get namespace", "namespace", pod.Namespace)
+		namespace = nil
+	}
+	if namespace != nil && !r.NamespaceSelection.Selects(namespace) {
+		namespace = nil
+	}
+	serviceAccount := getServiceAccount(context.TODO(), r.Client, pod)
+
+	var requests []reconcile.Request
+	for i := range clusterPodPresetList.Items {
+		cpp := &clusterPodPresetList.Items[i]
+		selector, _ := podpreset.NewClusterPodPresetSelector(cpp)
+		if isRecorded(pod, podpreset.FromClusterPodPreset(cpp)) || (namespace != nil && isSelected(selector, pod, namespace, serviceAccount)) {
+			requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Name: cpp.Name}})
+		}
+	}
+	return requests
+}
+
+// clusterPodPresetsForNamespace enqueues every ClusterPodPreset, whose
+// namespaceSelector may select the namespace before or after the change of its
+// labels.
+func (r *ClusterPodPresetReconciler) clusterPodPresetsForNamespace(obj client.Object) []reconcile.Request {
+	clusterPodPresetList := &redhatcopv1alpha1.ClusterPodPresetList{}
+	if err := r.List(context.TODO(), clusterPodPresetList); err != nil {
+		r.Log.Error(err, "unable to list clusterpodpresets")
+		return nil
+	}
+
+	requests := make([]reconcile.Request, len(clusterPodPresetList.Items))
+	for i, cpp := range clusterPodPresetList.Items {
+		requests[i] = reconcile.Request{NamespacedName: types.NamespacedName{Name: cpp.Name}}
+	}
+	return requests
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *ClusterPodPresetReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&redhatcopv1alpha1.ClusterPodPreset{}).
+		Watches(&source.Kind{Type: &corev1.Pod{}}, handler.EnqueueRequestsFromMapFunc(r.clusterPodPresetsForPod)).
+		Watches(&source.Kind{Type: &corev1.Namespace{}}, handler.EnqueueRequestsFromMapFunc(r.clusterPodPresetsForNamespace), builder.WithPredicates(namespaceLabelsChanged)).
+		Complete(r)
+}
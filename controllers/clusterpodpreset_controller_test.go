@@ -0,0 +1,220 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr"
+	redhatcopv1alpha1 "github.com/redhat-cop/podpreset-webhook/api/v1alpha1"
+	"github.com/redhat-cop/podpreset-webhook/pkg/podpreset"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestClusterPodPresetReconcile(t *testing.T) {
+	tests := []struct {
+		name               string
+		namespaceSelection podpreset.NamespaceSelection
+		namespaceSelector  metav1.LabelSelector
+		matchingPods       int32
+		stalePods          int32
+	}{
+		{
+			name:               "opt-out",
+			namespaceSelection: podpreset.NamespaceSelection{ExcludedNamespaces: []string{"kube-system"}},
+			matchingPods:       2,
+			stalePods:          2,
+		},
+		{
+			name:               "opt-in",
+			namespaceSelection: podpreset.NamespaceSelection{Mode: podpreset.NamespaceInjectionOptIn, ExcludedNamespaces: []string{"kube-system"}},
+			matchingPods:       1,
+			stalePods:          1,
+		},
+		{
+			name:               "namespace selector",
+			namespaceSelection: podpreset.NamespaceSelection{ExcludedNamespaces: []string{"kube-system"}},
+			namespaceSelector:  metav1.LabelSelector{MatchLabels: map[string]string{"team": "payments"}},
+			matchingPods:       1,
+			stalePods:          1,
+		},
+		{
+			name:               "invalid namespace selector",
+			namespaceSelection: podpreset.NamespaceSelection{ExcludedNamespaces: []string{"kube-system"}},
+			namespaceSelector: metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+				{Key: "team", Operator: "Unknown"},
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cpp := &redhatcopv1alpha1.ClusterPodPreset{
+				ObjectMeta: metav1.ObjectMeta{Name: "proxy", Generation: 1},
+				Spec: redhatcopv1alpha1.ClusterPodPresetSpec{
+					NamespaceSelector: tt.namespaceSelector,
+					PodPresetSpec: redhatcopv1alpha1.PodPresetSpec{
+						Selector: metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+					},
+				},
+			}
+			objs := []runtime.Object{
+				cpp,
+				testNamespace("default", nil),
+				testNamespace("payments", map[string]string{"team": "payments", podpreset.NamespaceInjectionLabel: podpreset.NamespaceInjectionEnabled}),
+				testNamespace("batch", map[string]string{podpreset.NamespaceInjectionLabel: podpreset.NamespaceInjectionDisabled}),
+				testNamespace("kube-system", map[string]string{"team": "payments", podpreset.NamespaceInjectionLabel: podpreset.NamespaceInjectionEnabled}),
+			}
+			for _, namespace := range []string{"default", "payments", "batch", "kube-system"} {
+				pod := testPod("web", nil)
+				pod.Namespace = namespace
+				objs = append(objs, &pod)
+
+				// the injection of a previous version of the ClusterPodPreset
+				stale := testPod("stale", map[string]string{"podpreset.admission.kubernetes.io/clusterpodpreset-proxy": "1"})
+				stale.Namespace = namespace
+				stale.Labels = nil
+				objs = append(objs, &stale)
+			}
+
+			r := &ClusterPodPresetReconciler{
+				Client:             newTestClient(t, objs...),
+				Log:                logr.Discard(),
+				NamespaceSelection: tt.namespaceSelection,
+			}
+			if _, err := r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: types.NamespacedName{Name: "proxy"}}); err != nil {
+				t.Fatal(err)
+			}
+
+			reconciled := &redhatcopv1alpha1.ClusterPodPreset{}
+			if err := r.Get(context.TODO(), types.NamespacedName{Name: "proxy"}, reconciled); err != nil {
+				t.Fatal(err)
+			}
+			if reconciled.Status.MatchingPods != tt.matchingPods {
+				t.Errorf("expected %d matching pods, got %d", tt.matchingPods, reconciled.Status.MatchingPods)
+			}
+			if reconciled.Status.StalePods != tt.stalePods {
+				t.Errorf("expected %d stale pods, got %d", tt.stalePods, reconciled.Status.StalePods)
+			}
+		})
+	}
+}
+
+func TestClusterPodPresetsForPod(t *testing.T) {
+	objs := []runtime.Object{
+		&redhatcopv1alpha1.ClusterPodPreset{
+			ObjectMeta: metav1.ObjectMeta{Name: "web"},
+			Spec: redhatcopv1alpha1.ClusterPodPresetSpec{PodPresetSpec: redhatcopv1alpha1.PodPresetSpec{
+				Selector: metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+			}},
+		},
+		&redhatcopv1alpha1.ClusterPodPreset{
+			ObjectMeta: metav1.ObjectMeta{Name: "injected"},
+			Spec: redhatcopv1alpha1.ClusterPodPresetSpec{PodPresetSpec: redhatcopv1alpha1.PodPresetSpec{
+				Selector: metav1.LabelSelector{MatchLabels: map[string]string{"app": "worker"}},
+			}},
+		},
+		&redhatcopv1alpha1.ClusterPodPreset{
+			ObjectMeta: metav1.ObjectMeta{Name: "worker"},
+			Spec: redhatcopv1alpha1.ClusterPodPresetSpec{PodPresetSpec: redhatcopv1alpha1.PodPresetSpec{
+				Selector: metav1.LabelSelector{MatchLabels: map[string]string{"app": "worker"}},
+			}},
+		},
+		testNamespace("default", nil),
+		testNamespace("batch", map[string]string{podpreset.NamespaceInjectionLabel: podpreset.NamespaceInjectionDisabled}),
+	}
+
+	tests := []struct {
+		name      string
+		namespace string
+		expected  []string
+	}{
+		{
+			name:      "selected",
+			namespace: "default",
+			expected:  []string{"web", "injected"},
+		},
+		{
+			name:      "namespace opted out",
+			namespace: "batch",
+			expected:  []string{"injected"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &ClusterPodPresetReconciler{
+				Client: newTestClient(t, objs...),
+				Log:    logr.Discard(),
+			}
+
+			pod := testPod("web", map[string]string{"podpreset.admission.kubernetes.io/clusterpodpreset-injected": "1"})
+			pod.Namespace = tt.namespace
+
+			requests := r.clusterPodPresetsForPod(&pod)
+			var names []string
+			for _, request := range requests {
+				names = append(names, request.Name)
+			}
+			if !sameNames(names, tt.expected) {
+				t.Errorf("expected %v to be enqueued, got %v", tt.expected, names)
+			}
+		})
+	}
+}
+
+func newTestClient(t *testing.T, objs ...runtime.Object) client.Client {
+	t.Helper()
+
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := redhatcopv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	return fake.NewClientBuilder().WithScheme(scheme).WithRuntimeObjects(objs...).Build()
+}
+
+func testNamespace(name string, labels map[string]string) *corev1.Namespace {
+	return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}}
+}
+
+// sameNames returns whether both lists hold the same names, in any order.
+func sameNames(names, expected []string) bool {
+	if len(names) != len(expected) {
+		return false
+	}
+	seen := map[string]bool{}
+	for _, name := range names {
+		seen[name] = true
+	}
+	for _, name := range expected {
+		if !seen[name] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,176 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	redhatcopv1alpha1 "github.com/redhat-cop/podpreset-webhook/api/v1alpha1"
+	"github.com/redhat-cop/podpreset-webhook/pkg/metrics"
+	"github.com/redhat-cop/podpreset-webhook/pkg/podpreset"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// PodPresetReconciler reconciles the status of a PodPreset object
+type PodPresetReconciler struct {
+	client.Client
+	Log    logr.Logger
+	Scheme *runtime.Scheme
+
+	// NamespaceSelection selects the namespaces whose pods are subject to
+	// PodPresets, like the admission webhook does.
+	NamespaceSelection podpreset.NamespaceSelection
+}
+
+// +kubebuilder:rbac:groups=redhatcop.redhat.io,resources=podpresets/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=serviceaccounts,verbs=get;list;watch
+
+// Reconcile updates the conditions and pod counts of a PodPreset. The pods of
+// a namespace which is not subject to PodPresets are neither counted nor
+// restarted.
+func (r *PodPresetReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := r.Log.WithValues("podpreset", req.NamespacedName)
+
+	pp := &redhatcopv1alpha1.PodPreset{}
+	if err := r.Get(ctx, req.NamespacedName, pp); err != nil {
+		if apierrors.IsNotFound(err) {
+			metrics.InvalidSelectorPresets.DeleteLabelValues(req.Namespace, "PodPreset", req.Name)
+		}
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	podPresetList := &redhatcopv1alpha1.PodPresetList{}
+	if err := r.List(ctx, podPresetList, client.InNamespace(req.Namespace)); err != nil {
+		return ctrl.Result{}, err
+	}
+	var others []*redhatcopv1alpha1.PodPreset
+	for i := range podPresetList.Items {
+		others = append(others, &podPresetList.Items[i])
+	}
+
+	serviceAccounts, err := listServiceAccounts(ctx, r.Client, &pp.Spec, client.InNamespace(req.Namespace))
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	namespace := &corev1.Namespace{}
+	if err := r.Get(ctx, types.NamespacedName{Name: req.Namespace}, namespace); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	podList := &corev1.PodList{}
+	if r.NamespaceSelection.Selects(namespace) {
+		if err := r.List(ctx, podList, client.InNamespace(req.Namespace)); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	errs := podpreset.ValidatePodPresetSpec(&pp.Spec, field.NewPath("spec"))
+
+	selector, err := podpreset.NewSelector(pp)
+	setInvalidSelector(req.Namespace, "PodPreset", req.Name, err != nil)
+
+	status := podPresetStatus(pp, pp.Status, errs, podpreset.DescribePresetConflicts(pp, others), podList.Items, func(pod *corev1.Pod) bool {
+		return isInjectable(pod) && isSelected(selector, pod, nil, podServiceAccount(serviceAccounts, pod))
+	})
+
+	requeueAfter, rolloutErr := rolloutStalePods(ctx, r.Client, pp, &status, podList.Items, time.Now())
+
+	if !equality.Semantic.DeepEqual(status, pp.Status) {
+		pp.Status = status
+		if err := r.Status().Update(ctx, pp); err != nil {
+			return ctrl.Result{}, err
+		}
+		log.V(1).Info("updated status", "matchingPods", status.MatchingPods, "stalePods", status.StalePods)
+	}
+
+	// a failed rollout is retried with the backoff of the work queue
+	if rolloutErr != nil {
+		return ctrl.Result{}, fmt.Errorf("unable to restart workloads: %v", rolloutErr)
+	}
+	return ctrl.Result{RequeueAfter: requeueAfter}, nil
+}
+
+// podPresetsForPod enqueues the PodPresets of the namespace of the pod whose
+// status may be changed by the pod: the ones injected into the pod or
+// selecting it.
+func (r *PodPresetReconciler) podPresetsForPod(obj client.Object) []reconcile.Request {
+	pod, ok := obj.(*corev1.Pod)
+	if !ok {
+		return nil
+	}
+
+	podPresetList := &redhatcopv1alpha1.PodPresetList{}
+	if err := r.List(context.TODO(), podPresetList, client.InNamespace(pod.Namespace)); err != nil {
+		r.Log.Error(err, "unable to list podpresets", "namespace", pod.Namespace)
+		return nil
+	}
+
+	serviceAccount := getServiceAccount(context.TODO(), r.Client, pod)
+
+	var requests []reconcile.Request
+	for i := range podPresetList.Items {
+		pp := &podPresetList.Items[i]
+		selector, _ := podpreset.NewSelector(pp)
+		if isRecorded(pod, pp) || isSelected(selector, pod, nil, serviceAccount) {
+			requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: pp.Namespace, Name: pp.Name}})
+		}
+	}
+	return requests
+}
+
+// podPresetsForNamespace enqueues the PodPresets of the namespace, which may
+// become subject to PodPresets or stop being so when its labels change.
+func (r *PodPresetReconciler) podPresetsForNamespace(obj client.Object) []reconcile.Request {
+	podPresetList := &redhatcopv1alpha1.PodPresetList{}
+	if err := r.List(context.TODO(), podPresetList, client.InNamespace(obj.GetName())); err != nil {
+		r.Log.Error(err, "unable to list podpresets", "namespace", obj.GetName())
+		return nil
+	}
+
+	requests := make([]reconcile.Request, len(podPresetList.Items))
+	for i, pp := range podPresetList.Items {
+		requests[i] = reconcile.Request{NamespacedName: types.NamespacedName{Namespace: pp.Namespace, Name: pp.Name}}
+	}
+	return requests
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *PodPresetReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&redhatcopv1alpha1.PodPreset{}).
+		Watches(&source.Kind{Type: &corev1.Pod{}}, handler.EnqueueRequestsFromMapFunc(r.podPresetsForPod)).
+		Watches(&source.Kind{Type: &corev1.Namespace{}}, handler.EnqueueRequestsFromMapFunc(r.podPresetsForNamespace), builder.WithPredicates(namespaceLabelsChanged)).
+		Complete(r)
+}
@@ -0,0 +1,81 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr"
+	redhatcopv1alpha1 "github.com/redhat-cop/podpreset-webhook/api/v1alpha1"
+	"github.com/redhat-cop/podpreset-webhook/pkg/podpreset"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+func TestPodPresetReconcile(t *testing.T) {
+	tests := []struct {
+		name         string
+		labels       map[string]string
+		matchingPods int32
+		stalePods    int32
+	}{
+		{
+			name:         "namespace subject to podpresets",
+			matchingPods: 1,
+			stalePods:    1,
+		},
+		{
+			name:   "namespace opted out",
+			labels: map[string]string{podpreset.NamespaceInjectionLabel: podpreset.NamespaceInjectionDisabled},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pp := &redhatcopv1alpha1.PodPreset{
+				ObjectMeta: metav1.ObjectMeta{Name: "proxy", Namespace: "default", Generation: 1},
+				Spec: redhatcopv1alpha1.PodPresetSpec{
+					Selector: metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+				},
+			}
+			pod := testPod("web", nil)
+			stale := testPod("stale", map[string]string{"podpreset.admission.kubernetes.io/podpreset-proxy": "1"})
+			stale.Labels = nil
+
+			r := &PodPresetReconciler{
+				Client: newTestClient(t, pp, testNamespace("default", tt.labels), &pod, &stale),
+				Log:    logr.Discard(),
+			}
+			if _, err := r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "proxy"}}); err != nil {
+				t.Fatal(err)
+			}
+
+			reconciled := &redhatcopv1alpha1.PodPreset{}
+			if err := r.Get(context.TODO(), types.NamespacedName{Namespace: "default", Name: "proxy"}, reconciled); err != nil {
+				t.Fatal(err)
+			}
+			if reconciled.Status.MatchingPods != tt.matchingPods {
+				t.Errorf("expected %d matching pods, got %d", tt.matchingPods, reconciled.Status.MatchingPods)
+			}
+			if reconciled.Status.StalePods != tt.stalePods {
+				t.Errorf("expected %d stale pods, got %d", tt.stalePods, reconciled.Status.StalePods)
+			}
+		})
+	}
+}
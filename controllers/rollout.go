@@ -0,0 +1,172 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	redhatcopv1alpha1 "github.com/redhat-cop/podpreset-webhook/api/v1alpha1"
+	"github.com/redhat-cop/podpreset-webhook/pkg/podpreset"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// defaultRolloutMinInterval is the minimum time between two workload restarts
+// when the RolloutPolicy does not set one.
+const defaultRolloutMinInterval = time.Minute
+
+// +kubebuilder:rbac:groups=apps,resources=deployments;statefulsets;daemonsets,verbs=get;list;watch;patch
+// +kubebuilder:rbac:groups=apps,resources=replicasets,verbs=get;list;watch
+
+// rolloutStalePods restarts a workload owning a pod injected with a previous
+// version of the PodPreset, when allowed by its RolloutPolicy. At most one
+// workload is restarted per call and the time of the restart is recorded in
+// the status. It returns the duration after which the rollout should be
+// resumed, or 0 when there is nothing left to restart.
+func rolloutStalePods(ctx context.Context, c client.Client, pp *redhatcopv1alpha1.PodPreset, status *redhatcopv1alpha1.PodPresetStatus, pods []corev1.Pod, now time.Time) (time.Duration, error) {
+	if pp.Spec.GetRolloutPolicyType() != redhatcopv1alpha1.RolloutPolicyRestart {
+		return 0, nil
+	}
+	policy := pp.Spec.RolloutPolicy
+
+	annotationKey := podpreset.AnnotationKey(pp)
+	var stalePods []*corev1.Pod
+	for i := range pods {
+		pod := &pods[i]
+		if isStale(pod, annotationKey, status.SpecResourceVersion) {
+			stalePods = append(stalePods, pod)
+		}
+	}
+	if len(stalePods) == 0 {
+		return 0, nil
+	}
+
+	if policy.MaintenanceWindow != nil {
+		wait, err := untilMaintenanceWindow(policy.MaintenanceWindow, now)
+		if err != nil || wait > 0 {
+			return wait, err
+		}
+	}
+
+	minInterval := defaultRolloutMinInterval
+	if policy.MinInterval != nil {
+		minInterval = policy.MinInterval.Duration
+	}
+	if status.LastRolloutTime != nil {
+		if elapsed := now.Sub(status.LastRolloutTime.Time); elapsed < minInterval {
+			return minInterval - elapsed, nil
+		}
+	}
+
+	sort.Slice(stalePods, func(i, j int) bool {
+		if stalePods[i].Namespace != stalePods[j].Namespace {
+			return stalePods[i].Namespace < stalePods[j].Namespace
+		}
+		return stalePods[i].Name < stalePods[j].Name
+	})
+
+	rolloutKey := podpreset.RolloutAnnotationKey(pp)
+	for _, pod := range stalePods {
+		workload, err := ownerWorkload(ctx, c, pod)
+		if err != nil {
+			return 0, err
+		}
+		if workload == nil {
+			continue
+		}
+
+		// the workload has already been restarted for the current version of
+		// the PodPreset, its stale pods are being replaced.
+		template := podpreset.PodTemplate(workload)
+		if template.Annotations[rolloutKey] == status.SpecResourceVersion {
+			continue
+		}
+
+		patch := client.MergeFrom(workload.DeepCopyObject().(client.Object))
+		if template.Annotations == nil {
+			template.Annotations = map[string]string{}
+		}
+		template.Annotations[rolloutKey] = status.SpecResourceVersion
+		if err := c.Patch(ctx, workload, patch); err != nil {
+			return 0, err
+		}
+
+		status.LastRolloutTime = &metav1.Time{Time: now}
+		return minInterval, nil
+	}
+
+	return 0, nil
+}
+
+// ownerWorkload returns the Deployment, StatefulSet or DaemonSet controlling
+// the pod, or nil when the pod is not controlled by one of them.
+func ownerWorkload(ctx context.Context, c client.Client, pod *corev1.Pod) (client.Object, error) {
+	ref := metav1.GetControllerOf(pod)
+	if ref == nil || ref.APIVersion != appsv1.SchemeGroupVersion.String() {
+		return nil, nil
+	}
+
+	var workload client.Object
+	switch ref.Kind {
+	case "ReplicaSet":
+		rs := &appsv1.ReplicaSet{}
+		if err := c.Get(ctx, types.NamespacedName{Namespace: pod.Namespace, Name: ref.Name}, rs); err != nil {
+			return nil, client.IgnoreNotFound(err)
+		}
+		ref = metav1.GetControllerOf(rs)
+		if ref == nil || ref.APIVersion != appsv1.SchemeGroupVersion.String() || ref.Kind != "Deployment" {
+			return nil, nil
+		}
+		workload = &appsv1.Deployment{}
+	case "StatefulSet":
+		workload = &appsv1.StatefulSet{}
+	case "DaemonSet":
+		workload = &appsv1.DaemonSet{}
+	default:
+		return nil, nil
+	}
+
+	if err := c.Get(ctx, types.NamespacedName{Namespace: pod.Namespace, Name: ref.Name}, workload); err != nil {
+		return nil, client.IgnoreNotFound(err)
+	}
+	return workload, nil
+}
+
+// untilMaintenanceWindow returns the duration until the maintenance window
+// opens, or 0 when it is open.
+func untilMaintenanceWindow(window *redhatcopv1alpha1.MaintenanceWindow, now time.Time) (time.Duration, error) {
+	start, err := time.Parse(redhatcopv1alpha1.MaintenanceWindowLayout, window.Start)
+	if err != nil {
+		return 0, err
+	}
+
+	now = now.UTC()
+	opened := time.Date(now.Year(), now.Month(), now.Day(), start.Hour(), start.Minute(), 0, 0, time.UTC)
+	if opened.After(now) {
+		opened = opened.AddDate(0, 0, -1)
+	}
+	if now.Before(opened.Add(window.Duration.Duration)) {
+		return 0, nil
+	}
+
+	return opened.AddDate(0, 0, 1).Sub(now), nil
+}
@@ -0,0 +1,250 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	redhatcopv1alpha1 "github.com/redhat-cop/podpreset-webhook/api/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestUntilMaintenanceWindow(t *testing.T) {
+	// the window opens at 22:00 UTC and wraps midnight
+	night := &redhatcopv1alpha1.MaintenanceWindow{Start: "22:00", Duration: metav1.Duration{Duration: 4 * time.Hour}}
+	morning := &redhatcopv1alpha1.MaintenanceWindow{Start: "09:00", Duration: metav1.Duration{Duration: time.Hour}}
+
+	tests := []struct {
+		name     string
+		window   *redhatcopv1alpha1.MaintenanceWindow
+		now      time.Time
+		expected time.Duration
+		err      bool
+	}{
+		{
+			name:   "open",
+			window: night,
+			now:    testTime(23, 0),
+		},
+		{
+			name:   "open after midnight",
+			window: night,
+			now:    testTime(1, 59),
+		},
+		{
+			name:   "at the start",
+			window: night,
+			now:    testTime(22, 0),
+		},
+		{
+			name:     "at the end",
+			window:   night,
+			now:      testTime(2, 0),
+			expected: 20 * time.Hour,
+		},
+		{
+			name:     "before the start",
+			window:   night,
+			now:      testTime(21, 59),
+			expected: time.Minute,
+		},
+		{
+			name:     "closed",
+			window:   night,
+			now:      testTime(12, 0),
+			expected: 10 * time.Hour,
+		},
+		{
+			name:     "closed until the next day",
+			window:   morning,
+			now:      testTime(10, 30),
+			expected: 22*time.Hour + 30*time.Minute,
+		},
+		{
+			name:     "local time",
+			window:   night,
+			now:      time.Date(2021, time.March, 1, 23, 30, 0, 0, time.FixedZone("CEST", 2*60*60)),
+			expected: 30 * time.Minute,
+		},
+		{
+			name:   "invalid start",
+			window: &redhatcopv1alpha1.MaintenanceWindow{Start: "10pm", Duration: metav1.Duration{Duration: time.Hour}},
+			now:    testTime(22, 0),
+			err:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wait, err := untilMaintenanceWindow(tt.window, tt.now)
+			if (err != nil) != tt.err {
+				t.Fatalf("expected error %v, got %v", tt.err, err)
+			}
+			if wait != tt.expected {
+				t.Errorf("expected to wait %v, got %v", tt.expected, wait)
+			}
+		})
+	}
+}
+
+func TestRolloutStalePods(t *testing.T) {
+	now := testTime(12, 0)
+
+	tests := []struct {
+		name            string
+		policy          *redhatcopv1alpha1.RolloutPolicy
+		lastRolloutTime time.Time
+		// restarted is the version of the PodPreset the Deployment has been
+		// restarted for
+		restarted string
+
+		expected        time.Duration
+		err             bool
+		expectRestarted bool
+	}{
+		{
+			name:     "never",
+			policy:   nil,
+			expected: 0,
+		},
+		{
+			name:            "restarted",
+			policy:          &redhatcopv1alpha1.RolloutPolicy{Type: redhatcopv1alpha1.RolloutPolicyRestart},
+			expected:        time.Minute,
+			expectRestarted: true,
+		},
+		{
+			name:            "interval elapsed",
+			policy:          &redhatcopv1alpha1.RolloutPolicy{Type: redhatcopv1alpha1.RolloutPolicyRestart, MinInterval: &metav1.Duration{Duration: 5 * time.Minute}},
+			lastRolloutTime: now.Add(-5 * time.Minute),
+			expected:        5 * time.Minute,
+			expectRestarted: true,
+		},
+		{
+			name:            "interval not elapsed",
+			policy:          &redhatcopv1alpha1.RolloutPolicy{Type: redhatcopv1alpha1.RolloutPolicyRestart, MinInterval: &metav1.Duration{Duration: 5 * time.Minute}},
+			lastRolloutTime: now.Add(-2 * time.Minute),
+			expected:        3 * time.Minute,
+		},
+		{
+			name:            "default interval not elapsed",
+			policy:          &redhatcopv1alpha1.RolloutPolicy{Type: redhatcopv1alpha1.RolloutPolicyRestart},
+			lastRolloutTime: now.Add(-20 * time.Second),
+			expected:        40 * time.Second,
+		},
+		{
+			name: "maintenance window closed",
+			policy: &redhatcopv1alpha1.RolloutPolicy{
+				Type:              redhatcopv1alpha1.RolloutPolicyRestart,
+				MaintenanceWindow: &redhatcopv1alpha1.MaintenanceWindow{Start: "22:00", Duration: metav1.Duration{Duration: 4 * time.Hour}},
+			},
+			expected: 10 * time.Hour,
+		},
+		{
+			name: "maintenance window open",
+			policy: &redhatcopv1alpha1.RolloutPolicy{
+				Type:              redhatcopv1alpha1.RolloutPolicyRestart,
+				MaintenanceWindow: &redhatcopv1alpha1.MaintenanceWindow{Start: "11:00", Duration: metav1.Duration{Duration: 2 * time.Hour}},
+			},
+			expected:        time.Minute,
+			expectRestarted: true,
+		},
+		{
+			name: "invalid maintenance window",
+			policy: &redhatcopv1alpha1.RolloutPolicy{
+				Type:              redhatcopv1alpha1.RolloutPolicyRestart,
+				MaintenanceWindow: &redhatcopv1alpha1.MaintenanceWindow{Start: "noon", Duration: metav1.Duration{Duration: time.Hour}},
+			},
+			err: true,
+		},
+		{
+			name:      "already restarted",
+			policy:    &redhatcopv1alpha1.RolloutPolicy{Type: redhatcopv1alpha1.RolloutPolicyRestart},
+			restarted: "3",
+			expected:  0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pp := &redhatcopv1alpha1.PodPreset{
+				ObjectMeta: metav1.ObjectMeta{Name: "proxy", Namespace: "default"},
+				Spec:       redhatcopv1alpha1.PodPresetSpec{RolloutPolicy: tt.policy},
+			}
+			status := &redhatcopv1alpha1.PodPresetStatus{SpecResourceVersion: "3"}
+			if !tt.lastRolloutTime.IsZero() {
+				status.LastRolloutTime = &metav1.Time{Time: tt.lastRolloutTime}
+			}
+
+			deployment := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default", UID: "deployment"}}
+			if tt.restarted != "" {
+				deployment.Spec.Template.Annotations = map[string]string{"podpreset.admission.kubernetes.io/rollout-proxy": tt.restarted}
+			}
+			rs := &appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{
+				Name:            "web-5d4f8",
+				Namespace:       "default",
+				UID:             "replicaset",
+				OwnerReferences: []metav1.OwnerReference{testControllerRef("Deployment", "web", "deployment")},
+			}}
+			pod := testPod("web-5d4f8-x2k9q", map[string]string{"podpreset.admission.kubernetes.io/podpreset-proxy": "2"})
+			pod.OwnerReferences = []metav1.OwnerReference{testControllerRef("ReplicaSet", "web-5d4f8", "replicaset")}
+
+			c := newTestClient(t, deployment, rs, &pod)
+
+			wait, err := rolloutStalePods(context.TODO(), c, pp, status, []corev1.Pod{pod}, now)
+			if (err != nil) != tt.err {
+				t.Fatalf("expected error %v, got %v", tt.err, err)
+			}
+			if wait != tt.expected {
+				t.Errorf("expected to wait %v, got %v", tt.expected, wait)
+			}
+
+			restarted := &appsv1.Deployment{}
+			if err := c.Get(context.TODO(), types.NamespacedName{Namespace: "default", Name: "web"}, restarted); err != nil {
+				t.Fatal(err)
+			}
+			version, ok := restarted.Spec.Template.Annotations["podpreset.admission.kubernetes.io/rollout-proxy"]
+			if isRestarted := ok && version != tt.restarted; isRestarted != tt.expectRestarted {
+				t.Errorf("expected restarted %v, got template annotations %v", tt.expectRestarted, restarted.Spec.Template.Annotations)
+			}
+			if tt.expectRestarted && (version != "3" || status.LastRolloutTime == nil || !status.LastRolloutTime.Time.Equal(now)) {
+				t.Errorf("expected a restart for version 3 at %v, got version %s and status %v", now, version, status.LastRolloutTime)
+			}
+		})
+	}
+}
+
+// testTime returns the time of day of a fixed date in UTC.
+func testTime(hour, min int) time.Time {
+	return time.Date(2021, time.March, 1, hour, min, 0, 0, time.UTC)
+}
+
+func testControllerRef(kind, name string, uid types.UID) metav1.OwnerReference {
+	controller := true
+	return metav1.OwnerReference{
+		APIVersion: appsv1.SchemeGroupVersion.String(),
+		Kind:       kind,
+		Name:       name,
+		UID:        uid,
+		Controller: &controller,
+	}
+}
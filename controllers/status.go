@@ -0,0 +1,219 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	redhatcopv1alpha1 "github.com/redhat-cop/podpreset-webhook/api/v1alpha1"
+	"github.com/redhat-cop/podpreset-webhook/pkg/metrics"
+	"github.com/redhat-cop/podpreset-webhook/pkg/podpreset"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+// namespaceLabelsChanged filters the events of namespaces down to the changes
+// of their labels, which decide whether the pods of the namespace are subject
+// to PodPresets. The pods of created and deleted namespaces trigger events of
+// their own.
+var namespaceLabelsChanged = predicate.Funcs{
+	CreateFunc:  func(event.CreateEvent) bool { return false },
+	DeleteFunc:  func(event.DeleteEvent) bool { return false },
+	GenericFunc: func(event.GenericEvent) bool { return false },
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		return !equality.Semantic.DeepEqual(e.ObjectOld.GetLabels(), e.ObjectNew.GetLabels())
+	},
+}
+
+// podPresetStatus computes the status of a PodPreset from its validation
+// errors, its conflicts with other PodPresets and the pods of the cluster.
+// selected reports whether a pod is selected by the PodPreset.
+func podPresetStatus(pp *redhatcopv1alpha1.PodPreset, current redhatcopv1alpha1.PodPresetStatus, errs field.ErrorList, conflicts []string, pods []corev1.Pod, selected func(*corev1.Pod) bool) redhatcopv1alpha1.PodPresetStatus {
+	status := *current.DeepCopy()
+
+	// the resourceVersion changes with every status update, so the one
+	// identifying the current spec is recorded when a new generation is seen.
+	if status.ObservedGeneration != pp.GetGeneration() || status.SpecResourceVersion == "" {
+		status.ObservedGeneration = pp.GetGeneration()
+		status.SpecResourceVersion = pp.GetResourceVersion()
+	}
+
+	annotationKey := podpreset.AnnotationKey(pp)
+	conflictKey := podpreset.ConflictAnnotationKey(pp)
+
+	status.MatchingPods = 0
+	status.StalePods = 0
+	var conflictingPods int
+	for i := range pods {
+		pod := &pods[i]
+		if selected(pod) {
+			status.MatchingPods++
+		}
+		if isStale(pod, annotationKey, status.SpecResourceVersion) {
+			status.StalePods++
+		}
+		if _, ok := pod.Annotations[conflictKey]; ok {
+			conflictingPods++
+		}
+	}
+
+	if len(errs) > 0 {
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:    redhatcopv1alpha1.PodPresetConditionValid,
+			Status:  metav1.ConditionFalse,
+			Reason:  "Invalid",
+			Message: errs.ToAggregate().Error(),
+		})
+	} else {
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:   redhatcopv1alpha1.PodPresetConditionValid,
+			Status: metav1.ConditionTrue,
+			Reason: "Valid",
+		})
+	}
+
+	if conflictingPods > 0 {
+		conflicts = append(conflicts, fmt.Sprintf("%d pods recorded a conflict", conflictingPods))
+	}
+	if len(conflicts) > 0 {
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:    redhatcopv1alpha1.PodPresetConditionConflicting,
+			Status:  metav1.ConditionTrue,
+			Reason:  "ConflictDetected",
+			Message: strings.Join(conflicts, "; "),
+		})
+	} else {
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:   redhatcopv1alpha1.PodPresetConditionConflicting,
+			Status: metav1.ConditionFalse,
+			Reason: "NoConflict",
+		})
+	}
+
+	switch {
+	case len(errs) > 0:
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:    redhatcopv1alpha1.PodPresetConditionReady,
+			Status:  metav1.ConditionFalse,
+			Reason:  "Invalid",
+			Message: "the spec is invalid",
+		})
+	case len(conflicts) > 0:
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:    redhatcopv1alpha1.PodPresetConditionReady,
+			Status:  metav1.ConditionFalse,
+			Reason:  "Conflicting",
+			Message: "conflicts were detected",
+		})
+	default:
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:   redhatcopv1alpha1.PodPresetConditionReady,
+			Status: metav1.ConditionTrue,
+			Reason: "Ready",
+		})
+	}
+
+	return status
+}
+
+// isStale returns whether the pod records the injection of a previous version
+// of the PodPreset, whose annotation key is given and whose current spec is
+// identified by specResourceVersion.
+func isStale(pod *corev1.Pod, annotationKey, specResourceVersion string) bool {
+	resourceVersion, ok := pod.Annotations[annotationKey]
+	return ok && resourceVersion != specResourceVersion
+}
+
+// setInvalidSelector records whether the selectors of a PodPreset or
+// ClusterPodPreset are invalid.
+func setInvalidSelector(namespace, kind, name string, invalid bool) {
+	value := 0.0
+	if invalid {
+		value = 1
+	}
+	metrics.InvalidSelectorPresets.WithLabelValues(namespace, kind, name).Set(value)
+}
+
+// isInjectable returns whether a pod is subject to PodPresets at all.
+func isInjectable(pod *corev1.Pod) bool {
+	if _, isMirrorPod := pod.Annotations[corev1.MirrorPodAnnotationKey]; isMirrorPod {
+		return false
+	}
+	return !podpreset.IsOptedOut(pod)
+}
+
+// isSelected returns whether the Selector of a PodPreset selects the pod. The
+// Selector of an invalid PodPreset is nil and selects no pod.
+func isSelected(selector *podpreset.Selector, pod *corev1.Pod, namespace *corev1.Namespace, serviceAccount *corev1.ServiceAccount) bool {
+	if selector == nil {
+		return false
+	}
+	selected, _ := selector.Selects(pod, namespace, serviceAccount)
+	return selected
+}
+
+// isRecorded returns whether the pod records the injection of the PodPreset
+// or a conflict with it.
+func isRecorded(pod *corev1.Pod, pp *redhatcopv1alpha1.PodPreset) bool {
+	_, injected := pod.Annotations[podpreset.AnnotationKey(pp)]
+	_, conflicting := pod.Annotations[podpreset.ConflictAnnotationKey(pp)]
+	return injected || conflicting
+}
+
+// getServiceAccount returns the ServiceAccount the pod runs as, or nil when it
+// cannot be read.
+func getServiceAccount(ctx context.Context, c client.Client, pod *corev1.Pod) *corev1.ServiceAccount {
+	serviceAccount := &corev1.ServiceAccount{}
+	if err := c.Get(ctx, types.NamespacedName{Namespace: pod.Namespace, Name: podpreset.ServiceAccountName(pod)}, serviceAccount); err != nil {
+		return nil
+	}
+	return serviceAccount
+}
+
+// listServiceAccounts returns the ServiceAccounts pods may run as by
+// namespace and name, when the PodPreset selects ServiceAccounts by labels.
+func listServiceAccounts(ctx context.Context, c client.Client, spec *redhatcopv1alpha1.PodPresetSpec, opts ...client.ListOption) (map[types.NamespacedName]*corev1.ServiceAccount, error) {
+	serviceAccounts := map[types.NamespacedName]*corev1.ServiceAccount{}
+	if spec.ServiceAccountSelector == nil || spec.ServiceAccountSelector.Selector == nil {
+		return serviceAccounts, nil
+	}
+
+	serviceAccountList := &corev1.ServiceAccountList{}
+	if err := c.List(ctx, serviceAccountList, opts...); err != nil {
+		return nil, err
+	}
+	for i := range serviceAccountList.Items {
+		sa := &serviceAccountList.Items[i]
+		serviceAccounts[types.NamespacedName{Namespace: sa.Namespace, Name: sa.Name}] = sa
+	}
+	return serviceAccounts, nil
+}
+
+// podServiceAccount returns the ServiceAccount the pod runs as, or nil when it
+// is not known.
+func podServiceAccount(serviceAccounts map[types.NamespacedName]*corev1.ServiceAccount, pod *corev1.Pod) *corev1.ServiceAccount {
+	return serviceAccounts[types.NamespacedName{Namespace: pod.Namespace, Name: podpreset.ServiceAccountName(pod)}]
+}
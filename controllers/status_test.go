@@ -0,0 +1,213 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+
+	redhatcopv1alpha1 "github.com/redhat-cop/podpreset-webhook/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+func TestPodPresetStatus(t *testing.T) {
+	tests := []struct {
+		name      string
+		current   redhatcopv1alpha1.PodPresetStatus
+		errs      field.ErrorList
+		conflicts []string
+		pods      []corev1.Pod
+
+		specResourceVersion string
+		matchingPods        int32
+		stalePods           int32
+		// conditions are the expected status and reason of each condition
+		conditions map[string][2]string
+		// conflictMessage is the expected message of the Conflicting condition
+		conflictMessage string
+	}{
+		{
+			name:                "ready",
+			specResourceVersion: "3",
+			conditions:          readyConditions(),
+		},
+		{
+			name: "pods counted",
+			pods: []corev1.Pod{
+				testPod("selected", nil),
+				testPod("injected", map[string]string{"podpreset.admission.kubernetes.io/podpreset-proxy": "3"}),
+				testPod("stale", map[string]string{"podpreset.admission.kubernetes.io/podpreset-proxy": "2"}),
+				testPod("other", map[string]string{"podpreset.admission.kubernetes.io/podpreset-other": "2"}),
+			},
+			specResourceVersion: "3",
+			matchingPods:        2,
+			stalePods:           1,
+			conditions:          readyConditions(),
+		},
+		{
+			name: "spec resource version kept",
+			current: redhatcopv1alpha1.PodPresetStatus{
+				ObservedGeneration:  2,
+				SpecResourceVersion: "2",
+			},
+			pods: []corev1.Pod{
+				testPod("injected", map[string]string{"podpreset.admission.kubernetes.io/podpreset-proxy": "2"}),
+			},
+			specResourceVersion: "2",
+			matchingPods:        1,
+			conditions:          readyConditions(),
+		},
+		{
+			name: "new generation",
+			current: redhatcopv1alpha1.PodPresetStatus{
+				ObservedGeneration:  1,
+				SpecResourceVersion: "2",
+			},
+			pods: []corev1.Pod{
+				testPod("injected", map[string]string{"podpreset.admission.kubernetes.io/podpreset-proxy": "2"}),
+			},
+			specResourceVersion: "3",
+			matchingPods:        1,
+			stalePods:           1,
+			conditions:          readyConditions(),
+		},
+		{
+			name:                "invalid",
+			errs:                field.ErrorList{field.Invalid(field.NewPath("spec", "selector"), "", "invalid selector")},
+			conflicts:           []string{"env HTTP_PROXY conflicts with PodPreset other"},
+			specResourceVersion: "3",
+			conditions: map[string][2]string{
+				redhatcopv1alpha1.PodPresetConditionValid:       {"False", "Invalid"},
+				redhatcopv1alpha1.PodPresetConditionConflicting: {"True", "ConflictDetected"},
+				redhatcopv1alpha1.PodPresetConditionReady:       {"False", "Invalid"},
+			},
+			conflictMessage: "env HTTP_PROXY conflicts with PodPreset other",
+		},
+		{
+			name:      "conflicting podpresets",
+			conflicts: []string{"env HTTP_PROXY conflicts with PodPreset a", "env NO_PROXY conflicts with PodPreset b"},
+			pods: []corev1.Pod{
+				testPod("conflicting", map[string]string{"podpreset.admission.kubernetes.io/conflict-proxy": "Ignore"}),
+			},
+			specResourceVersion: "3",
+			matchingPods:        1,
+			conditions:          conflictingConditions(),
+			conflictMessage:     "env HTTP_PROXY conflicts with PodPreset a; env NO_PROXY conflicts with PodPreset b; 1 pods recorded a conflict",
+		},
+		{
+			name: "conflicting pods",
+			pods: []corev1.Pod{
+				testPod("conflicting", map[string]string{"podpreset.admission.kubernetes.io/conflict-proxy": "Ignore"}),
+				testPod("other", map[string]string{"podpreset.admission.kubernetes.io/conflict-other": "Ignore"}),
+			},
+			specResourceVersion: "3",
+			matchingPods:        1,
+			conditions:          conflictingConditions(),
+			conflictMessage:     "1 pods recorded a conflict",
+		},
+		{
+			name: "conflicts resolved",
+			current: redhatcopv1alpha1.PodPresetStatus{
+				ObservedGeneration:  2,
+				SpecResourceVersion: "3",
+				Conditions: []metav1.Condition{
+					{Type: redhatcopv1alpha1.PodPresetConditionConflicting, Status: metav1.ConditionTrue, Reason: "ConflictDetected", Message: "1 pods recorded a conflict"},
+					{Type: redhatcopv1alpha1.PodPresetConditionReady, Status: metav1.ConditionFalse, Reason: "Conflicting"},
+				},
+			},
+			specResourceVersion: "3",
+			conditions:          readyConditions(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pp := &redhatcopv1alpha1.PodPreset{
+				ObjectMeta: metav1.ObjectMeta{Name: "proxy", Namespace: "default", Generation: 2, ResourceVersion: "3"},
+			}
+			// the pods whose name is not "other" or "stale" are selected
+			selected := func(pod *corev1.Pod) bool {
+				return pod.Name != "other" && pod.Name != "stale"
+			}
+
+			current := tt.current.DeepCopy()
+			status := podPresetStatus(pp, tt.current, tt.errs, tt.conflicts, tt.pods, selected)
+
+			if status.ObservedGeneration != 2 {
+				t.Errorf("expected observed generation 2, got %d", status.ObservedGeneration)
+			}
+			if status.SpecResourceVersion != tt.specResourceVersion {
+				t.Errorf("expected spec resource version %s, got %s", tt.specResourceVersion, status.SpecResourceVersion)
+			}
+			if status.MatchingPods != tt.matchingPods {
+				t.Errorf("expected %d matching pods, got %d", tt.matchingPods, status.MatchingPods)
+			}
+			if status.StalePods != tt.stalePods {
+				t.Errorf("expected %d stale pods, got %d", tt.stalePods, status.StalePods)
+			}
+			if len(status.Conditions) != len(tt.conditions) {
+				t.Errorf("expected %d conditions, got %v", len(tt.conditions), status.Conditions)
+			}
+			for conditionType, expected := range tt.conditions {
+				condition := meta.FindStatusCondition(status.Conditions, conditionType)
+				if condition == nil {
+					t.Errorf("expected condition %s", conditionType)
+					continue
+				}
+				if string(condition.Status) != expected[0] || condition.Reason != expected[1] {
+					t.Errorf("expected condition %s to be %s with reason %s, got %s with reason %s", conditionType, expected[0], expected[1], condition.Status, condition.Reason)
+				}
+			}
+			if condition := meta.FindStatusCondition(status.Conditions, redhatcopv1alpha1.PodPresetConditionConflicting); condition != nil && condition.Message != tt.conflictMessage {
+				t.Errorf("expected conflict message %q, got %q", tt.conflictMessage, condition.Message)
+			}
+			if !equality.Semantic.DeepEqual(tt.current, *current) {
+				t.Errorf("expected the current status not to be modified, got %v", tt.current)
+			}
+		})
+	}
+}
+
+func readyConditions() map[string][2]string {
+	return map[string][2]string{
+		redhatcopv1alpha1.PodPresetConditionValid:       {"True", "Valid"},
+		redhatcopv1alpha1.PodPresetConditionConflicting: {"False", "NoConflict"},
+		redhatcopv1alpha1.PodPresetConditionReady:       {"True", "Ready"},
+	}
+}
+
+func conflictingConditions() map[string][2]string {
+	return map[string][2]string{
+		redhatcopv1alpha1.PodPresetConditionValid:       {"True", "Valid"},
+		redhatcopv1alpha1.PodPresetConditionConflicting: {"True", "ConflictDetected"},
+		redhatcopv1alpha1.PodPresetConditionReady:       {"False", "Conflicting"},
+	}
+}
+
+func testPod(name string, annotations map[string]string) corev1.Pod {
+	return corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Namespace:   "default",
+			Labels:      map[string]string{"app": "web"},
+			Annotations: annotations,
+		},
+	}
+}
@@ -4,8 +4,11 @@ go 1.15
 
 require (
 	github.com/go-logr/logr v0.3.0
+	github.com/prometheus/client_golang v1.7.1
+	gomodules.xyz/jsonpatch/v2 v2.1.0
 	k8s.io/api v0.19.2
 	k8s.io/apimachinery v0.19.2
 	k8s.io/client-go v0.19.2
 	sigs.k8s.io/controller-runtime v0.7.0
+	sigs.k8s.io/yaml v1.2.0
 )
@@ -17,14 +17,19 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"flag"
+	"fmt"
 	"os"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -33,7 +38,10 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 
 	redhatcopv1alpha1 "github.com/redhat-cop/podpreset-webhook/api/v1alpha1"
+	"github.com/redhat-cop/podpreset-webhook/controllers"
+	"github.com/redhat-cop/podpreset-webhook/pkg/certs"
 	"github.com/redhat-cop/podpreset-webhook/pkg/handler"
+	"github.com/redhat-cop/podpreset-webhook/pkg/podpreset"
 	// +kubebuilder:scaffold:imports
 )
 
@@ -48,6 +56,8 @@ const (
 
 	webhookCertName = "apiserver.crt"
 	webhookKeyName  = "apiserver.key"
+
+	podNamespaceEnv = "POD_NAMESPACE"
 )
 
 func init() {
@@ -61,11 +71,35 @@ func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
+	var namespaceInjection string
+	var selfManagedCerts bool
+	var certSecretName string
+	var certValidity time.Duration
+	var webhookServiceName string
+	var mutatingWebhookConfiguration string
+	var validatingWebhookConfiguration string
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.StringVar(&namespaceInjection, "namespace-injection", string(podpreset.NamespaceInjectionOptOut),
+		"Namespaces whose pods are subject to PodPresets. "+
+			"With opt-out, every namespace not labeled "+podpreset.NamespaceInjectionLabel+"=disabled is processed. "+
+			"With opt-in, only namespaces labeled "+podpreset.NamespaceInjectionLabel+"=enabled are processed.")
+	flag.BoolVar(&selfManagedCerts, "self-managed-certs", false,
+		"Generate and rotate the serving certificate of the webhook instead of reading it from an external certificate manager. "+
+			"The certificates are stored in a secret and their CA is injected into the webhook configurations.")
+	flag.StringVar(&certSecretName, "cert-secret-name", "podpreset-webhook-webhook-server-cert",
+		"The secret of the namespace of the webhook holding the self-managed certificates.")
+	flag.DurationVar(&certValidity, "cert-validity", certs.DefaultValidity,
+		"The validity of the self-managed certificates, which are rotated when a third of it remains.")
+	flag.StringVar(&webhookServiceName, "webhook-service-name", "podpreset-webhook-webhook-service",
+		"The service of the webhook the self-managed serving certificate is issued for.")
+	flag.StringVar(&mutatingWebhookConfiguration, "mutating-webhook-configuration", "podpreset-webhook-mutating-webhook-configuration",
+		"The mutating webhook configuration the CA of the self-managed certificates is injected into.")
+	flag.StringVar(&validatingWebhookConfiguration, "validating-webhook-configuration", "podpreset-webhook-validating-webhook-configuration",
+		"The validating webhook configuration the CA of the self-managed certificates is injected into.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -74,6 +108,16 @@ func main() {
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
+	namespaceInjectionMode, err := podpreset.ParseNamespaceInjectionMode(namespaceInjection)
+	if err != nil {
+		setupLog.Error(err, "invalid namespace-injection")
+		os.Exit(1)
+	}
+	namespaceSelection := podpreset.NamespaceSelection{
+		Mode:               namespaceInjectionMode,
+		ExcludedNamespaces: getExcludedNamespaces(),
+	}
+
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme:                     scheme,
 		MetricsBindAddress:         metricsAddr,
@@ -93,8 +137,61 @@ func main() {
 	webhookSvr.CertDir = getWebhookCertDir()
 	webhookSvr.CertName = webhookCertName
 	webhookSvr.KeyName = webhookKeyName
-	webhookSvr.Register("/mutate", &webhook.Admission{Handler: &handler.PodPresetMutator{Client: mgr.GetClient(), Log: ctrl.Log.WithName("PodPreset")}})
 
+	if selfManagedCerts {
+		podNamespace := os.Getenv(podNamespaceEnv)
+		if podNamespace == "" {
+			setupLog.Error(fmt.Errorf("%s is not set", podNamespaceEnv), "self-managed certificates require the namespace of the webhook")
+			os.Exit(1)
+		}
+
+		rotator := &certs.Rotator{
+			Client:                          mgr.GetClient(),
+			Reader:                          mgr.GetAPIReader(),
+			Secret:                          types.NamespacedName{Namespace: podNamespace, Name: certSecretName},
+			DNSNames:                        []string{fmt.Sprintf("%s.%s.svc", webhookServiceName, podNamespace), fmt.Sprintf("%s.%s.svc.cluster.local", webhookServiceName, podNamespace)},
+			CertDir:                         webhookSvr.CertDir,
+			CertName:                        webhookSvr.CertName,
+			KeyName:                         webhookSvr.KeyName,
+			MutatingWebhookConfigurations:   []string{mutatingWebhookConfiguration},
+			ValidatingWebhookConfigurations: []string{validatingWebhookConfiguration},
+			Validity:                        certValidity,
+			Log:                             ctrl.Log.WithName("certs"),
+		}
+		// the webhook server requires the certificates when it starts
+		if err := rotator.Bootstrap(context.Background()); err != nil {
+			setupLog.Error(err, "unable to bootstrap certificates")
+			os.Exit(1)
+		}
+		if err := rotator.AddToManager(mgr); err != nil {
+			setupLog.Error(err, "unable to set up certificate rotation")
+			os.Exit(1)
+		}
+	}
+
+	webhookSvr.Register("/mutate", &webhook.Admission{Handler: &handler.PodPresetMutator{Client: mgr.GetClient(), Recorder: mgr.GetEventRecorderFor("podpreset-webhook"), APIReader: mgr.GetAPIReader(), NamespaceSelection: namespaceSelection, Log: ctrl.Log.WithName("PodPreset")}})
+	webhookSvr.Register("/mutate-workloads", &webhook.Admission{Handler: &handler.WorkloadMutator{Client: mgr.GetClient(), NamespaceSelection: namespaceSelection, Log: ctrl.Log.WithName("WorkloadMutator")}})
+	webhookSvr.Register("/explain", &handler.PodPresetExplainer{Client: mgr.GetClient(), NamespaceSelection: namespaceSelection, Log: ctrl.Log.WithName("PodPresetExplainer")})
+	webhookSvr.Register("/validate", &webhook.Admission{Handler: &handler.PodPresetValidator{Client: mgr.GetClient(), Log: ctrl.Log.WithName("PodPresetValidator")}})
+
+	if err = (&controllers.PodPresetReconciler{
+		Client:             mgr.GetClient(),
+		Log:                ctrl.Log.WithName("controllers").WithName("PodPreset"),
+		Scheme:             mgr.GetScheme(),
+		NamespaceSelection: namespaceSelection,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "PodPreset")
+		os.Exit(1)
+	}
+	if err = (&controllers.ClusterPodPresetReconciler{
+		Client:             mgr.GetClient(),
+		Log:                ctrl.Log.WithName("controllers").WithName("ClusterPodPreset"),
+		Scheme:             mgr.GetScheme(),
+		NamespaceSelection: namespaceSelection,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "ClusterPodPreset")
+		os.Exit(1)
+	}
 	// +kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("health", healthz.Ping); err != nil {
@@ -121,3 +218,15 @@ func getWebhookCertDir() string {
 
 	return defaultWebhookCertDir
 }
+
+// getExcludedNamespaces returns the namespaces never subject to PodPresets:
+// kube-system and the namespace of the webhook, so that it cannot block its
+// own pods.
+func getExcludedNamespaces() []string {
+	excluded := []string{metav1.NamespaceSystem}
+	if podNamespace := os.Getenv(podNamespaceEnv); podNamespace != "" {
+		excluded = append(excluded, podNamespace)
+	}
+
+	return excluded
+}
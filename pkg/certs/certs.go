@@ -0,0 +1,194 @@
+// Package certs manages the serving certificate of the webhook without an
+// external certificate manager. A CA and a serving certificate signed by it
+// are generated, stored in a Secret and rotated before they expire.
+package certs
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// CACertKey is the key of the CA bundle in the Secret holding the
+// certificates.
+const CACertKey = "ca.crt"
+
+const (
+	keySize = 2048
+
+	// clockSkew backdates the certificates so that they are valid on hosts
+	// whose clock is slightly behind.
+	clockSkew = time.Hour
+)
+
+// Certificates holds the PEM encoded CA and serving certificate of the
+// webhook.
+type Certificates struct {
+	// CACert is the bundle of trusted CA certificates. The first certificate
+	// is the CA signing Cert, the others are previous CAs kept until the
+	// clients trust the current one.
+	CACert []byte
+	Cert   []byte
+	Key    []byte
+}
+
+// Generate creates a new CA and a serving certificate signed by it for the
+// given DNS names, both valid for the given duration from now. The CA
+// certificate of previous, when set and still valid, is kept in the bundle.
+func Generate(dnsNames []string, validity time.Duration, now time.Time, previous *Certificates) (*Certificates, error) {
+	notBefore := now.Add(-clockSkew)
+	notAfter := now.Add(validity)
+
+	caKey, err := rsa.GenerateKey(rand.Reader, keySize)
+	if err != nil {
+		return nil, fmt.Errorf("generating CA key: %v", err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          serialNumber(),
+		Subject:               pkix.Name{CommonName: fmt.Sprintf("podpreset-webhook-ca@%d", now.Unix())},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		return nil, fmt.Errorf("creating CA certificate: %v", err)
+	}
+	caCert, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		return nil, fmt.Errorf("parsing CA certificate: %v", err)
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, keySize)
+	if err != nil {
+		return nil, fmt.Errorf("generating serving key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: serialNumber(),
+		Subject:      pkix.Name{CommonName: dnsNames[0]},
+		DNSNames:     dnsNames,
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, caKey)
+	if err != nil {
+		return nil, fmt.Errorf("creating serving certificate: %v", err)
+	}
+
+	certs := &Certificates{
+		CACert: encodeCert(caDER),
+		Cert:   encodeCert(der),
+		Key:    encodeKey(key),
+	}
+
+	// keep trusting the previous CA, as replicas may still serve a
+	// certificate signed by it
+	if previous != nil {
+		if previousCA, err := previous.ca(); err == nil && now.Before(previousCA.NotAfter) {
+			certs.CACert = append(certs.CACert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: previousCA.Raw})...)
+		}
+	}
+
+	return certs, nil
+}
+
+// FromSecret returns the certificates stored in the Secret.
+func FromSecret(secret *corev1.Secret) *Certificates {
+	return &Certificates{
+		CACert: secret.Data[CACertKey],
+		Cert:   secret.Data[corev1.TLSCertKey],
+		Key:    secret.Data[corev1.TLSPrivateKeyKey],
+	}
+}
+
+// ToSecret stores the certificates in the Secret.
+func (c *Certificates) ToSecret(secret *corev1.Secret) {
+	secret.Type = corev1.SecretTypeTLS
+	secret.Data = map[string][]byte{
+		CACertKey:               c.CACert,
+		corev1.TLSCertKey:       c.Cert,
+		corev1.TLSPrivateKeyKey: c.Key,
+	}
+}
+
+// NeedsRotation returns why the certificates should be replaced: because they
+// are invalid, do not cover the DNS names or expire within refreshBefore. It
+// returns an empty string when they are still good.
+func (c *Certificates) NeedsRotation(dnsNames []string, refreshBefore time.Duration, now time.Time) string {
+	caCert, err := c.ca()
+	if err != nil {
+		return err.Error()
+	}
+
+	block, _ := pem.Decode(c.Cert)
+	if block == nil {
+		return "serving certificate is not PEM encoded"
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return fmt.Sprintf("invalid serving certificate: %v", err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(caCert)
+	for _, name := range dnsNames {
+		if _, err := cert.Verify(x509.VerifyOptions{DNSName: name, Roots: roots, CurrentTime: now}); err != nil {
+			return fmt.Sprintf("serving certificate is not valid for %s: %v", name, err)
+		}
+	}
+
+	if expiry := earliest(caCert.NotAfter, cert.NotAfter); now.Add(refreshBefore).After(expiry) {
+		return fmt.Sprintf("certificates expire at %s", expiry.Format(time.RFC3339))
+	}
+
+	return ""
+}
+
+// ca returns the CA certificate signing the serving certificate.
+func (c *Certificates) ca() (*x509.Certificate, error) {
+	block, _ := pem.Decode(c.CACert)
+	if block == nil {
+		return nil, fmt.Errorf("CA certificate is not PEM encoded")
+	}
+	caCert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CA certificate: %v", err)
+	}
+	return caCert, nil
+}
+
+func earliest(first, second time.Time) time.Time {
+	if first.Before(second) {
+		return first
+	}
+	return second
+}
+
+func serialNumber() *big.Int {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		// the time is unique enough for certificates generated a few times a
+		// year
+		return big.NewInt(time.Now().UnixNano())
+	}
+	return serial
+}
+
+func encodeCert(der []byte) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func encodeKey(key *rsa.PrivateKey) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+}
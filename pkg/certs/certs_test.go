@@ -0,0 +1,172 @@
+package certs
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testDNSNames = []string{"webhook-service.system.svc", "webhook-service.system.svc.cluster.local"}
+
+func TestGenerate(t *testing.T) {
+	now := time.Now()
+	validity := 24 * time.Hour
+
+	tests := []struct {
+		name     string
+		previous *Certificates
+		// previousCA is whether the CA of previous is kept in the bundle
+		previousCA bool
+	}{
+		{
+			name: "no previous certificates",
+		},
+		{
+			name:       "previous CA kept",
+			previous:   generate(t, now.Add(-time.Hour), validity, nil),
+			previousCA: true,
+		},
+		{
+			name:     "expired previous CA dropped",
+			previous: generate(t, now.Add(-2*validity), validity, nil),
+		},
+		{
+			name:     "invalid previous CA dropped",
+			previous: &Certificates{CACert: []byte("invalid")},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			certs := generate(t, now, validity, tt.previous)
+
+			if reason := certs.NeedsRotation(testDNSNames, 0, now); reason != "" {
+				t.Errorf("expected valid certificates, got %q", reason)
+			}
+
+			bundle := parseBundle(t, certs.CACert)
+			expected := 1
+			if tt.previousCA {
+				expected = 2
+			}
+			if len(bundle) != expected {
+				t.Fatalf("expected %d CA certificates in the bundle, got %d", expected, len(bundle))
+			}
+			if tt.previousCA && bundle[0].Equal(parseBundle(t, tt.previous.CACert)[0]) {
+				t.Errorf("expected a new CA first in the bundle, got %s", bundle[0].Subject)
+			}
+			if tt.previousCA && !bundle[1].Equal(parseBundle(t, tt.previous.CACert)[0]) {
+				t.Errorf("expected the previous CA in the bundle, got %s", bundle[1].Subject)
+			}
+		})
+	}
+}
+
+func TestNeedsRotation(t *testing.T) {
+	now := time.Now()
+	validity := 24 * time.Hour
+	certs := generate(t, now, validity, nil)
+	other := generate(t, now, validity, nil)
+
+	tests := []struct {
+		name          string
+		certs         *Certificates
+		dnsNames      []string
+		refreshBefore time.Duration
+		now           time.Time
+		reason        string
+	}{
+		{
+			name:          "valid certificates",
+			certs:         certs,
+			dnsNames:      testDNSNames,
+			refreshBefore: validity / 3,
+			now:           now,
+		},
+		{
+			name:          "certificates expiring",
+			certs:         certs,
+			dnsNames:      testDNSNames,
+			refreshBefore: validity / 3,
+			now:           now.Add(validity * 3 / 4),
+			reason:        "certificates expire at",
+		},
+		{
+			name:     "certificates expired",
+			certs:    certs,
+			dnsNames: testDNSNames,
+			now:      now.Add(2 * validity),
+			reason:   "serving certificate is not valid for",
+		},
+		{
+			name:     "other DNS name",
+			certs:    certs,
+			dnsNames: []string{"other-service.system.svc"},
+			now:      now,
+			reason:   "serving certificate is not valid for other-service.system.svc",
+		},
+		{
+			name:     "serving certificate signed by another CA",
+			certs:    &Certificates{CACert: other.CACert, Cert: certs.Cert, Key: certs.Key},
+			dnsNames: testDNSNames,
+			now:      now,
+			reason:   "serving certificate is not valid for",
+		},
+		{
+			name:     "invalid CA",
+			certs:    &Certificates{CACert: []byte("invalid"), Cert: certs.Cert, Key: certs.Key},
+			dnsNames: testDNSNames,
+			now:      now,
+			reason:   "CA certificate is not PEM encoded",
+		},
+		{
+			name:     "no serving certificate",
+			certs:    &Certificates{CACert: certs.CACert},
+			dnsNames: testDNSNames,
+			now:      now,
+			reason:   "serving certificate is not PEM encoded",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reason := tt.certs.NeedsRotation(tt.dnsNames, tt.refreshBefore, tt.now)
+			if tt.reason == "" && reason != "" {
+				t.Errorf("expected no rotation, got %q", reason)
+			}
+			if !strings.HasPrefix(reason, tt.reason) {
+				t.Errorf("expected a rotation because %q, got %q", tt.reason, reason)
+			}
+		})
+	}
+}
+
+func generate(t *testing.T, now time.Time, validity time.Duration, previous *Certificates) *Certificates {
+	t.Helper()
+
+	certs, err := Generate(testDNSNames, validity, now, previous)
+	if err != nil {
+		t.Fatalf("unable to generate certificates: %v", err)
+	}
+	return certs
+}
+
+func parseBundle(t *testing.T, bundle []byte) []*x509.Certificate {
+	t.Helper()
+
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, bundle = pem.Decode(bundle)
+		if block == nil {
+			return certs
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			t.Fatalf("unable to parse CA bundle: %v", err)
+		}
+		certs = append(certs, cert)
+	}
+}
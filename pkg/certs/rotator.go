@@ -0,0 +1,322 @@
+package certs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/go-logr/logr"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+const (
+	// DefaultValidity is the validity of the generated certificates when the
+	// Rotator does not set one.
+	DefaultValidity = 365 * 24 * time.Hour
+
+	defaultCheckInterval = 10 * time.Minute
+	defaultSyncInterval  = time.Minute
+)
+
+// The Secret is read and written through the Role of config/rbac/certs_role.yaml,
+// restricted to the namespace of the webhook.
+// +kubebuilder:rbac:groups=admissionregistration.k8s.io,resources=mutatingwebhookconfigurations;validatingwebhookconfigurations,verbs=get;patch
+
+// Rotator keeps the serving certificate of the webhook in a Secret, rotates
+// it before it expires and injects its CA into the webhook configurations.
+// The leader rotates the certificates while every replica writes them to the
+// certificate directory of its webhook server, which reloads them.
+type Rotator struct {
+	// Client writes the Secret and the webhook configurations.
+	Client client.Client
+
+	// Reader reads the Secret and the webhook configurations. It should not
+	// be backed by a cache, so that Secrets are not cached cluster wide.
+	Reader client.Reader
+
+	// Secret is the name of the Secret holding the certificates.
+	Secret types.NamespacedName
+
+	// DNSNames are the names the serving certificate is valid for.
+	DNSNames []string
+
+	// CertDir, CertName and KeyName locate the files the webhook server
+	// reads the serving certificate and key from.
+	CertDir  string
+	CertName string
+	KeyName  string
+
+	// MutatingWebhookConfigurations and ValidatingWebhookConfigurations are
+	// the names of the webhook configurations whose caBundle is injected.
+	MutatingWebhookConfigurations   []string
+	ValidatingWebhookConfigurations []string
+
+	// Validity of the generated certificates. Defaults to DefaultValidity.
+	Validity time.Duration
+
+	// RefreshBefore is how long before they expire certificates are rotated.
+	// Defaults to a third of the Validity.
+	RefreshBefore time.Duration
+
+	Log logr.Logger
+}
+
+// Bootstrap creates the Secret when it does not exist yet and writes the
+// certificates it holds to the certificate directory, so that the webhook
+// server can start. Existing certificates are not rotated, which is left to
+// the leader.
+func (r *Rotator) Bootstrap(ctx context.Context) error {
+	secret := &corev1.Secret{}
+	err := r.Reader.Get(ctx, r.Secret, secret)
+	if apierrors.IsNotFound(err) {
+		err = r.createSecret(ctx, secret)
+	}
+	if err != nil {
+		return fmt.Errorf("unable to get secret %s: %v", r.Secret, err)
+	}
+
+	return r.writeFiles(FromSecret(secret))
+}
+
+// createSecret creates the Secret with new certificates, or reads it when
+// another replica created it first.
+func (r *Rotator) createSecret(ctx context.Context, secret *corev1.Secret) error {
+	certs, err := r.generate(nil)
+	if err != nil {
+		return err
+	}
+
+	secret.Name = r.Secret.Name
+	secret.Namespace = r.Secret.Namespace
+	certs.ToSecret(secret)
+	if err := r.Client.Create(ctx, secret); err != nil {
+		if apierrors.IsAlreadyExists(err) {
+			return r.Reader.Get(ctx, r.Secret, secret)
+		}
+		return err
+	}
+
+	r.Log.Info("generated certificates", "secret", r.Secret)
+	return nil
+}
+
+// AddToManager adds the rotation of the certificates, run by the leader, and
+// the synchronization of the certificate files, run by every replica, to the
+// Manager.
+func (r *Rotator) AddToManager(mgr manager.Manager) error {
+	if err := mgr.Add(&rotation{r}); err != nil {
+		return err
+	}
+	return mgr.Add(&synchronization{r})
+}
+
+// rotation rotates the certificates and injects the CA into the webhook
+// configurations on the leader.
+type rotation struct {
+	*Rotator
+}
+
+// Start implements manager.Runnable.
+func (r *rotation) Start(ctx context.Context) error {
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		if err := r.rotate(ctx); err != nil {
+			r.Log.Error(err, "unable to rotate certificates")
+		}
+	}, defaultCheckInterval)
+	return nil
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable, so that
+// replicas do not rotate the certificates concurrently.
+func (r *rotation) NeedLeaderElection() bool {
+	return true
+}
+
+// synchronization writes the certificates of the Secret to the certificate
+// directory on every replica.
+type synchronization struct {
+	*Rotator
+}
+
+// Start implements manager.Runnable.
+func (s *synchronization) Start(ctx context.Context) error {
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		secret := &corev1.Secret{}
+		if err := s.Reader.Get(ctx, s.Secret, secret); err != nil {
+			s.Log.Error(err, "unable to get secret", "secret", s.Secret)
+			return
+		}
+		if err := s.writeFiles(FromSecret(secret)); err != nil {
+			s.Log.Error(err, "unable to write certificates")
+		}
+	}, defaultSyncInterval)
+	return nil
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable.
+func (s *synchronization) NeedLeaderElection() bool {
+	return false
+}
+
+// rotate replaces the certificates of the Secret when they need to be rotated
+// and injects the CA bundle into the webhook configurations.
+func (r *Rotator) rotate(ctx context.Context) error {
+	secret := &corev1.Secret{}
+	err := r.Reader.Get(ctx, r.Secret, secret)
+	if apierrors.IsNotFound(err) {
+		err = r.createSecret(ctx, secret)
+	}
+	if err != nil {
+		return fmt.Errorf("unable to get secret %s: %v", r.Secret, err)
+	}
+
+	certs := FromSecret(secret)
+	reason := certs.NeedsRotation(r.DNSNames, r.refreshBefore(), time.Now())
+	if reason == "" {
+		return r.injectCABundle(ctx, certs.CACert)
+	}
+
+	rotated, err := r.generate(certs)
+	if err != nil {
+		return err
+	}
+
+	// the new CA is trusted before any replica serves a certificate signed by
+	// it, the previous CA remains trusted until every replica reloaded
+	if err := r.injectCABundle(ctx, rotated.CACert); err != nil {
+		return err
+	}
+
+	rotated.ToSecret(secret)
+	// the update fails on a conflict when the Secret changed since it was
+	// read, such as by a previous leader
+	if err := r.Client.Update(ctx, secret); err != nil {
+		return fmt.Errorf("unable to update secret %s: %v", r.Secret, err)
+	}
+	r.Log.Info("rotated certificates", "secret", r.Secret, "reason", reason)
+	return nil
+}
+
+// injectCABundle sets the CA bundle of every webhook of the webhook
+// configurations.
+func (r *Rotator) injectCABundle(ctx context.Context, caBundle []byte) error {
+	for _, name := range r.MutatingWebhookConfigurations {
+		if err := r.injectMutatingCABundle(ctx, name, caBundle); err != nil {
+			return err
+		}
+	}
+	for _, name := range r.ValidatingWebhookConfigurations {
+		if err := r.injectValidatingCABundle(ctx, name, caBundle); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Rotator) injectMutatingCABundle(ctx context.Context, name string, caBundle []byte) error {
+	config := &admissionregistrationv1.MutatingWebhookConfiguration{}
+	if err := r.Reader.Get(ctx, client.ObjectKey{Name: name}, config); err != nil {
+		return fmt.Errorf("unable to get mutating webhook configuration %s: %v", name, err)
+	}
+
+	patch := client.MergeFrom(config.DeepCopy())
+	changed := false
+	for i := range config.Webhooks {
+		if !bytes.Equal(config.Webhooks[i].ClientConfig.CABundle, caBundle) {
+			config.Webhooks[i].ClientConfig.CABundle = caBundle
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+
+	if err := r.Client.Patch(ctx, config, patch); err != nil {
+		return fmt.Errorf("unable to inject CA bundle into mutating webhook configuration %s: %v", name, err)
+	}
+	r.Log.Info("injected CA bundle", "mutatingwebhookconfiguration", name)
+	return nil
+}
+
+func (r *Rotator) injectValidatingCABundle(ctx context.Context, name string, caBundle []byte) error {
+	config := &admissionregistrationv1.ValidatingWebhookConfiguration{}
+	if err := r.Reader.Get(ctx, client.ObjectKey{Name: name}, config); err != nil {
+		return fmt.Errorf("unable to get validating webhook configuration %s: %v", name, err)
+	}
+
+	patch := client.MergeFrom(config.DeepCopy())
+	changed := false
+	for i := range config.Webhooks {
+		if !bytes.Equal(config.Webhooks[i].ClientConfig.CABundle, caBundle) {
+			config.Webhooks[i].ClientConfig.CABundle = caBundle
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+
+	if err := r.Client.Patch(ctx, config, patch); err != nil {
+		return fmt.Errorf("unable to inject CA bundle into validating webhook configuration %s: %v", name, err)
+	}
+	r.Log.Info("injected CA bundle", "validatingwebhookconfiguration", name)
+	return nil
+}
+
+// writeFiles writes the serving certificate and key to the certificate
+// directory when they changed. The webhook server watches the files and
+// reloads them without restarting.
+func (r *Rotator) writeFiles(certs *Certificates) error {
+	if len(certs.Cert) == 0 || len(certs.Key) == 0 {
+		return fmt.Errorf("secret %s holds no certificate", r.Secret)
+	}
+
+	if err := os.MkdirAll(r.CertDir, 0700); err != nil {
+		return err
+	}
+
+	certPath := filepath.Join(r.CertDir, r.CertName)
+	keyPath := filepath.Join(r.CertDir, r.KeyName)
+	if current, err := ioutil.ReadFile(certPath); err == nil && bytes.Equal(current, certs.Cert) {
+		return nil
+	}
+
+	// the key is written first, the webhook server keeps serving the previous
+	// certificate until both files match
+	if err := ioutil.WriteFile(keyPath, certs.Key, 0600); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(certPath, certs.Cert, 0600); err != nil {
+		return err
+	}
+	r.Log.Info("wrote certificates", "dir", r.CertDir)
+	return nil
+}
+
+func (r *Rotator) generate(previous *Certificates) (*Certificates, error) {
+	return Generate(r.DNSNames, r.validity(), time.Now(), previous)
+}
+
+func (r *Rotator) validity() time.Duration {
+	if r.Validity == 0 {
+		return DefaultValidity
+	}
+	return r.Validity
+}
+
+func (r *Rotator) refreshBefore() time.Duration {
+	if r.RefreshBefore == 0 {
+		return r.validity() / 3
+	}
+	return r.RefreshBefore
+}
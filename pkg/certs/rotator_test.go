@@ -0,0 +1,197 @@
+package certs
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var testSecret = types.NamespacedName{Namespace: "system", Name: "webhook-server-cert"}
+
+func TestRotatorRotate(t *testing.T) {
+	now := time.Now()
+	valid := generate(t, now, DefaultValidity, nil)
+	expiring := generate(t, now.Add(-DefaultValidity*3/4), DefaultValidity, nil)
+
+	tests := []struct {
+		name  string
+		certs *Certificates
+		// rotated is whether the certificates of the Secret are replaced
+		rotated bool
+		// bundle is the number of CA certificates in the injected bundle
+		bundle int
+	}{
+		{
+			name:    "missing secret",
+			rotated: true,
+			bundle:  1,
+		},
+		{
+			name:   "valid certificates",
+			certs:  valid,
+			bundle: 1,
+		},
+		{
+			name:    "expiring certificates",
+			certs:   expiring,
+			rotated: true,
+			bundle:  2,
+		},
+		{
+			name:    "invalid certificates",
+			certs:   &Certificates{CACert: []byte("invalid")},
+			rotated: true,
+			bundle:  1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var objs []runtime.Object
+			if tt.certs != nil {
+				objs = append(objs, newSecret(tt.certs))
+			}
+			r, c := newTestRotator(t, objs...)
+
+			if err := r.rotate(context.TODO()); err != nil {
+				t.Fatalf("unable to rotate certificates: %v", err)
+			}
+
+			secret := &corev1.Secret{}
+			if err := c.Get(context.TODO(), testSecret, secret); err != nil {
+				t.Fatalf("unable to get secret: %v", err)
+			}
+			certs := FromSecret(secret)
+			if reason := certs.NeedsRotation(testDNSNames, r.refreshBefore(), now); reason != "" {
+				t.Errorf("expected valid certificates, got %q", reason)
+			}
+			if rotated := tt.certs == nil || !bytes.Equal(certs.Cert, tt.certs.Cert); rotated != tt.rotated {
+				t.Errorf("expected rotated to be %t", tt.rotated)
+			}
+			if bundle := parseBundle(t, certs.CACert); len(bundle) != tt.bundle {
+				t.Errorf("expected %d CA certificates in the bundle, got %d", tt.bundle, len(bundle))
+			}
+
+			mutating := &admissionregistrationv1.MutatingWebhookConfiguration{}
+			if err := c.Get(context.TODO(), client.ObjectKey{Name: "mutating-webhook-configuration"}, mutating); err != nil {
+				t.Fatalf("unable to get mutating webhook configuration: %v", err)
+			}
+			for _, webhook := range mutating.Webhooks {
+				if !bytes.Equal(webhook.ClientConfig.CABundle, certs.CACert) {
+					t.Errorf("expected the CA bundle of the secret injected into %s", webhook.Name)
+				}
+			}
+			validating := &admissionregistrationv1.ValidatingWebhookConfiguration{}
+			if err := c.Get(context.TODO(), client.ObjectKey{Name: "validating-webhook-configuration"}, validating); err != nil {
+				t.Fatalf("unable to get validating webhook configuration: %v", err)
+			}
+			for _, webhook := range validating.Webhooks {
+				if !bytes.Equal(webhook.ClientConfig.CABundle, certs.CACert) {
+					t.Errorf("expected the CA bundle of the secret injected into %s", webhook.Name)
+				}
+			}
+		})
+	}
+}
+
+func TestRotatorWriteFiles(t *testing.T) {
+	now := time.Now()
+	r, c := newTestRotator(t, newSecret(generate(t, now, DefaultValidity, nil)))
+
+	if err := r.Bootstrap(context.TODO()); err != nil {
+		t.Fatalf("unable to bootstrap certificates: %v", err)
+	}
+	secret := &corev1.Secret{}
+	if err := c.Get(context.TODO(), testSecret, secret); err != nil {
+		t.Fatalf("unable to get secret: %v", err)
+	}
+	expectFiles(t, r, FromSecret(secret))
+
+	// the files follow the certificates of the Secret
+	rotated := generate(t, now, DefaultValidity, FromSecret(secret))
+	if err := r.writeFiles(rotated); err != nil {
+		t.Fatalf("unable to write certificates: %v", err)
+	}
+	expectFiles(t, r, rotated)
+
+	if err := r.writeFiles(&Certificates{CACert: rotated.CACert}); err == nil {
+		t.Errorf("expected an error writing no certificate")
+	}
+	expectFiles(t, r, rotated)
+}
+
+func expectFiles(t *testing.T, r *Rotator, certs *Certificates) {
+	t.Helper()
+
+	cert, err := ioutil.ReadFile(filepath.Join(r.CertDir, r.CertName))
+	if err != nil {
+		t.Fatalf("unable to read certificate: %v", err)
+	}
+	key, err := ioutil.ReadFile(filepath.Join(r.CertDir, r.KeyName))
+	if err != nil {
+		t.Fatalf("unable to read key: %v", err)
+	}
+	if !bytes.Equal(cert, certs.Cert) || !bytes.Equal(key, certs.Key) {
+		t.Errorf("expected the certificates of the secret written")
+	}
+}
+
+func newSecret(certs *Certificates) *corev1.Secret {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: testSecret.Namespace, Name: testSecret.Name},
+	}
+	certs.ToSecret(secret)
+	return secret
+}
+
+func newTestRotator(t *testing.T, objs ...runtime.Object) (*Rotator, client.Client) {
+	t.Helper()
+
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatalf("unable to add client-go types to scheme: %v", err)
+	}
+
+	objs = append(objs,
+		&admissionregistrationv1.MutatingWebhookConfiguration{
+			ObjectMeta: metav1.ObjectMeta{Name: "mutating-webhook-configuration"},
+			Webhooks: []admissionregistrationv1.MutatingWebhook{
+				{Name: "mpodpreset.redhatcop.redhat.io"},
+				{Name: "mworkload.redhatcop.redhat.io"},
+			},
+		},
+		&admissionregistrationv1.ValidatingWebhookConfiguration{
+			ObjectMeta: metav1.ObjectMeta{Name: "validating-webhook-configuration"},
+			Webhooks: []admissionregistrationv1.ValidatingWebhook{
+				{Name: "vpodpreset.redhatcop.redhat.io"},
+			},
+		},
+	)
+	c := fake.NewClientBuilder().WithScheme(scheme).WithRuntimeObjects(objs...).Build()
+
+	return &Rotator{
+		Client:                          c,
+		Reader:                          c,
+		Secret:                          testSecret,
+		DNSNames:                        testDNSNames,
+		CertDir:                         t.TempDir(),
+		CertName:                        "tls.crt",
+		KeyName:                         "tls.key",
+		MutatingWebhookConfigurations:   []string{"mutating-webhook-configuration"},
+		ValidatingWebhookConfigurations: []string{"validating-webhook-configuration"},
+		Log:                             logr.Discard(),
+	}, c
+}
@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	redhatcopv1alpha1 "github.com/redhat-cop/podpreset-webhook/api/v1alpha1"
+	"github.com/redhat-cop/podpreset-webhook/pkg/podpreset"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Keys of the audit annotations added to admission responses. The API server
+// prefixes them with the name of the webhook.
+const (
+	auditAnnotationAppliedPresets = "applied-presets"
+	auditAnnotationConflicts      = "conflicts"
+	auditAnnotationSecretRefs     = "injected-secret-refs"
+	auditAnnotationOptedOut       = "opted-out"
+)
+
+// appliedWarnings returns an admission response warning for each applied
+// PodPreset.
+func appliedWarnings(podPresets []*redhatcopv1alpha1.PodPreset) []string {
+	warnings := make([]string, len(podPresets))
+	for i, pp := range podPresets {
+		warnings[i] = fmt.Sprintf("%s %s applied", podpreset.Kind(pp), pp.GetName())
+	}
+	return warnings
+}
+
+// auditAnnotations returns the audit annotations describing the applied
+// PodPresets, the conflicts and the secrets referenced by the applied
+// PodPresets.
+func auditAnnotations(podPresets []*redhatcopv1alpha1.PodPreset, conflicts []*podpreset.Conflict) map[string]string {
+	annotations := map[string]string{}
+
+	var applied, secretRefs []string
+	for _, pp := range podPresets {
+		name := fmt.Sprintf("%s/%s", podpreset.Kind(pp), pp.GetName())
+		applied = append(applied, name)
+		for _, secret := range secretReferences(&pp.Spec) {
+			secretRefs = append(secretRefs, fmt.Sprintf("%s:%s", name, secret))
+		}
+	}
+	if len(applied) > 0 {
+		annotations[auditAnnotationAppliedPresets] = strings.Join(applied, ",")
+	}
+	if len(secretRefs) > 0 {
+		annotations[auditAnnotationSecretRefs] = strings.Join(secretRefs, ",")
+	}
+	if len(conflicts) > 0 {
+		annotations[auditAnnotationConflicts] = strings.Join(podpreset.DescribeConflicts(conflicts), "; ")
+	}
+
+	return annotations
+}
+
+// secretReferences returns the sorted names of the secrets referenced by the
+// data a PodPreset injects.
+func secretReferences(spec *redhatcopv1alpha1.PodPresetSpec) []string {
+	secrets := map[string]bool{}
+
+	addEnv := func(env []corev1.EnvVar, envFrom []corev1.EnvFromSource) {
+		for _, e := range env {
+			if e.ValueFrom != nil && e.ValueFrom.SecretKeyRef != nil {
+				secrets[e.ValueFrom.SecretKeyRef.Name] = true
+			}
+		}
+		for _, e := range envFrom {
+			if e.SecretRef != nil {
+				secrets[e.SecretRef.Name] = true
+			}
+		}
+	}
+
+	addEnv(spec.Env, spec.EnvFrom)
+	for _, c := range spec.Containers {
+		addEnv(c.Env, c.EnvFrom)
+	}
+	for _, c := range spec.InitContainers {
+		addEnv(c.Env, c.EnvFrom)
+	}
+
+	for _, v := range spec.Volumes {
+		if v.Secret != nil {
+			secrets[v.Secret.SecretName] = true
+		}
+		if v.Projected != nil {
+			for _, source := range v.Projected.Sources {
+				if source.Secret != nil {
+					secrets[source.Secret.Name] = true
+				}
+			}
+		}
+	}
+
+	names := make([]string, 0, len(secrets))
+	for name := range secrets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
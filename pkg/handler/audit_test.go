@@ -0,0 +1,182 @@
+package handler
+
+import (
+	"reflect"
+	"testing"
+
+	redhatcopv1alpha1 "github.com/redhat-cop/podpreset-webhook/api/v1alpha1"
+	"github.com/redhat-cop/podpreset-webhook/pkg/podpreset"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestAppliedWarnings(t *testing.T) {
+	tests := []struct {
+		name       string
+		podPresets []*redhatcopv1alpha1.PodPreset
+		expected   []string
+	}{
+		{
+			name:     "nothing applied",
+			expected: []string{},
+		},
+		{
+			name: "podpresets and clusterpodpresets",
+			podPresets: []*redhatcopv1alpha1.PodPreset{
+				newPodPreset("proxy", nil),
+				podpreset.FromClusterPodPreset(newClusterPodPreset("ca-bundle", nil)),
+			},
+			expected: []string{"PodPreset proxy applied", "ClusterPodPreset ca-bundle applied"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			warnings := appliedWarnings(tt.podPresets)
+			if !reflect.DeepEqual(warnings, tt.expected) {
+				t.Errorf("expected warnings %q, got %q", tt.expected, warnings)
+			}
+		})
+	}
+}
+
+func TestAuditAnnotations(t *testing.T) {
+	credentials := withSpec(newPodPreset("credentials", nil), func(spec *redhatcopv1alpha1.PodPresetSpec) {
+		spec.EnvFrom = []corev1.EnvFromSource{{SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "db"}}}}
+		spec.Volumes = []corev1.Volume{{Name: "tls", VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{SecretName: "tls"}}}}
+	})
+	ignored := &podpreset.Conflict{PodPreset: withConflictPolicy(newPodPreset("other", nil), redhatcopv1alpha1.ConflictPolicyIgnore), Field: "env", Key: "HTTP_PROXY"}
+	rejected := &podpreset.Conflict{PodPreset: withConflictPolicy(newPodPreset("other", nil), redhatcopv1alpha1.ConflictPolicyReject), Field: "env", Key: "HTTP_PROXY"}
+
+	tests := []struct {
+		name       string
+		podPresets []*redhatcopv1alpha1.PodPreset
+		conflicts  []*podpreset.Conflict
+		expected   map[string]string
+	}{
+		{
+			name:     "nothing applied",
+			expected: map[string]string{},
+		},
+		{
+			name: "applied",
+			podPresets: []*redhatcopv1alpha1.PodPreset{
+				newPodPreset("proxy", nil, env("HTTP_PROXY", "proxy")),
+				podpreset.FromClusterPodPreset(newClusterPodPreset("ca-bundle", nil)),
+			},
+			expected: map[string]string{
+				auditAnnotationAppliedPresets: "PodPreset/proxy,ClusterPodPreset/ca-bundle",
+			},
+		},
+		{
+			name:       "secrets referenced",
+			podPresets: []*redhatcopv1alpha1.PodPreset{newPodPreset("proxy", nil), credentials},
+			expected: map[string]string{
+				auditAnnotationAppliedPresets: "PodPreset/proxy,PodPreset/credentials",
+				auditAnnotationSecretRefs:     "PodPreset/credentials:db,PodPreset/credentials:tls",
+			},
+		},
+		{
+			name:       "conflicts",
+			podPresets: []*redhatcopv1alpha1.PodPreset{newPodPreset("proxy", nil)},
+			conflicts:  []*podpreset.Conflict{ignored, ignored},
+			expected: map[string]string{
+				auditAnnotationAppliedPresets: "PodPreset/proxy",
+				auditAnnotationConflicts:      "PodPreset other conflicts on env HTTP_PROXY: existing value kept (Ignore)",
+			},
+		},
+		{
+			// a rejected pod has no PodPreset applied, only the conflicts are
+			// recorded
+			name:      "rejected",
+			conflicts: []*podpreset.Conflict{ignored, rejected},
+			expected: map[string]string{
+				auditAnnotationConflicts: "PodPreset other conflicts on env HTTP_PROXY: existing value kept (Ignore); PodPreset other conflicts on env HTTP_PROXY: pod rejected (Reject)",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			annotations := auditAnnotations(tt.podPresets, tt.conflicts)
+			if !reflect.DeepEqual(annotations, tt.expected) {
+				t.Errorf("expected audit annotations %v, got %v", tt.expected, annotations)
+			}
+		})
+	}
+}
+
+func TestSecretReferences(t *testing.T) {
+	secretKeyRef := func(name, secret string) corev1.EnvVar {
+		return corev1.EnvVar{Name: name, ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: secret}, Key: "value"}}}
+	}
+	secretRef := func(secret string) corev1.EnvFromSource {
+		return corev1.EnvFromSource{SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: secret}}}
+	}
+
+	tests := []struct {
+		name     string
+		spec     redhatcopv1alpha1.PodPresetSpec
+		expected []string
+	}{
+		{
+			name:     "no secret",
+			spec:     redhatcopv1alpha1.PodPresetSpec{Env: []corev1.EnvVar{env("HTTP_PROXY", "proxy")}},
+			expected: []string{},
+		},
+		{
+			name: "env",
+			spec: redhatcopv1alpha1.PodPresetSpec{
+				Env: []corev1.EnvVar{
+					secretKeyRef("PASSWORD", "db"),
+					{Name: "CONFIG", ValueFrom: &corev1.EnvVarSource{ConfigMapKeyRef: &corev1.ConfigMapKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "config"}, Key: "value"}}},
+				},
+				EnvFrom: []corev1.EnvFromSource{
+					secretRef("api"),
+					{ConfigMapRef: &corev1.ConfigMapEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "config"}}},
+				},
+			},
+			expected: []string{"api", "db"},
+		},
+		{
+			name: "containers and init containers",
+			spec: redhatcopv1alpha1.PodPresetSpec{
+				Containers:     []corev1.Container{{Name: "web", Env: []corev1.EnvVar{secretKeyRef("PASSWORD", "web")}}},
+				InitContainers: []corev1.Container{{Name: "migrate", EnvFrom: []corev1.EnvFromSource{secretRef("migrations")}}},
+			},
+			expected: []string{"migrations", "web"},
+		},
+		{
+			name: "volumes",
+			spec: redhatcopv1alpha1.PodPresetSpec{
+				Volumes: []corev1.Volume{
+					{Name: "tls", VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{SecretName: "tls"}}},
+					{Name: "projected", VolumeSource: corev1.VolumeSource{Projected: &corev1.ProjectedVolumeSource{Sources: []corev1.VolumeProjection{
+						{Secret: &corev1.SecretProjection{LocalObjectReference: corev1.LocalObjectReference{Name: "token"}}},
+						{ConfigMap: &corev1.ConfigMapProjection{LocalObjectReference: corev1.LocalObjectReference{Name: "ca"}}},
+					}}}},
+					{Name: "cache", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}},
+				},
+			},
+			expected: []string{"tls", "token"},
+		},
+		{
+			name: "sorted without duplicates",
+			spec: redhatcopv1alpha1.PodPresetSpec{
+				Env:        []corev1.EnvVar{secretKeyRef("PASSWORD", "db"), secretKeyRef("USER", "db")},
+				EnvFrom:    []corev1.EnvFromSource{secretRef("api")},
+				Containers: []corev1.Container{{Name: "web", EnvFrom: []corev1.EnvFromSource{secretRef("db")}}},
+				Volumes:    []corev1.Volume{{Name: "api", VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{SecretName: "api"}}}},
+			},
+			expected: []string{"api", "db"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			secrets := secretReferences(&tt.spec)
+			if !reflect.DeepEqual(secrets, tt.expected) {
+				t.Errorf("expected secrets %q, got %q", tt.expected, secrets)
+			}
+		})
+	}
+}
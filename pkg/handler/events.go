@@ -0,0 +1,117 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	redhatcopv1alpha1 "github.com/redhat-cop/podpreset-webhook/api/v1alpha1"
+	"github.com/redhat-cop/podpreset-webhook/pkg/podpreset"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// Reasons of the Events recorded by the PodPresetMutator.
+const (
+	// EventReasonInjected is the reason of the Events recorded when a
+	// PodPreset is injected into a pod.
+	EventReasonInjected = "Injected"
+
+	// EventReasonConflictDetected is the reason of the Events recorded when a
+	// PodPreset conflicts with a pod.
+	EventReasonConflictDetected = "ConflictDetected"
+)
+
+// +kubebuilder:rbac:groups=apps,resources=replicasets,verbs=get
+
+// recordEvents records Events on the PodPresets involved in the admission of
+// the pod and on the workload owning the pod, as the pod itself does not exist
+// yet.
+func (a *PodPresetMutator) recordEvents(ctx context.Context, namespace string, pod *corev1.Pod, applied []*redhatcopv1alpha1.PodPreset, conflicts []*podpreset.Conflict) {
+	if a.Recorder == nil {
+		return
+	}
+
+	podName := podDisplayName(pod)
+	owner := a.ownerReference(ctx, namespace, pod)
+
+	for _, c := range conflicts {
+		description := podpreset.DescribeConflict(c)
+		a.Recorder.Eventf(podPresetReference(c.PodPreset), corev1.EventTypeWarning, EventReasonConflictDetected, "%s in pod %s", description, podName)
+		if owner != nil {
+			a.Recorder.Eventf(owner, corev1.EventTypeWarning, EventReasonConflictDetected, "%s in pod %s", description, podName)
+		}
+	}
+
+	if len(applied) == 0 {
+		return
+	}
+
+	names := make([]string, len(applied))
+	for i, pp := range applied {
+		names[i] = fmt.Sprintf("%s %s", podpreset.Kind(pp), pp.GetName())
+		a.Recorder.Eventf(podPresetReference(pp), corev1.EventTypeNormal, EventReasonInjected, "Injected into pod %s", podName)
+	}
+	if owner != nil {
+		a.Recorder.Eventf(owner, corev1.EventTypeNormal, EventReasonInjected, "Injected %s into pod %s", strings.Join(names, ", "), podName)
+	}
+}
+
+// podPresetReference returns a reference to the PodPreset or ClusterPodPreset
+// the given PodPreset originates from.
+func podPresetReference(pp *redhatcopv1alpha1.PodPreset) *corev1.ObjectReference {
+	return &corev1.ObjectReference{
+		APIVersion:      redhatcopv1alpha1.GroupVersion.String(),
+		Kind:            podpreset.Kind(pp),
+		Namespace:       pp.GetNamespace(),
+		Name:            pp.GetName(),
+		UID:             pp.GetUID(),
+		ResourceVersion: pp.GetResourceVersion(),
+	}
+}
+
+// ownerReference returns a reference to the workload controlling the pod in
+// the given namespace.
+// Pods owned by a ReplicaSet are attributed to the Deployment controlling the
+// ReplicaSet, if any, which is read with the APIReader. The ReplicaSet is
+// referenced when it cannot be read.
+func (a *PodPresetMutator) ownerReference(ctx context.Context, namespace string, pod *corev1.Pod) *corev1.ObjectReference {
+	ref := metav1.GetControllerOf(pod)
+	if ref == nil {
+		return nil
+	}
+
+	if ref.APIVersion == appsv1.SchemeGroupVersion.String() && ref.Kind == "ReplicaSet" && a.APIReader != nil {
+		rs := &appsv1.ReplicaSet{}
+		if err := a.APIReader.Get(ctx, client.ObjectKey{Namespace: namespace, Name: ref.Name}, rs); err == nil {
+			if deploymentRef := metav1.GetControllerOf(rs); deploymentRef != nil {
+				ref = deploymentRef
+			}
+		}
+	}
+
+	return &corev1.ObjectReference{
+		APIVersion: ref.APIVersion,
+		Kind:       ref.Kind,
+		Namespace:  namespace,
+		Name:       ref.Name,
+		UID:        ref.UID,
+	}
+}
+
+// podDisplayName returns the name of the pod, or its generated name prefix
+// when the name has not been generated yet.
+func podDisplayName(pod *corev1.Pod) string {
+	if pod.GetName() != "" {
+		return pod.GetName()
+	}
+	return pod.GetGenerateName() + "<generated>"
+}
+
+// isDryRun returns whether the admission request has no side effects.
+func isDryRun(req admission.Request) bool {
+	return req.DryRun != nil && *req.DryRun
+}
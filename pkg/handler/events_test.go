@@ -0,0 +1,161 @@
+package handler
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/go-logr/logr"
+	redhatcopv1alpha1 "github.com/redhat-cop/podpreset-webhook/api/v1alpha1"
+	"github.com/redhat-cop/podpreset-webhook/pkg/podpreset"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestRecordEvents(t *testing.T) {
+	proxy := newPodPreset("proxy", nil)
+	cpp := podpreset.FromClusterPodPreset(&redhatcopv1alpha1.ClusterPodPreset{ObjectMeta: metav1.ObjectMeta{Name: "ca-bundle"}})
+	conflict := &podpreset.Conflict{PodPreset: withConflictPolicy(newPodPreset("other", nil), redhatcopv1alpha1.ConflictPolicyIgnore), Field: "env", Key: "HTTP_PROXY"}
+
+	tests := []struct {
+		name      string
+		pod       *corev1.Pod
+		applied   []*redhatcopv1alpha1.PodPreset
+		conflicts []*podpreset.Conflict
+		expected  []string
+	}{
+		{
+			name: "nothing applied",
+			pod:  newPod(nil),
+		},
+		{
+			name:    "applied",
+			pod:     newPod(nil),
+			applied: []*redhatcopv1alpha1.PodPreset{proxy, cpp},
+			expected: []string{
+				"Normal Injected Injected into pod web-<generated>",
+				"Normal Injected Injected into pod web-<generated>",
+			},
+		},
+		{
+			name:    "applied with owner",
+			pod:     withOwner(newPod(nil), "StatefulSet", "web"),
+			applied: []*redhatcopv1alpha1.PodPreset{proxy, cpp},
+			expected: []string{
+				"Normal Injected Injected into pod web-<generated>",
+				"Normal Injected Injected into pod web-<generated>",
+				"Normal Injected Injected PodPreset proxy, ClusterPodPreset ca-bundle into pod web-<generated>",
+			},
+		},
+		{
+			name:      "conflict with owner",
+			pod:       withOwner(newPod(nil), "StatefulSet", "web"),
+			applied:   []*redhatcopv1alpha1.PodPreset{proxy},
+			conflicts: []*podpreset.Conflict{conflict},
+			expected: []string{
+				"Warning ConflictDetected PodPreset other conflicts on env HTTP_PROXY: existing value kept (Ignore) in pod web-<generated>",
+				"Warning ConflictDetected PodPreset other conflicts on env HTTP_PROXY: existing value kept (Ignore) in pod web-<generated>",
+				"Normal Injected Injected into pod web-<generated>",
+				"Normal Injected Injected PodPreset proxy into pod web-<generated>",
+			},
+		},
+		{
+			name:      "rejected",
+			pod:       newPod(nil),
+			conflicts: []*podpreset.Conflict{conflict},
+			expected: []string{
+				"Warning ConflictDetected PodPreset other conflicts on env HTTP_PROXY: existing value kept (Ignore) in pod web-<generated>",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := record.NewFakeRecorder(10)
+			mutator := &PodPresetMutator{Recorder: recorder, Log: logr.Discard()}
+
+			mutator.recordEvents(context.TODO(), testNamespace, tt.pod, tt.applied, tt.conflicts)
+
+			close(recorder.Events)
+			var events []string
+			for event := range recorder.Events {
+				events = append(events, event)
+			}
+			if !reflect.DeepEqual(events, tt.expected) {
+				t.Errorf("expected events %q, got %q", tt.expected, events)
+			}
+		})
+	}
+}
+
+func TestRecordEventsWithoutRecorder(t *testing.T) {
+	mutator := &PodPresetMutator{Log: logr.Discard()}
+	// does not panic
+	mutator.recordEvents(context.TODO(), testNamespace, newPod(nil), []*redhatcopv1alpha1.PodPreset{newPodPreset("proxy", nil)}, nil)
+}
+
+func TestOwnerReference(t *testing.T) {
+	controller := true
+	rs := &appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{
+		Name:      "web-5d4f8",
+		Namespace: testNamespace,
+		OwnerReferences: []metav1.OwnerReference{
+			{APIVersion: "apps/v1", Kind: "Deployment", Name: "web", UID: "deployment", Controller: &controller},
+		},
+	}}
+
+	tests := []struct {
+		name      string
+		pod       *corev1.Pod
+		apiReader client.Reader
+		expected  *corev1.ObjectReference
+	}{
+		{
+			name: "no owner",
+			pod:  newPod(nil),
+		},
+		{
+			name:     "statefulset",
+			pod:      withOwner(newPod(nil), "StatefulSet", "web"),
+			expected: &corev1.ObjectReference{APIVersion: "apps/v1", Kind: "StatefulSet", Namespace: testNamespace, Name: "web"},
+		},
+		{
+			name:      "deployment",
+			pod:       withOwner(newPod(nil), "ReplicaSet", "web-5d4f8"),
+			apiReader: newTestReader(t, rs),
+			expected:  &corev1.ObjectReference{APIVersion: "apps/v1", Kind: "Deployment", Namespace: testNamespace, Name: "web", UID: "deployment"},
+		},
+		{
+			name:      "replicaset not found",
+			pod:       withOwner(newPod(nil), "ReplicaSet", "web-5d4f8"),
+			apiReader: newTestReader(t),
+			expected:  &corev1.ObjectReference{APIVersion: "apps/v1", Kind: "ReplicaSet", Namespace: testNamespace, Name: "web-5d4f8"},
+		},
+		{
+			name:     "no api reader",
+			pod:      withOwner(newPod(nil), "ReplicaSet", "web-5d4f8"),
+			expected: &corev1.ObjectReference{APIVersion: "apps/v1", Kind: "ReplicaSet", Namespace: testNamespace, Name: "web-5d4f8"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the cached client must not be used to read the ReplicaSet
+			mutator := &PodPresetMutator{Client: newTestReader(t, rs), APIReader: tt.apiReader, Log: logr.Discard()}
+
+			ref := mutator.ownerReference(context.TODO(), testNamespace, tt.pod)
+			if !reflect.DeepEqual(ref, tt.expected) {
+				t.Errorf("expected reference %v, got %v", tt.expected, ref)
+			}
+		})
+	}
+}
+
+func newTestReader(t *testing.T, objs ...runtime.Object) client.Client {
+	t.Helper()
+	return newMutator(t, objs...).Client
+}
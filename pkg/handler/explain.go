@@ -0,0 +1,245 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-logr/logr"
+	redhatcopv1alpha1 "github.com/redhat-cop/podpreset-webhook/api/v1alpha1"
+	"github.com/redhat-cop/podpreset-webhook/pkg/podpreset"
+	jsonpatch "gomodules.xyz/jsonpatch/v2"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ExplainRequest is the body of a request to the PodPresetExplainer.
+type ExplainRequest struct {
+	// Namespace the pod would be created in. Defaults to the namespace of
+	// the pod.
+	Namespace string `json:"namespace,omitempty"`
+
+	// Labels are added to the labels of the pod, replacing existing ones.
+	Labels map[string]string `json:"labels,omitempty"`
+
+	Pod corev1.Pod `json:"pod"`
+}
+
+// ExplainResponse is the body of a response of the PodPresetExplainer.
+type ExplainResponse struct {
+	*podpreset.Explanation
+
+	// Patch is the JSON patch the mutating webhook would return.
+	Patch []jsonpatch.JsonPatchOperation `json:"patch,omitempty"`
+}
+
+// +kubebuilder:rbac:groups=authentication.k8s.io,resources=tokenreviews,verbs=create
+// +kubebuilder:rbac:groups=authorization.k8s.io,resources=subjectaccessreviews,verbs=create
+
+// PodPresetExplainer explains which PodPresets and ClusterPodPresets would be
+// applied to a pod, without creating the pod or mutating anything. Requests
+// are authenticated by their bearer token and only explain the pods of the
+// namespaces whose PodPresets the user may get, as the explanation discloses
+// the values they inject.
+type PodPresetExplainer struct {
+	Client             client.Client
+	NamespaceSelection podpreset.NamespaceSelection
+	Log                logr.Logger
+}
+
+// ServeHTTP handles POST requests with an ExplainRequest body and replies with
+// an ExplainResponse.
+func (e *PodPresetExplainer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "only POST is supported", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, err := e.authenticate(r)
+	if err != nil {
+		e.Log.Error(err, "unable to authenticate request")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if user == nil {
+		http.Error(w, "a valid bearer token is required", http.StatusUnauthorized)
+		return
+	}
+
+	req := &ExplainRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		http.Error(w, fmt.Sprintf("unable to decode request: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	namespace := explainNamespace(req)
+	allowed, err := e.authorize(r.Context(), user, namespace)
+	if err != nil {
+		e.Log.Error(err, "unable to authorize request", "namespace", namespace)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !allowed {
+		http.Error(w, fmt.Sprintf("user %s cannot get podpresets in namespace %s", user.Username, namespace), http.StatusForbidden)
+		return
+	}
+
+	resp, err := e.explain(r.Context(), req)
+	if err != nil {
+		e.Log.Error(err, "unable to explain podpresets", "namespace", req.Namespace)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		e.Log.Error(err, "unable to write response")
+	}
+}
+
+// authenticate returns the user identified by the bearer token of the
+// request, or nil when the request has no valid token.
+func (e *PodPresetExplainer) authenticate(r *http.Request) (*authenticationv1.UserInfo, error) {
+	fields := strings.Fields(r.Header.Get("Authorization"))
+	if len(fields) != 2 || !strings.EqualFold(fields[0], "Bearer") {
+		return nil, nil
+	}
+
+	review := &authenticationv1.TokenReview{Spec: authenticationv1.TokenReviewSpec{Token: fields[1]}}
+	if err := e.Client.Create(r.Context(), review); err != nil {
+		return nil, fmt.Errorf("Error reviewing token: %v", err)
+	}
+	if !review.Status.Authenticated {
+		return nil, nil
+	}
+	return &review.Status.User, nil
+}
+
+// authorize returns whether the user may get the PodPresets of the namespace.
+func (e *PodPresetExplainer) authorize(ctx context.Context, user *authenticationv1.UserInfo, namespace string) (bool, error) {
+	extra := map[string]authorizationv1.ExtraValue{}
+	for key, values := range user.Extra {
+		extra[key] = authorizationv1.ExtraValue(values)
+	}
+
+	review := &authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			User:   user.Username,
+			UID:    user.UID,
+			Groups: user.Groups,
+			Extra:  extra,
+			ResourceAttributes: &authorizationv1.ResourceAttributes{
+				Namespace: namespace,
+				Verb:      "get",
+				Group:     redhatcopv1alpha1.GroupVersion.Group,
+				Resource:  "podpresets",
+			},
+		},
+	}
+	if err := e.Client.Create(ctx, review); err != nil {
+		return false, fmt.Errorf("Error reviewing access of %s: %v", user.Username, err)
+	}
+	return review.Status.Allowed, nil
+}
+
+// explainNamespace returns the namespace of the pod to explain: the namespace
+// of the request, otherwise the namespace of the pod or default.
+func explainNamespace(req *ExplainRequest) string {
+	if req.Namespace != "" {
+		return req.Namespace
+	}
+	if req.Pod.Namespace != "" {
+		return req.Pod.Namespace
+	}
+	return metav1.NamespaceDefault
+}
+
+func (e *PodPresetExplainer) explain(ctx context.Context, req *ExplainRequest) (*ExplainResponse, error) {
+	pod := &req.Pod
+	namespaceName := explainNamespace(req)
+	pod.Namespace = namespaceName
+
+	for key, value := range req.Labels {
+		if pod.Labels == nil {
+			pod.Labels = map[string]string{}
+		}
+		pod.Labels[key] = value
+	}
+
+	podPresetList, clusterPodPresetList, namespace, err := listPodPresets(ctx, e.Client, namespaceName)
+	if err != nil {
+		return nil, err
+	}
+
+	serviceAccount, err := getServiceAccount(ctx, e.Client, pod)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &ExplainResponse{
+		Explanation: podpreset.Explain(pod, *podPresetList, *clusterPodPresetList, namespace, serviceAccount, e.NamespaceSelection),
+	}
+	if resp.Pod == nil {
+		return resp, nil
+	}
+
+	original, err := json.Marshal(pod)
+	if err != nil {
+		return nil, err
+	}
+	mutated, err := json.Marshal(resp.Pod)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Patch, err = jsonpatch.CreatePatch(original, mutated); err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// listPodPresets returns the PodPresets of the namespace, the ClusterPodPresets
+// and the namespace itself. A namespace which does not exist yet is returned
+// without labels.
+func listPodPresets(ctx context.Context, c client.Client, namespaceName string) (*redhatcopv1alpha1.PodPresetList, *redhatcopv1alpha1.ClusterPodPresetList, *corev1.Namespace, error) {
+	podPresetList := &redhatcopv1alpha1.PodPresetList{}
+	if err := c.List(ctx, podPresetList, &client.ListOptions{Namespace: namespaceName}); err != nil {
+		return nil, nil, nil, fmt.Errorf("Error retrieving list of PodPresets: %v", err)
+	}
+
+	clusterPodPresetList := &redhatcopv1alpha1.ClusterPodPresetList{}
+	if err := c.List(ctx, clusterPodPresetList); err != nil {
+		return nil, nil, nil, fmt.Errorf("Error retrieving list of ClusterPodPresets: %v", err)
+	}
+
+	namespace := &corev1.Namespace{}
+	if err := c.Get(ctx, client.ObjectKey{Name: namespaceName}, namespace); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return nil, nil, nil, fmt.Errorf("Error retrieving namespace %s: %v", namespaceName, err)
+		}
+		namespace.Name = namespaceName
+	}
+
+	return podPresetList, clusterPodPresetList, namespace, nil
+}
+
+// getServiceAccount returns the ServiceAccount the pod runs as, or nil when it
+// does not exist.
+func getServiceAccount(ctx context.Context, c client.Client, pod *corev1.Pod) (*corev1.ServiceAccount, error) {
+	name := podpreset.ServiceAccountName(pod)
+	serviceAccount := &corev1.ServiceAccount{}
+	if err := c.Get(ctx, client.ObjectKey{Namespace: pod.Namespace, Name: name}, serviceAccount); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("Error retrieving service account %s: %v", name, err)
+	}
+	return serviceAccount, nil
+}
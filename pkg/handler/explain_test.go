@@ -0,0 +1,214 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-logr/logr"
+	redhatcopv1alpha1 "github.com/redhat-cop/podpreset-webhook/api/v1alpha1"
+	"github.com/redhat-cop/podpreset-webhook/pkg/podpreset"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// testToken is the bearer token of a user who may get the PodPresets of the
+// test namespace only.
+const testToken = "token"
+
+func TestPodPresetExplainerServeHTTP(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		token      string
+		body       string
+		podPresets []runtime.Object
+		code       int
+		check      func(t *testing.T, resp *ExplainResponse)
+	}{
+		{
+			name:   "applied",
+			method: http.MethodPost,
+			token:  testToken,
+			body:   marshalExplainRequest(t, &ExplainRequest{Pod: *newPod(map[string]string{"app": "web"})}),
+			podPresets: []runtime.Object{
+				newPodPreset("proxy", map[string]string{"app": "web"}, env("HTTP_PROXY", "proxy")),
+				newPodPreset("db", map[string]string{"app": "db"}, env("DB", "db")),
+			},
+			code: http.StatusOK,
+			check: func(t *testing.T, resp *ExplainResponse) {
+				expectExplained(t, resp.Applied, "proxy", "")
+				expectExplained(t, resp.NotApplied, "db", podpreset.ReasonSelectorMismatch)
+				if len(resp.Patch) == 0 {
+					t.Errorf("expected the patch of the webhook")
+				}
+			},
+		},
+		{
+			name:   "labels added to the pod",
+			method: http.MethodPost,
+			token:  testToken,
+			body: marshalExplainRequest(t, &ExplainRequest{
+				Labels: map[string]string{"app": "db"},
+				Pod:    *newPod(map[string]string{"app": "web"}),
+			}),
+			podPresets: []runtime.Object{
+				newPodPreset("proxy", map[string]string{"app": "web"}, env("HTTP_PROXY", "proxy")),
+				newPodPreset("db", map[string]string{"app": "db"}, env("DB", "db")),
+			},
+			code: http.StatusOK,
+			check: func(t *testing.T, resp *ExplainResponse) {
+				expectExplained(t, resp.Applied, "db", "")
+				expectExplained(t, resp.NotApplied, "proxy", podpreset.ReasonSelectorMismatch)
+			},
+		},
+		{
+			name:   "invalid podpreset",
+			method: http.MethodPost,
+			token:  testToken,
+			body:   marshalExplainRequest(t, &ExplainRequest{Pod: *newPod(map[string]string{"app": "web"})}),
+			podPresets: []runtime.Object{
+				withInvalidSelector(newPodPreset("proxy", map[string]string{"app": "web"}, env("HTTP_PROXY", "proxy"))),
+			},
+			code: http.StatusOK,
+			check: func(t *testing.T, resp *ExplainResponse) {
+				expectExplained(t, resp.NotApplied, "proxy", podpreset.ReasonInvalidSelector)
+				if len(resp.Patch) != 0 {
+					t.Errorf("expected no patch, got %v", resp.Patch)
+				}
+			},
+		},
+		{
+			name:   "rejected",
+			method: http.MethodPost,
+			token:  testToken,
+			body:   marshalExplainRequest(t, &ExplainRequest{Pod: *newPod(map[string]string{"app": "web"}, env("HTTP_PROXY", "other"))}),
+			podPresets: []runtime.Object{
+				withConflictPolicy(newPodPreset("proxy", map[string]string{"app": "web"}, env("HTTP_PROXY", "proxy")), redhatcopv1alpha1.ConflictPolicyReject),
+			},
+			code: http.StatusOK,
+			check: func(t *testing.T, resp *ExplainResponse) {
+				expectExplained(t, resp.NotApplied, "proxy", podpreset.ReasonRejected)
+				if resp.Rejected == "" || len(resp.Patch) != 0 {
+					t.Errorf("expected the pod to be rejected without patch, got %v", resp)
+				}
+			},
+		},
+		{
+			name:   "malformed request",
+			method: http.MethodPost,
+			token:  testToken,
+			body:   "{",
+			code:   http.StatusBadRequest,
+		},
+		{
+			name:   "unsupported method",
+			method: http.MethodGet,
+			token:  testToken,
+			code:   http.StatusMethodNotAllowed,
+		},
+		{
+			name:   "no token",
+			method: http.MethodPost,
+			body:   marshalExplainRequest(t, &ExplainRequest{Pod: *newPod(map[string]string{"app": "web"})}),
+			code:   http.StatusUnauthorized,
+		},
+		{
+			name:   "invalid token",
+			method: http.MethodPost,
+			token:  "invalid",
+			body:   marshalExplainRequest(t, &ExplainRequest{Pod: *newPod(map[string]string{"app": "web"})}),
+			code:   http.StatusUnauthorized,
+		},
+		{
+			name:   "namespace forbidden",
+			method: http.MethodPost,
+			token:  testToken,
+			body:   marshalExplainRequest(t, &ExplainRequest{Namespace: "kube-system", Pod: *newPod(map[string]string{"app": "web"})}),
+			code:   http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			explainer := &PodPresetExplainer{
+				Client: &reviewingClient{Client: newMutator(t, tt.podPresets...).Client},
+				Log:    logr.Discard(),
+			}
+			recorder := httptest.NewRecorder()
+			req := httptest.NewRequest(tt.method, "/explain", bytes.NewBufferString(tt.body))
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+
+			explainer.ServeHTTP(recorder, req)
+
+			if recorder.Code != tt.code {
+				t.Fatalf("expected code %d, got %d: %s", tt.code, recorder.Code, recorder.Body)
+			}
+			if tt.check == nil {
+				return
+			}
+			resp := &ExplainResponse{}
+			if err := json.NewDecoder(recorder.Body).Decode(resp); err != nil {
+				t.Fatal(err)
+			}
+			tt.check(t, resp)
+		})
+	}
+}
+
+func marshalExplainRequest(t *testing.T, req *ExplainRequest) string {
+	t.Helper()
+
+	raw, err := json.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(raw)
+}
+
+// expectExplained checks the explanations hold the PodPreset with the given
+// name and reason.
+func expectExplained(t *testing.T, explanations []podpreset.PresetExplanation, name, reason string) {
+	t.Helper()
+
+	for _, e := range explanations {
+		if e.Name == name {
+			if e.Reason != reason {
+				t.Errorf("expected podpreset %s to be explained by %q, got %q", name, reason, e.Reason)
+			}
+			return
+		}
+	}
+	t.Errorf("expected podpreset %s in %v", name, explanations)
+}
+
+// reviewingClient answers TokenReviews and SubjectAccessReviews like the API
+// server would for testToken.
+type reviewingClient struct {
+	client.Client
+}
+
+func (c *reviewingClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	switch review := obj.(type) {
+	case *authenticationv1.TokenReview:
+		if review.Spec.Token == testToken {
+			review.Status.Authenticated = true
+			review.Status.User = authenticationv1.UserInfo{Username: "developer"}
+		}
+		return nil
+	case *authorizationv1.SubjectAccessReview:
+		attributes := review.Spec.ResourceAttributes
+		review.Status.Allowed = review.Spec.User == "developer" && attributes.Namespace == testNamespace &&
+			attributes.Verb == "get" && attributes.Group == redhatcopv1alpha1.GroupVersion.Group && attributes.Resource == "podpresets"
+		return nil
+	}
+	return c.Client.Create(ctx, obj, opts...)
+}
@@ -0,0 +1,818 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	redhatcopv1alpha1 "github.com/redhat-cop/podpreset-webhook/api/v1alpha1"
+	"github.com/redhat-cop/podpreset-webhook/pkg/metrics"
+	"github.com/redhat-cop/podpreset-webhook/pkg/podpreset"
+	jsonpatch "gomodules.xyz/jsonpatch/v2"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+const testNamespace = "default"
+
+func TestPodPresetMutatorHandle(t *testing.T) {
+	tests := []struct {
+		name       string
+		pod        *corev1.Pod
+		podPresets []runtime.Object
+		allowed    bool
+		code       int32
+		patched    bool
+		check      func(t *testing.T, pod *corev1.Pod)
+	}{
+		{
+			name:    "no podpreset",
+			pod:     newPod(map[string]string{"app": "web"}),
+			allowed: true,
+		},
+		{
+			name:       "no matching podpreset",
+			pod:        newPod(map[string]string{"app": "web"}),
+			podPresets: []runtime.Object{newPodPreset("db", map[string]string{"app": "db"}, env("DB", "db"))},
+			allowed:    true,
+		},
+		{
+			name: "multiple matching podpresets",
+			pod:  newPod(map[string]string{"app": "web", "tier": "front"}),
+			podPresets: []runtime.Object{
+				newPodPreset("proxy", map[string]string{"app": "web"}, env("HTTP_PROXY", "proxy")),
+				newPodPreset("tracing", map[string]string{"tier": "front"}, env("TRACING", "enabled")),
+				newPodPreset("db", map[string]string{"app": "db"}, env("DB", "db")),
+			},
+			allowed: true,
+			patched: true,
+			check: func(t *testing.T, pod *corev1.Pod) {
+				expectEnv(t, pod.Spec.Containers[0], env("HTTP_PROXY", "proxy"), env("TRACING", "enabled"))
+				expectAnnotations(t, pod, "podpreset-proxy", "injected-proxy", "podpreset-tracing", "injected-tracing")
+			},
+		},
+		{
+			name: "multiple matching podpresets applied by priority",
+			pod:  newPod(map[string]string{"app": "web"}),
+			podPresets: []runtime.Object{
+				withPriority(newPodPreset("b", map[string]string{"app": "web"}, env("B", "b")), 0),
+				withPriority(newPodPreset("a", map[string]string{"app": "web"}, env("A", "a")), 10),
+				withPriority(newPodPreset("c", map[string]string{"app": "web"}, env("C", "c")), -10),
+			},
+			allowed: true,
+			patched: true,
+			check: func(t *testing.T, pod *corev1.Pod) {
+				expectEnv(t, pod.Spec.Containers[0], env("C", "c"), env("B", "b"), env("A", "a"))
+			},
+		},
+		{
+			name: "conflict ignored",
+			pod:  newPod(map[string]string{"app": "web"}, env("LOG_LEVEL", "debug")),
+			podPresets: []runtime.Object{
+				newPodPreset("logging", map[string]string{"app": "web"}, env("LOG_LEVEL", "info"), env("LOG_FORMAT", "json")),
+			},
+			allowed: true,
+			patched: true,
+			check: func(t *testing.T, pod *corev1.Pod) {
+				expectEnv(t, pod.Spec.Containers[0], env("LOG_LEVEL", "debug"), env("LOG_FORMAT", "json"))
+				expectAnnotations(t, pod, "podpreset-logging", "injected-logging", "conflict-logging")
+			},
+		},
+		{
+			name: "conflict overridden",
+			pod:  newPod(map[string]string{"app": "web"}, env("LOG_LEVEL", "debug")),
+			podPresets: []runtime.Object{
+				withConflictPolicy(newPodPreset("logging", map[string]string{"app": "web"}, env("LOG_LEVEL", "info")), redhatcopv1alpha1.ConflictPolicyOverride),
+			},
+			allowed: true,
+			patched: true,
+			check: func(t *testing.T, pod *corev1.Pod) {
+				expectEnv(t, pod.Spec.Containers[0], env("LOG_LEVEL", "info"))
+			},
+		},
+		{
+			name: "conflict skips podpreset",
+			pod:  newPod(map[string]string{"app": "web"}, env("LOG_LEVEL", "debug")),
+			podPresets: []runtime.Object{
+				withConflictPolicy(newPodPreset("logging", map[string]string{"app": "web"}, env("LOG_LEVEL", "info"), env("LOG_FORMAT", "json")), redhatcopv1alpha1.ConflictPolicySkipPreset),
+				newPodPreset("proxy", map[string]string{"app": "web"}, env("HTTP_PROXY", "proxy")),
+			},
+			allowed: true,
+			patched: true,
+			check: func(t *testing.T, pod *corev1.Pod) {
+				expectEnv(t, pod.Spec.Containers[0], env("LOG_LEVEL", "debug"), env("HTTP_PROXY", "proxy"))
+				expectAnnotations(t, pod, "podpreset-proxy", "injected-proxy", "conflict-logging")
+				if _, ok := pod.Annotations[podpreset.AnnotationKey(newPodPreset("logging", nil))]; ok {
+					t.Errorf("skipped podpreset logging recorded as applied")
+				}
+			},
+		},
+		{
+			name: "conflict rejects pod",
+			pod:  newPod(map[string]string{"app": "web"}, env("LOG_LEVEL", "debug")),
+			podPresets: []runtime.Object{
+				withConflictPolicy(newPodPreset("logging", map[string]string{"app": "web"}, env("LOG_LEVEL", "info")), redhatcopv1alpha1.ConflictPolicyReject),
+			},
+			allowed: false,
+			code:    http.StatusForbidden,
+		},
+		{
+			name: "conflict between podpresets",
+			pod:  newPod(map[string]string{"app": "web"}),
+			podPresets: []runtime.Object{
+				newPodPreset("a", map[string]string{"app": "web"}, env("REGION", "eu")),
+				newPodPreset("b", map[string]string{"app": "web"}, env("REGION", "us")),
+			},
+			allowed: true,
+			patched: true,
+			check: func(t *testing.T, pod *corev1.Pod) {
+				expectEnv(t, pod.Spec.Containers[0], env("REGION", "eu"))
+				expectAnnotations(t, pod, "podpreset-a", "injected-a", "podpreset-b", "conflict-b")
+			},
+		},
+		{
+			name: "init containers",
+			pod:  withPodInitContainers(newPod(map[string]string{"app": "web"}), "migrate"),
+			podPresets: []runtime.Object{
+				withInitContainers(newPodPreset("wait", map[string]string{"app": "web"}), redhatcopv1alpha1.InitContainersOrderBefore, "wait-for-db"),
+				withInitContainers(newPodPreset("warmup", map[string]string{"app": "web"}), redhatcopv1alpha1.InitContainersOrderAfter, "warmup"),
+			},
+			allowed: true,
+			patched: true,
+			check: func(t *testing.T, pod *corev1.Pod) {
+				expectInitContainers(t, pod, "wait-for-db", "migrate", "warmup")
+			},
+		},
+		{
+			name: "init containers receive container level data",
+			pod:  withPodInitContainers(newPod(map[string]string{"app": "web"}), "migrate"),
+			podPresets: []runtime.Object{
+				newPodPreset("proxy", map[string]string{"app": "web"}, env("HTTP_PROXY", "proxy")),
+			},
+			allowed: true,
+			patched: true,
+			check: func(t *testing.T, pod *corev1.Pod) {
+				expectEnv(t, pod.Spec.InitContainers[0], env("HTTP_PROXY", "proxy"))
+			},
+		},
+		{
+			name: "image selector selects containers",
+			pod:  withPodInitContainers(newPod(map[string]string{"app": "web"}), "migrate"),
+			podPresets: []runtime.Object{
+				withImageSelector(newPodPreset("proxy", map[string]string{"app": "web"}, env("HTTP_PROXY", "proxy")), redhatcopv1alpha1.ImageSelector{Patterns: []string{"w*"}}),
+			},
+			allowed: true,
+			patched: true,
+			check: func(t *testing.T, pod *corev1.Pod) {
+				expectEnv(t, pod.Spec.Containers[0], env("HTTP_PROXY", "proxy"))
+				expectEnv(t, pod.Spec.InitContainers[0])
+			},
+		},
+		{
+			name: "image selector mismatch",
+			pod:  newPod(map[string]string{"app": "web"}),
+			podPresets: []runtime.Object{
+				withImageSelector(newPodPreset("truststore", map[string]string{"app": "web"}, env("JAVA_TOOL_OPTIONS", "truststore")), redhatcopv1alpha1.ImageSelector{Regexps: []string{"registry.corp/java-.*"}}),
+			},
+			allowed: true,
+		},
+		{
+			name: "owner selector selects deployment pods",
+			pod:  withOwner(newPod(map[string]string{"app": "web", "pod-template-hash": "5d8f7b9c4"}), "ReplicaSet", "web-5d8f7b9c4"),
+			podPresets: []runtime.Object{
+				withOwnerSelector(newPodPreset("proxy", map[string]string{"app": "web"}, env("HTTP_PROXY", "proxy")), redhatcopv1alpha1.OwnerSelector{
+					Include: []redhatcopv1alpha1.WorkloadSelector{{Kind: "Deployment", Name: "web"}},
+				}),
+			},
+			allowed: true,
+			patched: true,
+			check: func(t *testing.T, pod *corev1.Pod) {
+				expectEnv(t, pod.Spec.Containers[0], env("HTTP_PROXY", "proxy"))
+			},
+		},
+		{
+			name: "owner selector excludes daemonset pods",
+			pod:  withOwner(newPod(map[string]string{"app": "web"}), "DaemonSet", "web"),
+			podPresets: []runtime.Object{
+				withOwnerSelector(newPodPreset("proxy", map[string]string{"app": "web"}, env("HTTP_PROXY", "proxy")), redhatcopv1alpha1.OwnerSelector{
+					Exclude: []redhatcopv1alpha1.WorkloadSelector{{Kind: "DaemonSet"}},
+				}),
+			},
+			allowed: true,
+		},
+		{
+			name: "service account selector selects labeled service account",
+			pod:  withServiceAccountName(newPod(map[string]string{"app": "web"}), "cloud"),
+			podPresets: []runtime.Object{
+				newServiceAccount("cloud", map[string]string{"web-identity": "true"}),
+				withServiceAccountSelector(newPodPreset("web-identity", map[string]string{"app": "web"}, env("TOKEN_FILE", "token")), redhatcopv1alpha1.ServiceAccountSelector{
+					Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"web-identity": "true"}},
+				}),
+			},
+			allowed: true,
+			patched: true,
+			check: func(t *testing.T, pod *corev1.Pod) {
+				expectEnv(t, pod.Spec.Containers[0], env("TOKEN_FILE", "token"))
+			},
+		},
+		{
+			name: "service account selector ignores unknown service account",
+			pod:  newPod(map[string]string{"app": "web", "web-identity": "true"}),
+			podPresets: []runtime.Object{
+				withServiceAccountSelector(newPodPreset("web-identity", map[string]string{"app": "web"}, env("TOKEN_FILE", "token")), redhatcopv1alpha1.ServiceAccountSelector{
+					Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"web-identity": "true"}},
+				}),
+			},
+			allowed: true,
+		},
+		{
+			name: "templated values",
+			pod:  newPod(map[string]string{"app": "web"}),
+			podPresets: []runtime.Object{
+				newPodPreset("service", map[string]string{"app": "web"}, env("SERVICE_NAME", "{{ .Pod.Namespace }}-{{ .Pod.Labels.app }}-{{ .Container.Name }}")),
+			},
+			allowed: true,
+			patched: true,
+			check: func(t *testing.T, pod *corev1.Pod) {
+				expectEnv(t, pod.Spec.Containers[0], env("SERVICE_NAME", "default-web-web"))
+			},
+		},
+		{
+			name: "template error ignored",
+			pod:  newPod(map[string]string{"app": "web"}),
+			podPresets: []runtime.Object{
+				newPodPreset("service", map[string]string{"app": "web"}, env("SERVICE_NAME", "{{ .Pod.Labels.service }}"), env("TRACING", "enabled")),
+			},
+			allowed: true,
+			patched: true,
+			check: func(t *testing.T, pod *corev1.Pod) {
+				expectEnv(t, pod.Spec.Containers[0], env("TRACING", "enabled"))
+				expectAnnotations(t, pod, "podpreset-service", "injected-service", "conflict-service")
+			},
+		},
+		{
+			name: "template error rejects pod",
+			pod:  newPod(map[string]string{"app": "web"}),
+			podPresets: []runtime.Object{
+				withConflictPolicy(newPodPreset("service", map[string]string{"app": "web"}, env("SERVICE_NAME", "{{ .Pod.Labels.service }}")), redhatcopv1alpha1.ConflictPolicyReject),
+			},
+			allowed: false,
+			code:    http.StatusForbidden,
+		},
+		{
+			name: "podpreset with invalid selector skipped",
+			pod:  newPod(map[string]string{"app": "web"}),
+			podPresets: []runtime.Object{
+				withInvalidSelector(newPodPreset("broken", map[string]string{"app": "web"}, env("BROKEN", "broken"))),
+				newPodPreset("proxy", map[string]string{"app": "web"}, env("HTTP_PROXY", "proxy")),
+			},
+			allowed: true,
+			patched: true,
+			check: func(t *testing.T, pod *corev1.Pod) {
+				expectEnv(t, pod.Spec.Containers[0], env("HTTP_PROXY", "proxy"))
+				expectAnnotations(t, pod, "podpreset-proxy", "injected-proxy")
+			},
+		},
+		{
+			name: "opted out",
+			pod:  withAnnotations(newPod(map[string]string{"app": "web"}), map[string]string{corev1.PodPresetOptOutAnnotationKey: "true"}),
+			podPresets: []runtime.Object{
+				newPodPreset("proxy", map[string]string{"app": "web"}, env("HTTP_PROXY", "proxy")),
+			},
+			allowed: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mutator := newMutator(t, tt.podPresets...)
+			req := newAdmissionRequest(t, tt.pod)
+
+			resp := mutator.Handle(context.TODO(), req)
+			if resp.Allowed != tt.allowed {
+				t.Fatalf("expected allowed to be %t, got %t: %v", tt.allowed, resp.Allowed, resp.Result)
+			}
+			if tt.code != 0 && (resp.Result == nil || resp.Result.Code != tt.code) {
+				t.Fatalf("expected code %d, got %v", tt.code, resp.Result)
+			}
+			if patched := len(resp.Patches) > 0; patched != tt.patched {
+				t.Fatalf("expected patched to be %t, got patches %v", tt.patched, resp.Patches)
+			}
+			if tt.check != nil {
+				tt.check(t, patchedPod(t, req, resp))
+			}
+		})
+	}
+}
+
+func TestPodPresetMutatorHandleIdempotent(t *testing.T) {
+	mutator := newMutator(t,
+		newPodPreset("proxy", map[string]string{"app": "web"}, env("HTTP_PROXY", "proxy")),
+		withInitContainers(newPodPreset("wait", map[string]string{"app": "web"}), redhatcopv1alpha1.InitContainersOrderBefore, "wait-for-db"),
+	)
+
+	req := newAdmissionRequest(t, newPod(map[string]string{"app": "web"}))
+	resp := mutator.Handle(context.TODO(), req)
+	if !resp.Allowed || len(resp.Patches) == 0 {
+		t.Fatalf("expected the pod to be mutated, got %v", resp)
+	}
+	mutated := patchedPod(t, req, resp)
+
+	// a reinvocation of the webhook on the mutated pod changes nothing
+	req = newAdmissionRequest(t, mutated)
+	resp = mutator.Handle(context.TODO(), req)
+	if !resp.Allowed {
+		t.Fatalf("expected the mutated pod to be allowed, got %v", resp.Result)
+	}
+	if len(resp.Patches) != 0 {
+		t.Fatalf("expected no patches for the mutated pod, got %v", resp.Patches)
+	}
+
+	// injecting the PodPresets again, as if the pod did not record their
+	// injection, leaves the pod unchanged
+	repeated := mutated.DeepCopy()
+	podPresets := mutatorPodPresets(t, mutator)
+	for i := range podPresets.Items {
+		delete(repeated.Annotations, podpreset.AnnotationKey(&podPresets.Items[i]))
+	}
+	namespace := &corev1.Namespace{}
+	if err := mutator.Client.Get(context.TODO(), client.ObjectKey{Name: testNamespace}, namespace); err != nil {
+		t.Fatal(err)
+	}
+	injection, err := podpreset.Inject(repeated, namespace, nil, podPresets, redhatcopv1alpha1.ClusterPodPresetList{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(injection.Applied) != len(podPresets.Items) || injection.Rejection != nil || len(injection.Conflicts) != 0 {
+		t.Fatalf("expected every podpreset to be applied again without conflict, got %v", injection.Warnings)
+	}
+	if expected, got := marshal(t, mutated), marshal(t, injection.Pod); expected != got {
+		t.Errorf("expected applying the podpresets again to leave the pod unchanged, got\n%s\nexpected\n%s", got, expected)
+	}
+}
+
+func TestPodPresetMutatorHandleIgnored(t *testing.T) {
+	mutator := newMutator(t, newPodPreset("proxy", map[string]string{"app": "web"}, env("HTTP_PROXY", "proxy")))
+
+	update := newAdmissionRequest(t, newPod(map[string]string{"app": "web"}))
+	update.Operation = admissionv1.Update
+
+	subResource := newAdmissionRequest(t, newPod(map[string]string{"app": "web"}))
+	subResource.SubResource = "status"
+
+	for name, req := range map[string]admission.Request{"update": update, "subresource": subResource} {
+		t.Run(name, func(t *testing.T) {
+			resp := mutator.Handle(context.TODO(), req)
+			if !resp.Allowed || len(resp.Patches) != 0 {
+				t.Errorf("expected the request to be allowed without patches, got %v", resp)
+			}
+		})
+	}
+}
+
+func TestAdmissionOutcome(t *testing.T) {
+	tests := []struct {
+		name     string
+		resp     admission.Response
+		expected string
+	}{
+		{
+			name:     "denied",
+			resp:     admission.Denied("conflict"),
+			expected: metrics.OutcomeDenied,
+		},
+		{
+			name:     "errored",
+			resp:     admission.Errored(http.StatusInternalServerError, errors.New("unable to list podpresets")),
+			expected: metrics.OutcomeErrored,
+		},
+		{
+			name:     "bad request",
+			resp:     admission.Errored(http.StatusBadRequest, errors.New("unable to decode the pod")),
+			expected: metrics.OutcomeErrored,
+		},
+		{
+			name:     "mutated",
+			resp:     admission.PatchResponseFromRaw([]byte(`{"metadata":{}}`), []byte(`{"metadata":{"labels":{"team":"payments"}}}`)),
+			expected: metrics.OutcomeMutated,
+		},
+		{
+			name:     "unchanged",
+			resp:     admission.PatchResponseFromRaw([]byte(`{"metadata":{}}`), []byte(`{"metadata":{}}`)),
+			expected: metrics.OutcomeAllowed,
+		},
+		{
+			name:     "allowed",
+			resp:     admission.Allowed(""),
+			expected: metrics.OutcomeAllowed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if outcome := admissionOutcome(tt.resp); outcome != tt.expected {
+				t.Errorf("expected outcome %s, got %s", tt.expected, outcome)
+			}
+		})
+	}
+}
+
+func TestPodPresetMutatorHandleMetrics(t *testing.T) {
+	mutator := newMutator(t,
+		newPodPreset("proxy", map[string]string{"app": "web"}, env("HTTP_PROXY", "proxy")),
+		withConflictPolicy(newPodPreset("strict", map[string]string{"app": "api"}, env("HTTP_PROXY", "proxy")), redhatcopv1alpha1.ConflictPolicyReject),
+	)
+
+	before := testutil.ToFloat64(metrics.AdmissionsTotal.WithLabelValues(testNamespace, metrics.OutcomeMutated))
+	mutator.Handle(context.TODO(), newAdmissionRequest(t, newPod(map[string]string{"app": "web"})))
+	if after := testutil.ToFloat64(metrics.AdmissionsTotal.WithLabelValues(testNamespace, metrics.OutcomeMutated)); after != before+1 {
+		t.Errorf("expected the mutated admissions to be counted, got %v then %v", before, after)
+	}
+
+	before = testutil.ToFloat64(metrics.AdmissionsTotal.WithLabelValues(testNamespace, metrics.OutcomeDenied))
+	mutator.Handle(context.TODO(), newAdmissionRequest(t, newPod(map[string]string{"app": "api"}, env("HTTP_PROXY", "other"))))
+	if after := testutil.ToFloat64(metrics.AdmissionsTotal.WithLabelValues(testNamespace, metrics.OutcomeDenied)); after != before+1 {
+		t.Errorf("expected the denied admissions to be counted, got %v then %v", before, after)
+	}
+}
+
+func TestRecordInjectionMetrics(t *testing.T) {
+	a := newPodPreset("a", nil)
+	b := withConflictPolicy(newPodPreset("b", nil), redhatcopv1alpha1.ConflictPolicySkipPreset)
+	c := withConflictPolicy(newPodPreset("c", nil), redhatcopv1alpha1.ConflictPolicyReject)
+	cpp := podpreset.FromClusterPodPreset(&redhatcopv1alpha1.ClusterPodPreset{ObjectMeta: metav1.ObjectMeta{Name: "a"}})
+	conflictB := &podpreset.Conflict{PodPreset: b, Field: podpreset.ConflictFieldEnv, Key: "HTTP_PROXY"}
+	conflictC := &podpreset.Conflict{PodPreset: c, Field: podpreset.ConflictFieldVolume, Key: "certs"}
+
+	tests := []struct {
+		name       string
+		candidates []*redhatcopv1alpha1.PodPreset
+		applied    []*redhatcopv1alpha1.PodPreset
+		conflicts  []*podpreset.Conflict
+		rejection  *podpreset.Conflict
+		// injections are the expected count of each kind, name and outcome
+		injections map[[3]string]float64
+		// conflicts are the expected count of each name, field and policy
+		conflictCounts map[[3]string]float64
+	}{
+		{
+			name:       "applied",
+			candidates: []*redhatcopv1alpha1.PodPreset{a, cpp},
+			applied:    []*redhatcopv1alpha1.PodPreset{a, cpp},
+			injections: map[[3]string]float64{
+				{podpreset.PodPresetKind, "a", metrics.InjectionApplied}:        1,
+				{podpreset.ClusterPodPresetKind, "a", metrics.InjectionApplied}: 1,
+				{podpreset.PodPresetKind, "a", metrics.InjectionSkipped}:        0,
+			},
+		},
+		{
+			name:       "skipped",
+			candidates: []*redhatcopv1alpha1.PodPreset{a, b},
+			applied:    []*redhatcopv1alpha1.PodPreset{a},
+			conflicts:  []*podpreset.Conflict{conflictB},
+			injections: map[[3]string]float64{
+				{podpreset.PodPresetKind, "a", metrics.InjectionApplied}: 1,
+				{podpreset.PodPresetKind, "b", metrics.InjectionSkipped}: 1,
+				{podpreset.PodPresetKind, "b", metrics.InjectionApplied}: 0,
+			},
+			conflictCounts: map[[3]string]float64{
+				{"b", podpreset.ConflictFieldEnv, string(redhatcopv1alpha1.ConflictPolicySkipPreset)}: 1,
+			},
+		},
+		{
+			name:       "rejected",
+			candidates: []*redhatcopv1alpha1.PodPreset{a, b, c},
+			conflicts:  []*podpreset.Conflict{conflictB, conflictC},
+			rejection:  conflictC,
+			injections: map[[3]string]float64{
+				{podpreset.PodPresetKind, "a", metrics.InjectionSkipped}:  1,
+				{podpreset.PodPresetKind, "b", metrics.InjectionSkipped}:  1,
+				{podpreset.PodPresetKind, "c", metrics.InjectionRejected}: 1,
+				{podpreset.PodPresetKind, "a", metrics.InjectionApplied}:  0,
+			},
+			conflictCounts: map[[3]string]float64{
+				{"b", podpreset.ConflictFieldEnv, string(redhatcopv1alpha1.ConflictPolicySkipPreset)}: 1,
+				{"c", podpreset.ConflictFieldVolume, string(redhatcopv1alpha1.ConflictPolicyReject)}:  1,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the counters are global, each case records them in a namespace
+			// of its own
+			namespace := "metrics-" + strings.ReplaceAll(tt.name, " ", "-")
+
+			recordInjectionMetrics(namespace, tt.candidates, tt.applied, tt.conflicts, tt.rejection)
+
+			for labels, expected := range tt.injections {
+				if count := testutil.ToFloat64(metrics.InjectionsTotal.WithLabelValues(namespace, labels[0], labels[1], labels[2])); count != expected {
+					t.Errorf("expected %v %s injections of %s %s, got %v", expected, labels[2], labels[0], labels[1], count)
+				}
+			}
+			for labels, expected := range tt.conflictCounts {
+				if count := testutil.ToFloat64(metrics.ConflictsTotal.WithLabelValues(namespace, podpreset.PodPresetKind, labels[0], labels[1], labels[2])); count != expected {
+					t.Errorf("expected %v conflicts of %s on %s with policy %s, got %v", expected, labels[0], labels[1], labels[2], count)
+				}
+			}
+		})
+	}
+}
+
+func newMutator(t *testing.T, podPresets ...runtime.Object) *PodPresetMutator {
+	t.Helper()
+
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := redhatcopv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: testNamespace}}
+	objs := append([]runtime.Object{namespace}, podPresets...)
+
+	decoder, err := admission.NewDecoder(scheme)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mutator := &PodPresetMutator{
+		Client: fake.NewClientBuilder().WithScheme(scheme).WithRuntimeObjects(objs...).Build(),
+		Log:    logr.Discard(),
+	}
+	if err := mutator.InjectDecoder(decoder); err != nil {
+		t.Fatal(err)
+	}
+	return mutator
+}
+
+func mutatorPodPresets(t *testing.T, mutator *PodPresetMutator) redhatcopv1alpha1.PodPresetList {
+	t.Helper()
+
+	list := redhatcopv1alpha1.PodPresetList{}
+	if err := mutator.Client.List(context.TODO(), &list); err != nil {
+		t.Fatal(err)
+	}
+	return list
+}
+
+func newAdmissionRequest(t *testing.T, pod *corev1.Pod) admission.Request {
+	t.Helper()
+
+	return admission.Request{
+		AdmissionRequest: admissionv1.AdmissionRequest{
+			UID:       "test",
+			Kind:      metav1.GroupVersionKind{Version: "v1", Kind: "Pod"},
+			Resource:  metav1.GroupVersionResource{Version: "v1", Resource: "pods"},
+			Namespace: testNamespace,
+			Operation: admissionv1.Create,
+			Object:    runtime.RawExtension{Raw: []byte(marshal(t, pod))},
+		},
+	}
+}
+
+// patchedPod returns the pod of the request with the patches of the response
+// applied.
+func patchedPod(t *testing.T, req admission.Request, resp admission.Response) *corev1.Pod {
+	t.Helper()
+
+	pod := &corev1.Pod{}
+	patchedObject(t, req, resp, pod)
+	return pod
+}
+
+// patchedObject decodes the object of the request with the patches of the
+// response applied into obj.
+func patchedObject(t *testing.T, req admission.Request, resp admission.Response, obj runtime.Object) {
+	t.Helper()
+
+	var doc interface{}
+	if err := json.Unmarshal(req.Object.Raw, &doc); err != nil {
+		t.Fatal(err)
+	}
+	for _, op := range resp.Patches {
+		var path []string
+		for _, token := range strings.Split(op.Path, "/")[1:] {
+			path = append(path, strings.NewReplacer("~1", "/", "~0", "~").Replace(token))
+		}
+		doc = applyOperation(t, doc, path, op)
+	}
+
+	raw, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(raw, obj); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// applyOperation applies a JSON patch operation to the node of a decoded JSON
+// document found at path, relative to node. Only the add, remove and replace
+// operations, the ones created by jsonpatch.CreatePatch, are supported.
+func applyOperation(t *testing.T, node interface{}, path []string, op jsonpatch.JsonPatchOperation) interface{} {
+	t.Helper()
+
+	if len(path) == 0 {
+		return op.Value
+	}
+
+	switch n := node.(type) {
+	case map[string]interface{}:
+		if len(path) > 1 {
+			n[path[0]] = applyOperation(t, n[path[0]], path[1:], op)
+		} else if op.Operation == "remove" {
+			delete(n, path[0])
+		} else {
+			n[path[0]] = op.Value
+		}
+		return n
+	case []interface{}:
+		index := len(n)
+		if path[0] != "-" {
+			var err error
+			if index, err = strconv.Atoi(path[0]); err != nil || index > len(n) {
+				t.Fatalf("invalid index in patch path %s", op.Path)
+			}
+		}
+		switch {
+		case len(path) > 1:
+			n[index] = applyOperation(t, n[index], path[1:], op)
+		case op.Operation == "add":
+			n = append(n[:index], append([]interface{}{op.Value}, n[index:]...)...)
+		case op.Operation == "remove":
+			n = append(n[:index], n[index+1:]...)
+		default:
+			n[index] = op.Value
+		}
+		return n
+	}
+
+	t.Fatalf("unable to apply the %s operation of path %s", op.Operation, op.Path)
+	return nil
+}
+
+func marshal(t *testing.T, obj runtime.Object) string {
+	t.Helper()
+
+	raw, err := json.Marshal(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(raw)
+}
+
+func newPod(lbls map[string]string, envVars ...corev1.EnvVar) *corev1.Pod {
+	return &corev1.Pod{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Pod"},
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: "web-",
+			Namespace:    testNamespace,
+			Labels:       lbls,
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{Name: "web", Image: "web", Env: envVars}},
+		},
+	}
+}
+
+func withAnnotations(pod *corev1.Pod, annotations map[string]string) *corev1.Pod {
+	pod.Annotations = annotations
+	return pod
+}
+
+func newPodPreset(name string, lbls map[string]string, envVars ...corev1.EnvVar) *redhatcopv1alpha1.PodPreset {
+	return &redhatcopv1alpha1.PodPreset{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: testNamespace},
+		Spec: redhatcopv1alpha1.PodPresetSpec{
+			Selector: metav1.LabelSelector{MatchLabels: lbls},
+			Env:      envVars,
+		},
+	}
+}
+
+func withPriority(pp *redhatcopv1alpha1.PodPreset, priority int32) *redhatcopv1alpha1.PodPreset {
+	pp.Spec.Priority = priority
+	return pp
+}
+
+func withConflictPolicy(pp *redhatcopv1alpha1.PodPreset, policy redhatcopv1alpha1.ConflictPolicy) *redhatcopv1alpha1.PodPreset {
+	pp.Spec.ConflictPolicy = policy
+	return pp
+}
+
+func withInvalidSelector(pp *redhatcopv1alpha1.PodPreset) *redhatcopv1alpha1.PodPreset {
+	pp.Spec.Selector.MatchExpressions = []metav1.LabelSelectorRequirement{{Key: "app", Operator: "Unknown"}}
+	return pp
+}
+
+func withImageSelector(pp *redhatcopv1alpha1.PodPreset, selector redhatcopv1alpha1.ImageSelector) *redhatcopv1alpha1.PodPreset {
+	pp.Spec.ImageSelector = &selector
+	return pp
+}
+
+func withOwner(pod *corev1.Pod, kind, name string) *corev1.Pod {
+	controller := true
+	pod.OwnerReferences = []metav1.OwnerReference{{APIVersion: "apps/v1", Kind: kind, Name: name, Controller: &controller}}
+	return pod
+}
+
+func withOwnerSelector(pp *redhatcopv1alpha1.PodPreset, selector redhatcopv1alpha1.OwnerSelector) *redhatcopv1alpha1.PodPreset {
+	pp.Spec.OwnerSelector = &selector
+	return pp
+}
+
+func withServiceAccountName(pod *corev1.Pod, name string) *corev1.Pod {
+	pod.Spec.ServiceAccountName = name
+	return pod
+}
+
+func newServiceAccount(name string, lbls map[string]string) *corev1.ServiceAccount {
+	return &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: testNamespace, Labels: lbls}}
+}
+
+func withServiceAccountSelector(pp *redhatcopv1alpha1.PodPreset, selector redhatcopv1alpha1.ServiceAccountSelector) *redhatcopv1alpha1.PodPreset {
+	pp.Spec.ServiceAccountSelector = &selector
+	return pp
+}
+
+func withPodInitContainers(pod *corev1.Pod, names ...string) *corev1.Pod {
+	pod.Spec.InitContainers = containers(names...)
+	return pod
+}
+
+func withInitContainers(pp *redhatcopv1alpha1.PodPreset, order redhatcopv1alpha1.InitContainersOrder, names ...string) *redhatcopv1alpha1.PodPreset {
+	pp.Spec.InitContainersOrder = order
+	pp.Spec.InitContainers = containers(names...)
+	return pp
+}
+
+func containers(names ...string) []corev1.Container {
+	containers := make([]corev1.Container, len(names))
+	for i, name := range names {
+		containers[i] = corev1.Container{Name: name, Image: name}
+	}
+	return containers
+}
+
+func env(name, value string) corev1.EnvVar {
+	return corev1.EnvVar{Name: name, Value: value}
+}
+
+func expectEnv(t *testing.T, ctr corev1.Container, expected ...corev1.EnvVar) {
+	t.Helper()
+
+	if !reflect.DeepEqual(ctr.Env, expected) {
+		t.Errorf("expected env of container %s to be %v, got %v", ctr.Name, expected, ctr.Env)
+	}
+}
+
+func expectInitContainers(t *testing.T, pod *corev1.Pod, expected ...string) {
+	t.Helper()
+
+	names := make([]string, len(pod.Spec.InitContainers))
+	for i, c := range pod.Spec.InitContainers {
+		names[i] = c.Name
+	}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected init containers %v, got %v", expected, names)
+	}
+}
+
+// expectAnnotations checks the pod holds exactly the given podpreset
+// annotations, identified by the suffix of their key.
+func expectAnnotations(t *testing.T, pod *corev1.Pod, expected ...string) {
+	t.Helper()
+
+	found := map[string]bool{}
+	for key := range pod.Annotations {
+		if strings.HasPrefix(key, "podpreset.admission.kubernetes.io/") {
+			found[strings.TrimPrefix(key, "podpreset.admission.kubernetes.io/")] = true
+		}
+	}
+	for _, key := range expected {
+		if !found[key] {
+			t.Errorf("expected annotation %s on pod, got %v", key, pod.Annotations)
+		}
+		delete(found, key)
+	}
+	for key := range found {
+		t.Errorf("unexpected annotation %s on pod", key)
+	}
+}
@@ -0,0 +1,158 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/go-logr/logr"
+	redhatcopv1alpha1 "github.com/redhat-cop/podpreset-webhook/api/v1alpha1"
+	"github.com/redhat-cop/podpreset-webhook/pkg/podpreset"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// +kubebuilder:webhook:path=/validate,mutating=false,failurePolicy=fail,groups=redhatcop.redhat.io,resources=podpresets;clusterpodpresets,verbs=create;update,versions=v1alpha1,name=vpodpreset.redhatcop.redhat.io,sideEffects=None,admissionReviewVersions={v1,v1beta1}
+
+// PodPresetValidator validates PodPresets and ClusterPodPresets
+type PodPresetValidator struct {
+	Client  client.Client
+	decoder *admission.Decoder
+	Log     logr.Logger
+}
+
+// Handle rejects invalid PodPresets and ClusterPodPresets and warns about
+// conflicts with the PodPresets and ClusterPodPresets which may be injected
+// into the same pods.
+func (v *PodPresetValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	logger := v.Log.WithValues("podpreset-webhook", fmt.Sprintf("%s/%s", req.Namespace, req.Name))
+
+	var pp *redhatcopv1alpha1.PodPreset
+	var cpp *redhatcopv1alpha1.ClusterPodPreset
+	var errs field.ErrorList
+
+	switch req.Kind.Kind {
+	case podpreset.PodPresetKind:
+		pp = &redhatcopv1alpha1.PodPreset{}
+		if err := v.decoder.Decode(req, pp); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		errs = podpreset.ValidatePodPresetSpec(&pp.Spec, field.NewPath("spec"))
+	case podpreset.ClusterPodPresetKind:
+		cpp = &redhatcopv1alpha1.ClusterPodPreset{}
+		if err := v.decoder.Decode(req, cpp); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		pp = podpreset.FromClusterPodPreset(cpp)
+		errs = podpreset.ValidateClusterPodPresetSpec(&cpp.Spec, field.NewPath("spec"))
+	default:
+		return admission.Allowed("")
+	}
+
+	if len(errs) > 0 {
+		logger.Info("rejecting invalid podpreset", "err", errs.ToAggregate().Error())
+		return admission.Denied(errs.ToAggregate().Error())
+	}
+
+	var others []*redhatcopv1alpha1.PodPreset
+	var err error
+	if cpp != nil {
+		others, err = v.overlappingClusterPresets(ctx, cpp)
+	} else {
+		others, err = v.overlappingPresets(ctx, req.Namespace)
+	}
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+
+	return admission.Allowed("").WithWarnings(podpreset.DescribePresetConflicts(pp, others)...)
+}
+
+// overlappingPresets returns the PodPresets and ClusterPodPresets which may be
+// injected into the same pods as a PodPreset of the given namespace: the other
+// PodPresets of the namespace and the ClusterPodPresets selecting it.
+func (v *PodPresetValidator) overlappingPresets(ctx context.Context, namespace string) ([]*redhatcopv1alpha1.PodPreset, error) {
+	podPresetList := &redhatcopv1alpha1.PodPresetList{}
+	if err := v.Client.List(ctx, podPresetList, &client.ListOptions{Namespace: namespace}); err != nil {
+		return nil, fmt.Errorf("Error retrieving list of PodPresets: %v", err)
+	}
+	var others []*redhatcopv1alpha1.PodPreset
+	for i := range podPresetList.Items {
+		others = append(others, &podPresetList.Items[i])
+	}
+
+	ns := &corev1.Namespace{}
+	if err := v.Client.Get(ctx, client.ObjectKey{Name: namespace}, ns); err != nil {
+		return nil, fmt.Errorf("Error retrieving Namespace %s: %v", namespace, err)
+	}
+
+	clusterPodPresetList := &redhatcopv1alpha1.ClusterPodPresetList{}
+	if err := v.Client.List(ctx, clusterPodPresetList); err != nil {
+		return nil, fmt.Errorf("Error retrieving list of ClusterPodPresets: %v", err)
+	}
+	for i := range clusterPodPresetList.Items {
+		other := &clusterPodPresetList.Items[i]
+		// an invalid ClusterPodPreset is never injected
+		if selector, err := podpreset.NewClusterPodPresetSelector(other); err == nil && selector.SelectsNamespace(ns) {
+			others = append(others, podpreset.FromClusterPodPreset(other))
+		}
+	}
+
+	return others, nil
+}
+
+// overlappingClusterPresets returns the PodPresets and ClusterPodPresets which
+// may be injected into the same pods as the ClusterPodPreset: the other
+// ClusterPodPresets whose namespaceSelector overlaps its own and the
+// PodPresets of the namespaces it selects.
+func (v *PodPresetValidator) overlappingClusterPresets(ctx context.Context, cpp *redhatcopv1alpha1.ClusterPodPreset) ([]*redhatcopv1alpha1.PodPreset, error) {
+	clusterPodPresetList := &redhatcopv1alpha1.ClusterPodPresetList{}
+	if err := v.Client.List(ctx, clusterPodPresetList); err != nil {
+		return nil, fmt.Errorf("Error retrieving list of ClusterPodPresets: %v", err)
+	}
+	var others []*redhatcopv1alpha1.PodPreset
+	for i := range clusterPodPresetList.Items {
+		other := &clusterPodPresetList.Items[i]
+		if podpreset.NamespaceSelectorsOverlap(cpp, other) {
+			others = append(others, podpreset.FromClusterPodPreset(other))
+		}
+	}
+
+	// the ClusterPodPreset is valid, its selector can be built
+	selector, err := podpreset.NewClusterPodPresetSelector(cpp)
+	if err != nil {
+		return nil, err
+	}
+	namespaceList := &corev1.NamespaceList{}
+	if err := v.Client.List(ctx, namespaceList); err != nil {
+		return nil, fmt.Errorf("Error retrieving list of Namespaces: %v", err)
+	}
+	selected := map[string]bool{}
+	for i := range namespaceList.Items {
+		selected[namespaceList.Items[i].Name] = selector.SelectsNamespace(&namespaceList.Items[i])
+	}
+
+	podPresetList := &redhatcopv1alpha1.PodPresetList{}
+	if err := v.Client.List(ctx, podPresetList); err != nil {
+		return nil, fmt.Errorf("Error retrieving list of PodPresets: %v", err)
+	}
+	for i := range podPresetList.Items {
+		if selected[podPresetList.Items[i].Namespace] {
+			others = append(others, &podPresetList.Items[i])
+		}
+	}
+
+	return others, nil
+}
+
+// PodPresetValidator implements admission.DecoderInjector.
+// A decoder will be automatically injected.
+
+// InjectDecoder injects the decoder.
+func (v *PodPresetValidator) InjectDecoder(d *admission.Decoder) error {
+	v.decoder = d
+	return nil
+}
@@ -0,0 +1,193 @@
+package handler
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/go-logr/logr"
+	redhatcopv1alpha1 "github.com/redhat-cop/podpreset-webhook/api/v1alpha1"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+func TestPodPresetValidatorHandle(t *testing.T) {
+	proxy := env("HTTP_PROXY", "proxy")
+	other := env("HTTP_PROXY", "other")
+	payments := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "payments", Labels: map[string]string{"team": "payments"}}}
+
+	tests := []struct {
+		name     string
+		object   runtime.Object
+		existing []runtime.Object
+		allowed  bool
+		warnings []string
+	}{
+		{
+			name:    "valid",
+			object:  newPodPreset("proxy", map[string]string{"app": "web"}, proxy),
+			allowed: true,
+		},
+		{
+			name:   "invalid selector",
+			object: withInvalidSelector(newPodPreset("proxy", map[string]string{"app": "web"}, proxy)),
+		},
+		{
+			name: "volume mount without volume",
+			object: withSpec(newPodPreset("proxy", map[string]string{"app": "web"}), func(spec *redhatcopv1alpha1.PodPresetSpec) {
+				spec.VolumeMounts = []corev1.VolumeMount{{Name: "certs", MountPath: "/certs"}}
+			}),
+		},
+		{
+			name:   "duplicate env",
+			object: newPodPreset("proxy", map[string]string{"app": "web"}, proxy, other),
+		},
+		{
+			name:   "invalid namespace selector",
+			object: withNamespaceSelector(newClusterPodPreset("proxy", map[string]string{"app": "web"}, proxy), metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "team", Operator: "Unknown"}}}),
+		},
+		{
+			name:     "conflicting podpreset",
+			object:   newPodPreset("proxy", map[string]string{"app": "web"}, proxy),
+			existing: []runtime.Object{newPodPreset("other", nil, other)},
+			allowed:  true,
+			warnings: []string{"PodPreset proxy conflicts with PodPreset other on env HTTP_PROXY for pods selected by both"},
+		},
+		{
+			name:     "disjoint selectors",
+			object:   newPodPreset("proxy", map[string]string{"app": "web"}, proxy),
+			existing: []runtime.Object{newPodPreset("other", map[string]string{"app": "worker"}, other)},
+			allowed:  true,
+		},
+		{
+			name:     "podpreset of another namespace",
+			object:   newPodPreset("proxy", map[string]string{"app": "web"}, proxy),
+			existing: []runtime.Object{payments, withNamespace(newPodPreset("other", nil, other), "payments")},
+			allowed:  true,
+		},
+		{
+			name:     "conflicting clusterpodpreset",
+			object:   newPodPreset("proxy", map[string]string{"app": "web"}, proxy),
+			existing: []runtime.Object{newClusterPodPreset("other", nil, other)},
+			allowed:  true,
+			warnings: []string{"PodPreset proxy conflicts with ClusterPodPreset other on env HTTP_PROXY for pods selected by both"},
+		},
+		{
+			name:     "clusterpodpreset not selecting the namespace",
+			object:   newPodPreset("proxy", map[string]string{"app": "web"}, proxy),
+			existing: []runtime.Object{withNamespaceSelector(newClusterPodPreset("other", nil, other), metav1.LabelSelector{MatchLabels: map[string]string{"team": "payments"}})},
+			allowed:  true,
+		},
+		{
+			name:     "clusterpodpreset shadowed",
+			object:   newPodPreset("proxy", map[string]string{"app": "web"}, proxy),
+			existing: []runtime.Object{newClusterPodPreset("proxy", nil, other)},
+			allowed:  true,
+		},
+		{
+			name:     "clusterpodpreset conflicting with clusterpodpreset",
+			object:   newClusterPodPreset("proxy", map[string]string{"app": "web"}, proxy),
+			existing: []runtime.Object{withNamespaceSelector(newClusterPodPreset("other", nil, other), metav1.LabelSelector{MatchLabels: map[string]string{"team": "payments"}})},
+			allowed:  true,
+			warnings: []string{"ClusterPodPreset proxy conflicts with ClusterPodPreset other on env HTTP_PROXY for pods selected by both"},
+		},
+		{
+			name:     "disjoint namespace selectors",
+			object:   withNamespaceSelector(newClusterPodPreset("proxy", map[string]string{"app": "web"}, proxy), metav1.LabelSelector{MatchLabels: map[string]string{"team": "billing"}}),
+			existing: []runtime.Object{withNamespaceSelector(newClusterPodPreset("other", nil, other), metav1.LabelSelector{MatchLabels: map[string]string{"team": "payments"}})},
+			allowed:  true,
+		},
+		{
+			name:   "clusterpodpreset conflicting with podpreset",
+			object: withNamespaceSelector(newClusterPodPreset("proxy", map[string]string{"app": "web"}, proxy), metav1.LabelSelector{MatchLabels: map[string]string{"team": "payments"}}),
+			existing: []runtime.Object{
+				payments,
+				withNamespace(newPodPreset("other", nil, other), "payments"),
+				newPodPreset("default", nil, other),
+			},
+			allowed:  true,
+			warnings: []string{"ClusterPodPreset proxy conflicts with PodPreset other on env HTTP_PROXY for pods selected by both"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			validator := newValidator(t, tt.existing...)
+
+			resp := validator.Handle(context.TODO(), newValidationRequest(t, tt.object))
+			if resp.Allowed != tt.allowed {
+				t.Fatalf("expected allowed %v, got %v", tt.allowed, resp.Result)
+			}
+			if !reflect.DeepEqual(resp.Warnings, tt.warnings) {
+				t.Errorf("expected warnings %q, got %q", tt.warnings, resp.Warnings)
+			}
+		})
+	}
+}
+
+func newValidator(t *testing.T, objs ...runtime.Object) *PodPresetValidator {
+	t.Helper()
+
+	client := newMutator(t, objs...).Client
+	decoder, err := admission.NewDecoder(client.Scheme())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	validator := &PodPresetValidator{
+		Client: client,
+		Log:    logr.Discard(),
+	}
+	if err := validator.InjectDecoder(decoder); err != nil {
+		t.Fatal(err)
+	}
+	return validator
+}
+
+func newValidationRequest(t *testing.T, obj runtime.Object) admission.Request {
+	t.Helper()
+
+	kind := "PodPreset"
+	namespace := testNamespace
+	if _, ok := obj.(*redhatcopv1alpha1.ClusterPodPreset); ok {
+		kind = "ClusterPodPreset"
+		namespace = ""
+	}
+	return admission.Request{
+		AdmissionRequest: admissionv1.AdmissionRequest{
+			UID:       "test",
+			Kind:      metav1.GroupVersionKind{Group: redhatcopv1alpha1.GroupVersion.Group, Version: redhatcopv1alpha1.GroupVersion.Version, Kind: kind},
+			Namespace: namespace,
+			Operation: admissionv1.Create,
+			Object:    runtime.RawExtension{Raw: []byte(marshal(t, obj))},
+		},
+	}
+}
+
+func newClusterPodPreset(name string, lbls map[string]string, envVars ...corev1.EnvVar) *redhatcopv1alpha1.ClusterPodPreset {
+	return &redhatcopv1alpha1.ClusterPodPreset{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: redhatcopv1alpha1.ClusterPodPresetSpec{PodPresetSpec: redhatcopv1alpha1.PodPresetSpec{
+			Selector: metav1.LabelSelector{MatchLabels: lbls},
+			Env:      envVars,
+		}},
+	}
+}
+
+func withNamespaceSelector(cpp *redhatcopv1alpha1.ClusterPodPreset, selector metav1.LabelSelector) *redhatcopv1alpha1.ClusterPodPreset {
+	cpp.Spec.NamespaceSelector = selector
+	return cpp
+}
+
+func withNamespace(pp *redhatcopv1alpha1.PodPreset, namespace string) *redhatcopv1alpha1.PodPreset {
+	pp.Namespace = namespace
+	return pp
+}
+
+func withSpec(pp *redhatcopv1alpha1.PodPreset, update func(spec *redhatcopv1alpha1.PodPresetSpec)) *redhatcopv1alpha1.PodPreset {
+	update(&pp.Spec)
+	return pp
+}
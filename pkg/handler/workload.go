@@ -0,0 +1,131 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/go-logr/logr"
+	"github.com/redhat-cop/podpreset-webhook/pkg/podpreset"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// +kubebuilder:webhook:path=/mutate-workloads,mutating=true,failurePolicy=ignore,groups=apps;batch,resources=deployments;statefulsets;daemonsets;jobs,verbs=create;update,versions=v1,name=mworkload.redhatcop.redhat.io,sideEffects=NoneOnDryRun,admissionReviewVersions={v1,v1beta1}
+// +kubebuilder:webhook:path=/mutate-workloads,mutating=true,failurePolicy=ignore,groups=batch,resources=cronjobs,verbs=create;update,versions=v1beta1,name=mcronjob.redhatcop.redhat.io,sideEffects=NoneOnDryRun,admissionReviewVersions={v1,v1beta1}
+
+// WorkloadMutator injects PodPresets into the pod template of Deployments,
+// StatefulSets, DaemonSets, Jobs and CronJobs labeled with
+// podpreset.TemplateInjectionLabel.
+type WorkloadMutator struct {
+	Client             client.Client
+	NamespaceSelection podpreset.NamespaceSelection
+	decoder            *admission.Decoder
+	Log                logr.Logger
+}
+
+// Handle injects the PodPresets selecting the labels of the pod template into
+// the pod template.
+func (m *WorkloadMutator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	logger := m.Log.WithValues("podpreset-webhook", fmt.Sprintf("%s/%s", req.Namespace, req.Name))
+
+	if len(req.SubResource) != 0 || (req.Operation != "CREATE" && req.Operation != "UPDATE") {
+		return admission.Allowed("")
+	}
+
+	// the pod template of Jobs is immutable
+	if req.Kind.Kind == "Job" && req.Operation != "CREATE" {
+		return admission.Allowed("")
+	}
+
+	workload := newWorkload(req.Kind)
+	if workload == nil {
+		return admission.Allowed("")
+	}
+	if err := m.decoder.Decode(req, workload); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	if workload.(metav1.Object).GetLabels()[podpreset.TemplateInjectionLabel] != "true" {
+		return admission.Allowed("")
+	}
+
+	template := podpreset.PodTemplate(workload)
+	pod := &corev1.Pod{ObjectMeta: *template.ObjectMeta.DeepCopy(), Spec: *template.Spec.DeepCopy()}
+	pod.Namespace = req.Namespace
+	pod.OwnerReferences = podpreset.TemplateOwners(workload)
+
+	podPresetList, clusterPodPresetList, namespace, err := listPodPresets(ctx, m.Client, req.Namespace)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+
+	serviceAccount, err := getServiceAccount(ctx, m.Client, pod)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+
+	explanation := podpreset.Explain(pod, *podPresetList, *clusterPodPresetList, namespace, serviceAccount, m.NamespaceSelection)
+	if explanation.Rejected != "" {
+		logger.Info("workload rejected due to podpreset conflict", "err", explanation.Rejected)
+		return admission.Denied(explanation.Rejected).WithWarnings(explanation.Conflicts...)
+	}
+	if explanation.Pod == nil || len(explanation.Applied) == 0 {
+		return admission.Allowed("")
+	}
+
+	template.Labels = explanation.Pod.Labels
+	template.Annotations = explanation.Pod.Annotations
+	template.Spec = explanation.Pod.Spec
+
+	marshaled, err := json.Marshal(workload)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+
+	warnings := make([]string, 0, len(explanation.Applied)+len(explanation.Conflicts))
+	for _, applied := range explanation.Applied {
+		warnings = append(warnings, fmt.Sprintf("%s %s applied to the pod template", applied.Kind, applied.Name))
+	}
+	warnings = append(warnings, explanation.Conflicts...)
+
+	return admission.PatchResponseFromRaw(req.Object.Raw, marshaled).WithWarnings(warnings...)
+}
+
+// newWorkload returns an empty workload of the given group, version and kind,
+// or nil when the workload is not decoded by the webhook. Only the versions
+// registered for the webhook are decoded, the API server converts workloads of
+// other versions to them.
+func newWorkload(gvk metav1.GroupVersionKind) runtime.Object {
+	switch schema.GroupVersionKind(gvk) {
+	case appsv1.SchemeGroupVersion.WithKind("Deployment"):
+		return &appsv1.Deployment{}
+	case appsv1.SchemeGroupVersion.WithKind("StatefulSet"):
+		return &appsv1.StatefulSet{}
+	case appsv1.SchemeGroupVersion.WithKind("DaemonSet"):
+		return &appsv1.DaemonSet{}
+	case batchv1.SchemeGroupVersion.WithKind("Job"):
+		return &batchv1.Job{}
+	case batchv1beta1.SchemeGroupVersion.WithKind("CronJob"):
+		return &batchv1beta1.CronJob{}
+	}
+	return nil
+}
+
+// WorkloadMutator implements admission.DecoderInjector.
+// A decoder will be automatically injected.
+
+// InjectDecoder injects the decoder.
+func (m *WorkloadMutator) InjectDecoder(d *admission.Decoder) error {
+	m.decoder = d
+	return nil
+}
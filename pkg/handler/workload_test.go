@@ -0,0 +1,309 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/go-logr/logr"
+	redhatcopv1alpha1 "github.com/redhat-cop/podpreset-webhook/api/v1alpha1"
+	"github.com/redhat-cop/podpreset-webhook/pkg/podpreset"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+func TestWorkloadMutatorHandle(t *testing.T) {
+	proxy := withSpecResourceVersion(newPodPreset("proxy", map[string]string{"app": "web"}, env("HTTP_PROXY", "proxy")), "5")
+
+	tests := []struct {
+		name       string
+		operation  admissionv1.Operation
+		workload   runtime.Object
+		podPresets []runtime.Object
+		allowed    bool
+		code       int32
+		patched    bool
+		check      func(t *testing.T, template *corev1.PodTemplateSpec)
+	}{
+		{
+			name:       "deployment created",
+			operation:  admissionv1.Create,
+			workload:   withTemplateInjection(newDeployment(newPod(map[string]string{"app": "web"}))),
+			podPresets: []runtime.Object{proxy.DeepCopy()},
+			allowed:    true,
+			patched:    true,
+			check: func(t *testing.T, template *corev1.PodTemplateSpec) {
+				expectEnv(t, template.Spec.Containers[0], env("HTTP_PROXY", "proxy"))
+				expectTemplateAnnotation(t, template, "podpreset.admission.kubernetes.io/podpreset-proxy", "5")
+			},
+		},
+		{
+			name:       "deployment without template injection",
+			operation:  admissionv1.Create,
+			workload:   newDeployment(newPod(map[string]string{"app": "web"})),
+			podPresets: []runtime.Object{proxy.DeepCopy()},
+			allowed:    true,
+		},
+		{
+			name:       "deployment not matching",
+			operation:  admissionv1.Create,
+			workload:   withTemplateInjection(newDeployment(newPod(map[string]string{"app": "db"}))),
+			podPresets: []runtime.Object{proxy.DeepCopy()},
+			allowed:    true,
+		},
+		{
+			name:       "deployment updated with the current podpreset",
+			operation:  admissionv1.Update,
+			workload:   withTemplateInjection(newDeployment(withAnnotations(newPod(map[string]string{"app": "web"}, env("HTTP_PROXY", "proxy")), map[string]string{"podpreset.admission.kubernetes.io/podpreset-proxy": "5"}))),
+			podPresets: []runtime.Object{proxy.DeepCopy()},
+			allowed:    true,
+		},
+		{
+			name:       "deployment updated with a previous podpreset",
+			operation:  admissionv1.Update,
+			workload:   withTemplateInjection(newDeployment(withAnnotations(newPod(map[string]string{"app": "web"}, env("HTTP_PROXY", "previous")), map[string]string{"podpreset.admission.kubernetes.io/podpreset-proxy": "4"}))),
+			podPresets: []runtime.Object{withConflictPolicy(proxy.DeepCopy(), redhatcopv1alpha1.ConflictPolicyOverride)},
+			allowed:    true,
+			patched:    true,
+			check: func(t *testing.T, template *corev1.PodTemplateSpec) {
+				expectEnv(t, template.Spec.Containers[0], env("HTTP_PROXY", "proxy"))
+				expectTemplateAnnotation(t, template, "podpreset.admission.kubernetes.io/podpreset-proxy", "5")
+			},
+		},
+		{
+			name:       "job created",
+			operation:  admissionv1.Create,
+			workload:   withTemplateInjection(newJob(newPod(map[string]string{"app": "web"}))),
+			podPresets: []runtime.Object{proxy.DeepCopy()},
+			allowed:    true,
+			patched:    true,
+			check: func(t *testing.T, template *corev1.PodTemplateSpec) {
+				expectEnv(t, template.Spec.Containers[0], env("HTTP_PROXY", "proxy"))
+			},
+		},
+		{
+			name:       "job updated",
+			operation:  admissionv1.Update,
+			workload:   withTemplateInjection(newJob(newPod(map[string]string{"app": "web"}))),
+			podPresets: []runtime.Object{proxy.DeepCopy()},
+			allowed:    true,
+		},
+		{
+			name:       "cronjob updated",
+			operation:  admissionv1.Update,
+			workload:   withTemplateInjection(newCronJob(newPod(map[string]string{"app": "web"}))),
+			podPresets: []runtime.Object{proxy.DeepCopy()},
+			allowed:    true,
+			patched:    true,
+			check: func(t *testing.T, template *corev1.PodTemplateSpec) {
+				expectEnv(t, template.Spec.Containers[0], env("HTTP_PROXY", "proxy"))
+			},
+		},
+		{
+			name:       "cronjob selected by owner",
+			operation:  admissionv1.Create,
+			workload:   withTemplateInjection(newCronJob(newPod(map[string]string{"app": "web"}))),
+			podPresets: []runtime.Object{withOwnerSelector(proxy.DeepCopy(), redhatcopv1alpha1.OwnerSelector{Include: []redhatcopv1alpha1.WorkloadSelector{{Kind: "Job", Name: "nightly*"}}})},
+			allowed:    true,
+			patched:    true,
+		},
+		{
+			name:       "conflict rejected",
+			operation:  admissionv1.Create,
+			workload:   withTemplateInjection(newDeployment(newPod(map[string]string{"app": "web"}, env("HTTP_PROXY", "other")))),
+			podPresets: []runtime.Object{withConflictPolicy(proxy.DeepCopy(), redhatcopv1alpha1.ConflictPolicyReject)},
+			allowed:    false,
+			code:       http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mutator := newWorkloadMutator(t, tt.podPresets...)
+			req := newWorkloadRequest(t, tt.operation, tt.workload)
+
+			resp := mutator.Handle(context.TODO(), req)
+
+			if resp.Allowed != tt.allowed {
+				t.Fatalf("expected allowed to be %t, got %v", tt.allowed, resp.Result)
+			}
+			if tt.code != 0 && resp.Result.Code != tt.code {
+				t.Errorf("expected code %d, got %d", tt.code, resp.Result.Code)
+			}
+			if patched := len(resp.Patches) > 0; patched != tt.patched {
+				t.Fatalf("expected patched to be %t, got %v", tt.patched, resp.Patches)
+			}
+			if tt.check != nil {
+				workload := tt.workload.DeepCopyObject()
+				patchedObject(t, req, resp, workload)
+				tt.check(t, podpreset.PodTemplate(workload))
+			}
+		})
+	}
+}
+
+func TestWorkloadMutatorHandlePodPresetChanged(t *testing.T) {
+	web := map[string]string{"app": "web"}
+	previous := withSpecResourceVersion(newPodPreset("proxy", web, env("HTTP_PROXY", "previous"), env("NO_PROXY", "localhost")), "4")
+	current := withSpecResourceVersion(newPodPreset("proxy", web, env("HTTP_PROXY", "proxy")), "5")
+
+	tests := []struct {
+		name     string
+		pod      *corev1.Pod
+		env      []corev1.EnvVar
+		warnings int
+	}{
+		{
+			name: "injected values replaced",
+			pod:  newPod(web),
+			env:  []corev1.EnvVar{env("HTTP_PROXY", "proxy")},
+		},
+		{
+			name: "values of the pod kept",
+			pod:  newPod(web, env("HTTP_PROXY", "pod")),
+			env:  []corev1.EnvVar{env("HTTP_PROXY", "pod")},
+			// the conflict with the value of the pod is still reported
+			warnings: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the workload is created with the previous version of the
+			// PodPreset
+			workload := withTemplateInjection(newDeployment(tt.pod))
+			req := newWorkloadRequest(t, admissionv1.Create, workload)
+			resp := newWorkloadMutator(t, previous.DeepCopy()).Handle(context.TODO(), req)
+			if !resp.Allowed || len(resp.Patches) == 0 {
+				t.Fatalf("expected the workload to be mutated, got %v", resp)
+			}
+			patchedObject(t, req, resp, workload)
+
+			// then updated once the PodPreset changed
+			req = newWorkloadRequest(t, admissionv1.Update, workload)
+			resp = newWorkloadMutator(t, current.DeepCopy()).Handle(context.TODO(), req)
+			if !resp.Allowed || len(resp.Patches) == 0 {
+				t.Fatalf("expected the workload to be mutated, got %v", resp)
+			}
+			patchedObject(t, req, resp, workload)
+
+			template := podpreset.PodTemplate(workload)
+			expectEnv(t, template.Spec.Containers[0], tt.env...)
+			expectTemplateAnnotation(t, template, "podpreset.admission.kubernetes.io/podpreset-proxy", "5")
+
+			// only the PodPreset applied and the conflicts with the pod are
+			// reported
+			if len(resp.Warnings) != 1+tt.warnings {
+				t.Errorf("expected %d conflict warnings, got %v", tt.warnings, resp.Warnings)
+			}
+		})
+	}
+}
+
+func TestWorkloadMutatorHandleUnregisteredVersion(t *testing.T) {
+	mutator := newWorkloadMutator(t, newPodPreset("proxy", map[string]string{"app": "web"}, env("HTTP_PROXY", "proxy")))
+	req := newWorkloadRequest(t, admissionv1.Create, withTemplateInjection(newDeployment(newPod(map[string]string{"app": "web"}))))
+	req.Kind.Version = "v1beta1"
+
+	resp := mutator.Handle(context.TODO(), req)
+	if !resp.Allowed || len(resp.Patches) != 0 {
+		t.Errorf("expected the request to be allowed without patches, got %v", resp)
+	}
+}
+
+func newWorkloadMutator(t *testing.T, podPresets ...runtime.Object) *WorkloadMutator {
+	t.Helper()
+
+	client := newMutator(t, podPresets...).Client
+	decoder, err := admission.NewDecoder(client.Scheme())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mutator := &WorkloadMutator{
+		Client: client,
+		Log:    logr.Discard(),
+	}
+	if err := mutator.InjectDecoder(decoder); err != nil {
+		t.Fatal(err)
+	}
+	return mutator
+}
+
+func newWorkloadRequest(t *testing.T, operation admissionv1.Operation, workload runtime.Object) admission.Request {
+	t.Helper()
+
+	gvk := workload.GetObjectKind().GroupVersionKind()
+	return admission.Request{
+		AdmissionRequest: admissionv1.AdmissionRequest{
+			UID:       "test",
+			Kind:      metav1.GroupVersionKind{Group: gvk.Group, Version: gvk.Version, Kind: gvk.Kind},
+			Namespace: testNamespace,
+			Operation: operation,
+			Object:    runtime.RawExtension{Raw: []byte(marshal(t, workload))},
+		},
+	}
+}
+
+// withTemplateInjection opts the workload into the injection of PodPresets
+// into its pod template.
+func withTemplateInjection(workload runtime.Object) runtime.Object {
+	workload.(metav1.Object).SetLabels(map[string]string{podpreset.TemplateInjectionLabel: "true"})
+	return workload
+}
+
+func withSpecResourceVersion(pp *redhatcopv1alpha1.PodPreset, specResourceVersion string) *redhatcopv1alpha1.PodPreset {
+	pp.Status.ObservedGeneration = pp.Generation
+	pp.Status.SpecResourceVersion = specResourceVersion
+	return pp
+}
+
+func newDeployment(pod *corev1.Pod) *appsv1.Deployment {
+	return &appsv1.Deployment{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "apps/v1", Kind: "Deployment"},
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: testNamespace},
+		Spec:       appsv1.DeploymentSpec{Template: podTemplateSpec(pod)},
+	}
+}
+
+func newJob(pod *corev1.Pod) *batchv1.Job {
+	return &batchv1.Job{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "batch/v1", Kind: "Job"},
+		ObjectMeta: metav1.ObjectMeta{Name: "migrate", Namespace: testNamespace},
+		Spec:       batchv1.JobSpec{Template: podTemplateSpec(pod)},
+	}
+}
+
+func newCronJob(pod *corev1.Pod) *batchv1beta1.CronJob {
+	return &batchv1beta1.CronJob{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "batch/v1beta1", Kind: "CronJob"},
+		ObjectMeta: metav1.ObjectMeta{Name: "nightly", Namespace: testNamespace},
+		Spec: batchv1beta1.CronJobSpec{
+			Schedule:    "0 2 * * *",
+			JobTemplate: batchv1beta1.JobTemplateSpec{Spec: batchv1.JobSpec{Template: podTemplateSpec(pod)}},
+		},
+	}
+}
+
+// podTemplateSpec returns the template of the pod.
+func podTemplateSpec(pod *corev1.Pod) corev1.PodTemplateSpec {
+	return corev1.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{Labels: pod.Labels, Annotations: pod.Annotations},
+		Spec:       pod.Spec,
+	}
+}
+
+func expectTemplateAnnotation(t *testing.T, template *corev1.PodTemplateSpec, key, value string) {
+	t.Helper()
+
+	if actual, ok := template.Annotations[key]; !ok || actual != value {
+		t.Errorf("expected annotation %s=%s on the pod template, got %v", key, value, template.Annotations)
+	}
+}
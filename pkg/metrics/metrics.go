@@ -0,0 +1,91 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// Label values of the outcome of an admission.
+const (
+	OutcomeAllowed = "allowed"
+	OutcomeMutated = "mutated"
+	OutcomeDenied  = "denied"
+	OutcomeErrored = "errored"
+)
+
+// Label values of the outcome of the injection of a PodPreset.
+const (
+	InjectionApplied  = "applied"
+	InjectionSkipped  = "skipped"
+	InjectionRejected = "rejected"
+)
+
+// The namespace and preset labels are not bounded: the number of series grows
+// with the number of namespaces and presets of the cluster.
+var (
+	// AdmissionsTotal counts the pod admissions handled by the mutating
+	// webhook.
+	AdmissionsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "podpreset_admissions_total",
+		Help: "Number of pod admissions handled, by namespace and outcome",
+	}, []string{"namespace", "outcome"})
+
+	// AdmissionDuration observes the time taken to handle pod admissions.
+	AdmissionDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "podpreset_admission_duration_seconds",
+		Help:    "Time taken to handle pod admissions, by namespace and outcome",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"namespace", "outcome"})
+
+	// PresetsMatchedTotal counts the PodPresets selecting admitted pods.
+	PresetsMatchedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "podpreset_matched_total",
+		Help: "Number of times a preset selected an admitted pod, by namespace, kind and preset",
+	}, []string{"namespace", "kind", "preset"})
+
+	// InjectionsTotal counts the outcome of injecting PodPresets into pods.
+	InjectionsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "podpreset_injections_total",
+		Help: "Number of preset injections, by namespace, kind, preset and outcome",
+	}, []string{"namespace", "kind", "preset", "outcome"})
+
+	// ConflictsTotal counts the conflicts detected while injecting PodPresets.
+	ConflictsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "podpreset_conflicts_total",
+		Help: "Number of conflicts detected while injecting presets, by namespace, kind, preset, field and conflict policy",
+	}, []string{"namespace", "kind", "preset", "field", "policy"})
+
+	// DecodeErrorsTotal counts the admission requests which could not be
+	// decoded.
+	DecodeErrorsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "podpreset_decode_errors_total",
+		Help: "Number of admission requests which could not be decoded, by namespace",
+	}, []string{"namespace"})
+
+	// ListErrorsTotal counts the failures to retrieve the resources needed to
+	// handle an admission.
+	ListErrorsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "podpreset_list_errors_total",
+		Help: "Number of failures to retrieve resources while handling admissions, by namespace and resource",
+	}, []string{"namespace", "resource"})
+
+	// InvalidSelectorPresets reports the PodPresets and ClusterPodPresets whose
+	// selectors are invalid and which are therefore never applied.
+	InvalidSelectorPresets = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "podpreset_invalid_selector",
+		Help: "Whether the selector of a preset is invalid (1) or not (0), by namespace, kind and preset",
+	}, []string{"namespace", "kind", "preset"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(
+		AdmissionsTotal,
+		AdmissionDuration,
+		PresetsMatchedTotal,
+		InjectionsTotal,
+		ConflictsTotal,
+		DecodeErrorsTotal,
+		ListErrorsTotal,
+		InvalidSelectorPresets,
+	)
+}
@@ -0,0 +1,112 @@
+package podpreset
+
+import (
+	redhatcopv1alpha1 "github.com/redhat-cop/podpreset-webhook/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Apply updates the PodSpec with merged information from all the
+// applicable PodPresets. It ignores the errors of merge functions because merge
+// errors have already been checked and resolved in ResolveConflicts. The
+// templates of the PodPresets are rendered with the pod as it was before any
+// PodPreset was applied; values which cannot be rendered are not injected.
+// The entries injected by each PodPreset are recorded on the pod, see
+// InjectedAnnotationKey.
+func Apply(pod *corev1.Pod, podPresets []*redhatcopv1alpha1.PodPreset) {
+	if len(podPresets) == 0 {
+		return
+	}
+
+	before := pod.DeepCopy()
+	r := newRenderer(pod)
+	podPresets, _ = r.renderPod(podPresets)
+
+	volumes, _ := mergeVolumes(pod.Spec.Volumes, podPresets)
+	pod.Spec.Volumes = volumes
+
+	tolerations, _ := mergeTolerations(pod.Spec.Tolerations, podPresets)
+	pod.Spec.Tolerations = tolerations
+
+	nodeSelector, _ := mergeNodeSelector(pod.Spec.NodeSelector, podPresets)
+	pod.Spec.NodeSelector = nodeSelector
+
+	affinity, _ := mergeAffinity(pod.Spec.Affinity, podPresets)
+	pod.Spec.Affinity = affinity
+
+	topologySpreadConstraints, _ := mergeTopologySpreadConstraints(pod.Spec.TopologySpreadConstraints, podPresets)
+	pod.Spec.TopologySpreadConstraints = topologySpreadConstraints
+
+	// containers injected by podPresets are added as defined and do not
+	// receive container level data, which keeps reinvocations idempotent.
+	injected := injectedContainerNames(podPresets)
+	for i, ctr := range pod.Spec.Containers {
+		if injected[ctr.Name] {
+			continue
+		}
+		applyPodPresetsOnContainer(&ctr, podPresetsForContainer(podPresets, ctr.Name, ctr.Image, containerKindRegular), r)
+		pod.Spec.Containers[i] = ctr
+	}
+	for i, iCtr := range pod.Spec.InitContainers {
+		if injected[iCtr.Name] {
+			continue
+		}
+		applyPodPresetsOnContainer(&iCtr, podPresetsForContainer(podPresets, iCtr.Name, iCtr.Image, containerKindInit), r)
+		pod.Spec.InitContainers[i] = iCtr
+	}
+	for i, eCtr := range pod.Spec.EphemeralContainers {
+		applyPodPresetsOnEphemeralContainer(&eCtr, podPresetsForContainer(podPresets, eCtr.Name, eCtr.Image, containerKindEphemeral), r)
+		pod.Spec.EphemeralContainers[i] = eCtr
+	}
+
+	containers, _ := mergeContainers(pod.Spec.Containers, podPresets)
+	pod.Spec.Containers = containers
+
+	initContainers, _ := mergeInitContainers(pod.Spec.InitContainers, podPresets)
+	pod.Spec.InitContainers = initContainers
+
+	podLabels, _ := mergeLabels(pod.ObjectMeta.Labels, podPresets)
+	pod.ObjectMeta.Labels = podLabels
+
+	podAnnotations, _ := mergeAnnotations(pod.ObjectMeta.Annotations, podPresets)
+	pod.ObjectMeta.Annotations = podAnnotations
+
+	// add annotation
+	if pod.ObjectMeta.Annotations == nil {
+		pod.ObjectMeta.Annotations = map[string]string{}
+	}
+
+	recordInjection(before, pod, podPresets)
+	for _, pp := range podPresets {
+		pod.ObjectMeta.Annotations[AnnotationKey(pp)] = SpecResourceVersion(pp)
+	}
+}
+
+// applyPodPresetsOnEphemeralContainer injects envVars, VolumeMounts and
+// envFrom from given podPresets in to the given ephemeral container. Resources
+// are not injected as ephemeral containers may not set them.
+func applyPodPresetsOnEphemeralContainer(ctr *corev1.EphemeralContainer, podPresets []*redhatcopv1alpha1.PodPreset, r *renderer) {
+	c := corev1.Container(ctr.EphemeralContainerCommon)
+	applyPodPresetsOnContainer(&c, podPresets, r)
+	c.Resources = ctr.Resources
+	ctr.EphemeralContainerCommon = corev1.EphemeralContainerCommon(c)
+}
+
+// applyPodPresetsOnContainer injects envVars, VolumeMounts, envFrom and resources from
+// given podPresets in to the given container, rendering their templates with
+// r. It ignores conflict errors because it assumes those have been checked
+// already by the caller.
+func applyPodPresetsOnContainer(ctr *corev1.Container, podPresets []*redhatcopv1alpha1.PodPreset, r *renderer) {
+	podPresets, _ = r.renderContainer(podPresets, ctr)
+
+	envVars, _ := mergeEnv(ctr.Env, podPresets)
+	ctr.Env = envVars
+
+	volumeMounts, _ := mergeVolumeMounts(ctr.VolumeMounts, podPresets)
+	ctr.VolumeMounts = volumeMounts
+
+	envFrom, _ := mergeEnvFrom(ctr.EnvFrom, podPresets)
+	ctr.EnvFrom = envFrom
+
+	resources, _ := mergeResources(ctr.Resources, podPresets)
+	ctr.Resources = resources
+}
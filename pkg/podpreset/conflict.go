@@ -0,0 +1,260 @@
+package podpreset
+
+import (
+	"fmt"
+
+	redhatcopv1alpha1 "github.com/redhat-cop/podpreset-webhook/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+// Fields of the pod in which a merge conflict can be detected.
+const (
+	ConflictFieldEnv         = "env"
+	ConflictFieldEnvFrom     = "envFrom"
+	ConflictFieldVolume      = "volume"
+	ConflictFieldVolumeMount = "volumeMount"
+	ConflictFieldResources   = "resources"
+
+	ConflictFieldToleration               = "toleration"
+	ConflictFieldNodeSelector             = "nodeSelector"
+	ConflictFieldAffinity                 = "affinity"
+	ConflictFieldTopologySpreadConstraint = "topologySpreadConstraint"
+
+	ConflictFieldContainer     = "container"
+	ConflictFieldInitContainer = "initContainer"
+
+	ConflictFieldLabel      = "label"
+	ConflictFieldAnnotation = "annotation"
+
+	// ConflictFieldTemplate reports a templated value which could not be
+	// rendered for the pod. The value is not injected, unless the conflict
+	// policy rejects the pod or skips the PodPreset.
+	ConflictFieldTemplate = "template"
+)
+
+// Conflict describes a conflict detected while merging the data injected
+// by a PodPreset with the data already present on the pod.
+type Conflict struct {
+	// PodPreset is the PodPreset causing the conflict.
+	PodPreset *redhatcopv1alpha1.PodPreset
+
+	// Field is the field of the pod the conflict occurred in, such as env.
+	Field string
+
+	// Key identifies the conflicting entry within the field.
+	Key string
+
+	message string
+}
+
+func newConflict(pp *redhatcopv1alpha1.PodPreset, field, key, format string, args ...interface{}) *Conflict {
+	return &Conflict{
+		PodPreset: pp,
+		Field:     field,
+		Key:       key,
+		message:   fmt.Sprintf(format, args...),
+	}
+}
+
+func (c *Conflict) Error() string {
+	return c.message
+}
+
+// conflictsFromError extracts the merge conflicts contained in an error
+// returned by one of the merge functions.
+func conflictsFromError(err error) []*Conflict {
+	if err == nil {
+		return nil
+	}
+
+	errs := []error{err}
+	if agg, ok := err.(utilerrors.Aggregate); ok {
+		errs = utilerrors.Flatten(agg).Errors()
+	}
+
+	var conflicts []*Conflict
+	for _, e := range errs {
+		if c, ok := e.(*Conflict); ok {
+			conflicts = append(conflicts, c)
+		}
+	}
+	return conflicts
+}
+
+// ResolveConflicts detects the conflicts caused by applying the given
+// PodPresets on the pod and resolves them according to the conflict policy of
+// the PodPreset involved. It returns the PodPresets which should be applied,
+// every conflict that was detected and, when a PodPreset rejects the pod, the
+// conflict responsible for the rejection.
+func ResolveConflicts(pod *corev1.Pod, podPresets []*redhatcopv1alpha1.PodPreset) ([]*redhatcopv1alpha1.PodPreset, []*Conflict, *Conflict) {
+	var skippedConflicts []*Conflict
+
+	for {
+		conflicts := conflictsFromError(safeToApplyPodPresetsOnPod(pod, podPresets, newRenderer(pod)))
+
+		skipped := map[*redhatcopv1alpha1.PodPreset]bool{}
+		for _, c := range conflicts {
+			switch c.PodPreset.Spec.GetConflictPolicy() {
+			case redhatcopv1alpha1.ConflictPolicyReject:
+				return nil, append(skippedConflicts, conflicts...), c
+			case redhatcopv1alpha1.ConflictPolicySkipPreset:
+				skipped[c.PodPreset] = true
+			}
+		}
+
+		if len(skipped) == 0 {
+			return podPresets, append(skippedConflicts, conflicts...), nil
+		}
+
+		// drop the skipped PodPresets and check the remaining ones again, as
+		// their conflicts may have been caused by a skipped PodPreset.
+		for _, c := range conflicts {
+			if skipped[c.PodPreset] {
+				skippedConflicts = append(skippedConflicts, c)
+			}
+		}
+		var remaining []*redhatcopv1alpha1.PodPreset
+		for _, pp := range podPresets {
+			if !skipped[pp] {
+				remaining = append(remaining, pp)
+			}
+		}
+		podPresets = remaining
+	}
+}
+
+// DescribeConflicts describes the outcome of each conflict, omitting
+// duplicates.
+func DescribeConflicts(conflicts []*Conflict) []string {
+	var warnings []string
+	seen := map[string]bool{}
+
+	for _, c := range conflicts {
+		warning := DescribeConflict(c)
+		if !seen[warning] {
+			seen[warning] = true
+			warnings = append(warnings, warning)
+		}
+	}
+
+	return warnings
+}
+
+// DescribeConflict describes a conflict and how it was resolved.
+func DescribeConflict(c *Conflict) string {
+	policy := c.PodPreset.Spec.GetConflictPolicy()
+
+	var outcome string
+	switch {
+	case policy == redhatcopv1alpha1.ConflictPolicyReject:
+		outcome = "pod rejected"
+	case policy == redhatcopv1alpha1.ConflictPolicySkipPreset:
+		outcome = "podpreset skipped"
+	case c.Field == ConflictFieldTemplate:
+		outcome = "value not injected"
+	case policy == redhatcopv1alpha1.ConflictPolicyOverride:
+		outcome = "podpreset value applied"
+	default:
+		outcome = "existing value kept"
+	}
+
+	return fmt.Sprintf("%s %s conflicts on %s %s: %s (%s)", Kind(c.PodPreset), c.PodPreset.GetName(), c.Field, c.Key, outcome, policy)
+}
+
+// AnnotateConflicts records on the pod the conflict policy applied for each
+// PodPreset which conflicted with it.
+func AnnotateConflicts(pod *corev1.Pod, conflicts []*Conflict) {
+	if len(conflicts) == 0 {
+		return
+	}
+
+	if pod.ObjectMeta.Annotations == nil {
+		pod.ObjectMeta.Annotations = map[string]string{}
+	}
+	for _, c := range conflicts {
+		pod.ObjectMeta.Annotations[ConflictAnnotationKey(c.PodPreset)] = string(c.PodPreset.Spec.GetConflictPolicy())
+	}
+}
+
+// ConflictsBetween returns the conflicts between two PodPresets applied on the
+// same pod. Container selectors are not taken into account, as they depend on
+// the containers of the pod, and templated values are compared unrendered.
+func ConflictsBetween(first, second *redhatcopv1alpha1.PodPreset) []*Conflict {
+	podPresets := []*redhatcopv1alpha1.PodPreset{first, second}
+
+	conflicts := conflictsFromError(safeToApplyPodPresetsOnPod(&corev1.Pod{}, podPresets, nil))
+	return append(conflicts, conflictsFromError(safeToApplyPodPresetsOnContainer(&corev1.Container{}, podPresets, nil))...)
+}
+
+// DescribePresetConflicts returns a description of every conflict between the
+// PodPreset and the other PodPresets selecting overlapping labels. A PodPreset
+// and a ClusterPodPreset of the same name never conflict, as the ClusterPodPreset
+// is not injected into the pods of the namespace of the PodPreset.
+func DescribePresetConflicts(pp *redhatcopv1alpha1.PodPreset, others []*redhatcopv1alpha1.PodPreset) []string {
+	var descriptions []string
+	for _, other := range others {
+		if other.GetName() == pp.GetName() || !selectorsOverlap(other.Spec.Selector, pp.Spec.Selector) {
+			continue
+		}
+		for _, c := range ConflictsBetween(other, pp) {
+			descriptions = append(descriptions, fmt.Sprintf("%s %s conflicts with %s %s on %s %s for pods selected by both", Kind(pp), pp.GetName(), Kind(other), other.GetName(), c.Field, c.Key))
+		}
+	}
+	return descriptions
+}
+
+// NamespaceSelectorsOverlap returns whether the pods of a namespace could be
+// selected by both ClusterPodPresets, according to their namespaceSelectors.
+func NamespaceSelectorsOverlap(first, second *redhatcopv1alpha1.ClusterPodPreset) bool {
+	return selectorsOverlap(first.Spec.NamespaceSelector, second.Spec.NamespaceSelector)
+}
+
+// selectorsOverlap returns whether a pod could be selected by both label
+// selectors. It only reports selectors as disjoint when the labels required by
+// one of them are excluded by the other.
+func selectorsOverlap(first, second metav1.LabelSelector) bool {
+	return !excludesLabels(first, second.MatchLabels) && !excludesLabels(second, first.MatchLabels)
+}
+
+// excludesLabels returns whether the selector can never match a pod carrying
+// the given labels.
+func excludesLabels(selector metav1.LabelSelector, labels map[string]string) bool {
+	for key, value := range selector.MatchLabels {
+		if found, ok := labels[key]; ok && found != value {
+			return true
+		}
+	}
+
+	for _, expr := range selector.MatchExpressions {
+		found, ok := labels[expr.Key]
+		if !ok {
+			continue
+		}
+
+		switch expr.Operator {
+		case metav1.LabelSelectorOpIn:
+			if !containsString(expr.Values, found) {
+				return true
+			}
+		case metav1.LabelSelectorOpNotIn:
+			if containsString(expr.Values, found) {
+				return true
+			}
+		case metav1.LabelSelectorOpDoesNotExist:
+			return true
+		}
+	}
+
+	return false
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,435 @@
+package podpreset
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	redhatcopv1alpha1 "github.com/redhat-cop/podpreset-webhook/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// injectedEntry identifies an entry of a pod which can be injected by a
+// PodPreset, such as a label or the env var of a container. Field is one of
+// the conflict fields and Key identifies the entry within the field like in
+// conflicts. Container is the name of the container of container level
+// entries.
+type injectedEntry struct {
+	Field     string
+	Container string
+	Key       string
+}
+
+// String returns the entry as recorded in the InjectedAnnotationKey
+// annotation, such as "env/web/HTTP_PROXY" or "label//team". Keys may contain
+// slashes, fields and container names may not.
+func (e injectedEntry) String() string {
+	return fmt.Sprintf("%s/%s/%s", e.Field, e.Container, e.Key)
+}
+
+func parseInjectedEntry(s string) (injectedEntry, bool) {
+	parts := strings.SplitN(s, "/", 3)
+	if len(parts) != 3 {
+		return injectedEntry{}, false
+	}
+	return injectedEntry{Field: parts[0], Container: parts[1], Key: parts[2]}, true
+}
+
+// recordInjection records on the pod the entries injected by each of the
+// podPresets, by comparing the pod with the pod before the injection. An entry
+// added to the pod is attributed to the first PodPreset injecting it, an
+// entry replaced to the last PodPreset injecting it whose conflict policy is
+// Override. The entries recorded by an earlier injection of the same
+// PodPreset are kept while the pod still has them.
+func recordInjection(before, pod *corev1.Pod, podPresets []*redhatcopv1alpha1.PodPreset) {
+	beforeEntries, afterEntries := podEntries(before), podEntries(pod)
+	injected := injectedContainerNames(podPresets)
+	candidates := make([]map[injectedEntry]bool, len(podPresets))
+	for i, pp := range podPresets {
+		candidates[i] = presetEntries(pp, before, injected)
+	}
+
+	recorded := map[*redhatcopv1alpha1.PodPreset]map[string]bool{}
+	record := func(pp *redhatcopv1alpha1.PodPreset, e injectedEntry) {
+		if recorded[pp] == nil {
+			recorded[pp] = map[string]bool{}
+		}
+		recorded[pp][e.String()] = true
+	}
+	for _, pp := range podPresets {
+		for _, e := range recordedEntries(before, InjectedAnnotationKey(pp)) {
+			if _, ok := afterEntries[e]; ok {
+				record(pp, e)
+			}
+		}
+	}
+
+	for e, value := range afterEntries {
+		found, existed := beforeEntries[e]
+		// resources set by the container are only clamped, never replaced
+		if existed && (e.Field == ConflictFieldResources || reflect.DeepEqual(found, value)) {
+			continue
+		}
+
+		var owner *redhatcopv1alpha1.PodPreset
+		for i, pp := range podPresets {
+			if !candidates[i][e] {
+				continue
+			}
+			if pp.Spec.GetConflictPolicy() == redhatcopv1alpha1.ConflictPolicyOverride || (owner == nil && !existed) {
+				owner = pp
+			}
+		}
+		if owner != nil {
+			record(owner, e)
+		}
+	}
+
+	for _, pp := range podPresets {
+		if len(recorded[pp]) == 0 {
+			delete(pod.Annotations, InjectedAnnotationKey(pp))
+			continue
+		}
+		entries := make([]string, 0, len(recorded[pp]))
+		for e := range recorded[pp] {
+			entries = append(entries, e)
+		}
+		sort.Strings(entries)
+		value, _ := json.Marshal(entries)
+		pod.Annotations[InjectedAnnotationKey(pp)] = string(value)
+	}
+}
+
+// undoInjection removes the entries recorded as injected by an earlier
+// version of the PodPreset from the pod, along with the annotations recording
+// its injection, so that the new version is merged without conflicting with
+// the values of the earlier one. Entries also recorded by other PodPresets
+// are kept.
+func undoInjection(pod *corev1.Pod, pp *redhatcopv1alpha1.PodPreset) {
+	key := InjectedAnnotationKey(pp)
+
+	shared := map[injectedEntry]bool{}
+	for k := range pod.Annotations {
+		if k != key && isInjectedAnnotationKey(k) {
+			for _, e := range recordedEntries(pod, k) {
+				shared[e] = true
+			}
+		}
+	}
+	for _, e := range recordedEntries(pod, key) {
+		if !shared[e] {
+			removeEntry(pod, e)
+		}
+	}
+
+	delete(pod.Annotations, AnnotationKey(pp))
+	delete(pod.Annotations, ConflictAnnotationKey(pp))
+	delete(pod.Annotations, key)
+}
+
+func isInjectedAnnotationKey(key string) bool {
+	return strings.HasPrefix(key, annotationPrefix+"/injected-") || strings.HasPrefix(key, annotationPrefix+"/clusterinjected-")
+}
+
+// recordedEntries returns the entries recorded in the given annotation of the
+// pod. A malformed annotation records nothing.
+func recordedEntries(pod *corev1.Pod, key string) []injectedEntry {
+	value, ok := pod.Annotations[key]
+	if !ok {
+		return nil
+	}
+
+	var recorded []string
+	if err := json.Unmarshal([]byte(value), &recorded); err != nil {
+		return nil
+	}
+
+	var entries []injectedEntry
+	for _, s := range recorded {
+		if e, ok := parseInjectedEntry(s); ok {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// podEntries returns the entries of the pod which can be injected by a
+// PodPreset, with their value. The value of a container excludes the container
+// level data, which is recorded as entries of the container.
+func podEntries(pod *corev1.Pod) map[injectedEntry]interface{} {
+	entries := map[injectedEntry]interface{}{}
+	add := func(field, container, key string, value interface{}) {
+		entries[injectedEntry{Field: field, Container: container, Key: key}] = value
+	}
+
+	for k, v := range pod.Labels {
+		add(ConflictFieldLabel, "", k, v)
+	}
+	for k, v := range pod.Annotations {
+		add(ConflictFieldAnnotation, "", k, v)
+	}
+	for _, v := range pod.Spec.Volumes {
+		add(ConflictFieldVolume, "", v.Name, v)
+	}
+	for _, t := range pod.Spec.Tolerations {
+		add(ConflictFieldToleration, "", tolerationMergeKey{key: t.Key, effect: t.Effect}.String(), t)
+	}
+	for k, v := range pod.Spec.NodeSelector {
+		add(ConflictFieldNodeSelector, "", k, v)
+	}
+	if a := pod.Spec.Affinity; a != nil {
+		if a.NodeAffinity != nil {
+			add(ConflictFieldAffinity, "", "nodeAffinity", a.NodeAffinity)
+		}
+		if a.PodAffinity != nil {
+			add(ConflictFieldAffinity, "", "podAffinity", a.PodAffinity)
+		}
+		if a.PodAntiAffinity != nil {
+			add(ConflictFieldAffinity, "", "podAntiAffinity", a.PodAntiAffinity)
+		}
+	}
+	for _, c := range pod.Spec.TopologySpreadConstraints {
+		add(ConflictFieldTopologySpreadConstraint, "", topologySpreadConstraintMergeKey{topologyKey: c.TopologyKey, whenUnsatisfiable: c.WhenUnsatisfiable}.String(), c)
+	}
+
+	addContainer := func(field string, ctr corev1.Container) {
+		for _, v := range ctr.Env {
+			add(ConflictFieldEnv, ctr.Name, v.Name, v)
+		}
+		for _, e := range ctr.EnvFrom {
+			add(ConflictFieldEnvFrom, ctr.Name, newEnvFromMergeKey(e).String(), e)
+		}
+		for _, m := range ctr.VolumeMounts {
+			add(ConflictFieldVolumeMount, ctr.Name, m.Name, m)
+		}
+		for name, quantity := range ctr.Resources.Requests {
+			add(ConflictFieldResources, ctr.Name, "requests."+string(name), quantity.String())
+		}
+		for name, quantity := range ctr.Resources.Limits {
+			add(ConflictFieldResources, ctr.Name, "limits."+string(name), quantity.String())
+		}
+
+		ctr.Env, ctr.EnvFrom, ctr.VolumeMounts, ctr.Resources = nil, nil, nil, corev1.ResourceRequirements{}
+		add(field, "", ctr.Name, ctr)
+	}
+	for _, c := range pod.Spec.Containers {
+		addContainer(ConflictFieldContainer, c)
+	}
+	for _, c := range pod.Spec.InitContainers {
+		addContainer(ConflictFieldInitContainer, c)
+	}
+
+	return entries
+}
+
+// presetEntries returns the entries the PodPreset injects into the pod. The
+// containers injected by any PodPreset, listed in injected, do not receive
+// container level data.
+func presetEntries(pp *redhatcopv1alpha1.PodPreset, pod *corev1.Pod, injected map[string]bool) map[injectedEntry]bool {
+	entries := map[injectedEntry]bool{}
+	add := func(field, container, key string) {
+		entries[injectedEntry{Field: field, Container: container, Key: key}] = true
+	}
+
+	spec := &pp.Spec
+	for k := range spec.Labels {
+		add(ConflictFieldLabel, "", k)
+	}
+	for k := range spec.Annotations {
+		add(ConflictFieldAnnotation, "", k)
+	}
+	for _, v := range spec.Volumes {
+		add(ConflictFieldVolume, "", v.Name)
+	}
+	for _, t := range spec.Tolerations {
+		add(ConflictFieldToleration, "", tolerationMergeKey{key: t.Key, effect: t.Effect}.String())
+	}
+	for k := range spec.NodeSelector {
+		add(ConflictFieldNodeSelector, "", k)
+	}
+	if a := spec.Affinity; a != nil {
+		if a.NodeAffinity != nil {
+			add(ConflictFieldAffinity, "", "nodeAffinity")
+		}
+		if a.PodAffinity != nil {
+			add(ConflictFieldAffinity, "", "podAffinity")
+		}
+		if a.PodAntiAffinity != nil {
+			add(ConflictFieldAffinity, "", "podAntiAffinity")
+		}
+	}
+	for _, c := range spec.TopologySpreadConstraints {
+		add(ConflictFieldTopologySpreadConstraint, "", topologySpreadConstraintMergeKey{topologyKey: c.TopologyKey, whenUnsatisfiable: c.WhenUnsatisfiable}.String())
+	}
+	for _, c := range spec.Containers {
+		add(ConflictFieldContainer, "", c.Name)
+	}
+	for _, c := range spec.InitContainers {
+		add(ConflictFieldInitContainer, "", c.Name)
+	}
+
+	addContainer := func(ctr corev1.Container, kind containerKind) {
+		if injected[ctr.Name] || len(podPresetsForContainer([]*redhatcopv1alpha1.PodPreset{pp}, ctr.Name, ctr.Image, kind)) == 0 {
+			return
+		}
+		for _, v := range spec.Env {
+			add(ConflictFieldEnv, ctr.Name, v.Name)
+		}
+		for _, e := range spec.EnvFrom {
+			add(ConflictFieldEnvFrom, ctr.Name, newEnvFromMergeKey(e).String())
+		}
+		for _, m := range spec.VolumeMounts {
+			add(ConflictFieldVolumeMount, ctr.Name, m.Name)
+		}
+		if spec.Resources != nil {
+			for name := range spec.Resources.Requests {
+				add(ConflictFieldResources, ctr.Name, "requests."+string(name))
+			}
+			for name := range spec.Resources.Limits {
+				add(ConflictFieldResources, ctr.Name, "limits."+string(name))
+			}
+		}
+	}
+	for _, c := range pod.Spec.Containers {
+		addContainer(c, containerKindRegular)
+	}
+	for _, c := range pod.Spec.InitContainers {
+		addContainer(c, containerKindInit)
+	}
+
+	return entries
+}
+
+// removeEntry removes the entry from the pod.
+func removeEntry(pod *corev1.Pod, e injectedEntry) {
+	switch e.Field {
+	case ConflictFieldLabel:
+		pod.Labels = deleteKey(pod.Labels, e.Key)
+	case ConflictFieldAnnotation:
+		pod.Annotations = deleteKey(pod.Annotations, e.Key)
+	case ConflictFieldNodeSelector:
+		pod.Spec.NodeSelector = deleteKey(pod.Spec.NodeSelector, e.Key)
+	case ConflictFieldVolume:
+		var volumes []corev1.Volume
+		for _, v := range pod.Spec.Volumes {
+			if v.Name != e.Key {
+				volumes = append(volumes, v)
+			}
+		}
+		pod.Spec.Volumes = volumes
+	case ConflictFieldToleration:
+		var tolerations []corev1.Toleration
+		for _, t := range pod.Spec.Tolerations {
+			if (tolerationMergeKey{key: t.Key, effect: t.Effect}).String() != e.Key {
+				tolerations = append(tolerations, t)
+			}
+		}
+		pod.Spec.Tolerations = tolerations
+	case ConflictFieldAffinity:
+		a := pod.Spec.Affinity
+		if a == nil {
+			return
+		}
+		switch e.Key {
+		case "nodeAffinity":
+			a.NodeAffinity = nil
+		case "podAffinity":
+			a.PodAffinity = nil
+		case "podAntiAffinity":
+			a.PodAntiAffinity = nil
+		}
+		if reflect.DeepEqual(*a, corev1.Affinity{}) {
+			pod.Spec.Affinity = nil
+		}
+	case ConflictFieldTopologySpreadConstraint:
+		var constraints []corev1.TopologySpreadConstraint
+		for _, c := range pod.Spec.TopologySpreadConstraints {
+			if (topologySpreadConstraintMergeKey{topologyKey: c.TopologyKey, whenUnsatisfiable: c.WhenUnsatisfiable}).String() != e.Key {
+				constraints = append(constraints, c)
+			}
+		}
+		pod.Spec.TopologySpreadConstraints = constraints
+	case ConflictFieldContainer:
+		pod.Spec.Containers = removeContainer(pod.Spec.Containers, e.Key)
+	case ConflictFieldInitContainer:
+		pod.Spec.InitContainers = removeContainer(pod.Spec.InitContainers, e.Key)
+	default:
+		for i := range pod.Spec.Containers {
+			if pod.Spec.Containers[i].Name == e.Container {
+				removeContainerEntry(&pod.Spec.Containers[i], e)
+			}
+		}
+		for i := range pod.Spec.InitContainers {
+			if pod.Spec.InitContainers[i].Name == e.Container {
+				removeContainerEntry(&pod.Spec.InitContainers[i], e)
+			}
+		}
+	}
+}
+
+func removeContainer(containers []corev1.Container, name string) []corev1.Container {
+	var remaining []corev1.Container
+	for _, c := range containers {
+		if c.Name != name {
+			remaining = append(remaining, c)
+		}
+	}
+	return remaining
+}
+
+// removeContainerEntry removes the container level entry from the container.
+func removeContainerEntry(ctr *corev1.Container, e injectedEntry) {
+	switch e.Field {
+	case ConflictFieldEnv:
+		var env []corev1.EnvVar
+		for _, v := range ctr.Env {
+			if v.Name != e.Key {
+				env = append(env, v)
+			}
+		}
+		ctr.Env = env
+	case ConflictFieldEnvFrom:
+		var envFrom []corev1.EnvFromSource
+		for _, s := range ctr.EnvFrom {
+			if newEnvFromMergeKey(s).String() != e.Key {
+				envFrom = append(envFrom, s)
+			}
+		}
+		ctr.EnvFrom = envFrom
+	case ConflictFieldVolumeMount:
+		var mounts []corev1.VolumeMount
+		for _, m := range ctr.VolumeMounts {
+			if m.Name != e.Key {
+				mounts = append(mounts, m)
+			}
+		}
+		ctr.VolumeMounts = mounts
+	case ConflictFieldResources:
+		if name := strings.TrimPrefix(e.Key, "requests."); name != e.Key {
+			ctr.Resources.Requests = deleteResource(ctr.Resources.Requests, corev1.ResourceName(name))
+		} else if name := strings.TrimPrefix(e.Key, "limits."); name != e.Key {
+			ctr.Resources.Limits = deleteResource(ctr.Resources.Limits, corev1.ResourceName(name))
+		}
+	}
+}
+
+// deleteKey deletes the key from m, which is returned, or nil once empty.
+func deleteKey(m map[string]string, key string) map[string]string {
+	delete(m, key)
+	if len(m) == 0 {
+		return nil
+	}
+	return m
+}
+
+// deleteResource deletes the resource from list, which is returned, or nil
+// once empty.
+func deleteResource(list corev1.ResourceList, name corev1.ResourceName) corev1.ResourceList {
+	delete(list, name)
+	if len(list) == 0 {
+		return nil
+	}
+	return list
+}
@@ -0,0 +1,188 @@
+package podpreset
+
+import (
+	"reflect"
+	"testing"
+
+	redhatcopv1alpha1 "github.com/redhat-cop/podpreset-webhook/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestRecordInjection(t *testing.T) {
+	web := map[string]string{"app": "web"}
+	proxy := corev1.EnvVar{Name: "HTTP_PROXY", Value: "proxy"}
+	other := corev1.EnvVar{Name: "HTTP_PROXY", Value: "other"}
+
+	tests := []struct {
+		name       string
+		pod        *corev1.Pod
+		podPresets []*redhatcopv1alpha1.PodPreset
+		// recorded are the entries recorded for each PodPreset
+		recorded map[string]string
+		// restored is whether undoing the injection of every PodPreset
+		// restores the pod
+		restored bool
+	}{
+		{
+			name: "entries added",
+			pod:  testPod(web),
+			podPresets: []*redhatcopv1alpha1.PodPreset{withTestSpec(testPodPreset("proxy", web, proxy), func(spec *redhatcopv1alpha1.PodPresetSpec) {
+				spec.Labels = map[string]string{"team": "payments"}
+				spec.Volumes = []corev1.Volume{{Name: "cache", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}}}
+				spec.Tolerations = []corev1.Toleration{{Key: "dedicated", Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoSchedule}}
+				spec.NodeSelector = map[string]string{"zone": "a"}
+				spec.Containers = []corev1.Container{{Name: "sidecar", Image: "proxy:1.0"}}
+				spec.Resources = &redhatcopv1alpha1.ResourcesPreset{Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("100m")}}
+			})},
+			recorded: map[string]string{
+				"proxy": `["container//sidecar","env/web/HTTP_PROXY","label//team","nodeSelector//zone","resources/web/requests.cpu","toleration//dedicated:NoSchedule","volume//cache"]`,
+			},
+			restored: true,
+		},
+		{
+			name:       "value of the pod kept",
+			pod:        testPod(web, other),
+			podPresets: []*redhatcopv1alpha1.PodPreset{testPodPreset("proxy", web, proxy, corev1.EnvVar{Name: "NO_PROXY", Value: "localhost"})},
+			recorded:   map[string]string{"proxy": `["env/web/NO_PROXY"]`},
+			restored:   true,
+		},
+		{
+			name:       "value of the pod overridden",
+			pod:        testPod(web, other),
+			podPresets: []*redhatcopv1alpha1.PodPreset{withTestConflictPolicy(testPodPreset("proxy", web, proxy), redhatcopv1alpha1.ConflictPolicyOverride)},
+			recorded:   map[string]string{"proxy": `["env/web/HTTP_PROXY"]`},
+		},
+		{
+			name:       "first podpreset",
+			pod:        testPod(web),
+			podPresets: []*redhatcopv1alpha1.PodPreset{testPodPreset("a", web, proxy), testPodPreset("b", web, other)},
+			recorded:   map[string]string{"a": `["env/web/HTTP_PROXY"]`},
+			restored:   true,
+		},
+		{
+			name:       "identical values",
+			pod:        testPod(web),
+			podPresets: []*redhatcopv1alpha1.PodPreset{testPodPreset("a", web, proxy), testPodPreset("b", web, proxy)},
+			recorded:   map[string]string{"a": `["env/web/HTTP_PROXY"]`},
+			restored:   true,
+		},
+		{
+			name:       "overriding podpreset",
+			pod:        testPod(web),
+			podPresets: []*redhatcopv1alpha1.PodPreset{testPodPreset("a", web, proxy), withTestConflictPolicy(testPodPreset("b", web, other), redhatcopv1alpha1.ConflictPolicyOverride)},
+			recorded:   map[string]string{"b": `["env/web/HTTP_PROXY"]`},
+			restored:   true,
+		},
+		{
+			name: "container selector",
+			pod:  withTestContainers(testPod(web), corev1.Container{Name: "worker", Image: "worker:1.0"}),
+			podPresets: []*redhatcopv1alpha1.PodPreset{withTestSpec(testPodPreset("proxy", web, proxy), func(spec *redhatcopv1alpha1.PodPresetSpec) {
+				spec.ContainerSelector = &redhatcopv1alpha1.ContainerSelector{Include: []string{"worker"}}
+			})},
+			recorded: map[string]string{"proxy": `["env/worker/HTTP_PROXY"]`},
+			restored: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := tt.pod.DeepCopy()
+			Apply(pod, tt.podPresets)
+
+			for _, pp := range tt.podPresets {
+				value, ok := pod.Annotations[InjectedAnnotationKey(pp)]
+				if expected, recorded := tt.recorded[pp.GetName()]; ok != recorded || value != expected {
+					t.Errorf("expected %s to record %q, got %q", pp.GetName(), expected, value)
+				}
+			}
+
+			// injecting the same PodPresets again keeps the record
+			reapplied := pod.DeepCopy()
+			Apply(reapplied, tt.podPresets)
+			if !reflect.DeepEqual(reapplied.Annotations, pod.Annotations) {
+				t.Errorf("expected the record to be kept, got %v", reapplied.Annotations)
+			}
+
+			for _, pp := range tt.podPresets {
+				undoInjection(pod, pp)
+			}
+			if len(pod.Annotations) != 0 {
+				t.Errorf("expected the annotations to be removed, got %v", pod.Annotations)
+			}
+			if restored := equality.Semantic.DeepEqual(pod.Labels, tt.pod.Labels) && equality.Semantic.DeepEqual(pod.Spec, tt.pod.Spec); restored != tt.restored {
+				t.Errorf("expected restored %v, got labels %v and spec %v", tt.restored, pod.Labels, pod.Spec)
+			}
+		})
+	}
+}
+
+func TestUndoInjection(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		env         []string
+		labels      map[string]string
+	}{
+		{
+			name: "recorded entries removed",
+			annotations: map[string]string{
+				"podpreset.admission.kubernetes.io/podpreset-a": "1",
+				"podpreset.admission.kubernetes.io/conflict-a":  "Ignore",
+				"podpreset.admission.kubernetes.io/injected-a":  `["env/web/HTTP_PROXY","label//team"]`,
+			},
+			env:    []string{"NO_PROXY"},
+			labels: map[string]string{"app": "web"},
+		},
+		{
+			name: "entries recorded by another podpreset kept",
+			annotations: map[string]string{
+				"podpreset.admission.kubernetes.io/podpreset-a":       "1",
+				"podpreset.admission.kubernetes.io/injected-a":        `["env/web/HTTP_PROXY","label//team"]`,
+				"podpreset.admission.kubernetes.io/clusterinjected-b": `["env/web/HTTP_PROXY"]`,
+			},
+			env:    []string{"HTTP_PROXY", "NO_PROXY"},
+			labels: map[string]string{"app": "web"},
+		},
+		{
+			name: "malformed record",
+			annotations: map[string]string{
+				"podpreset.admission.kubernetes.io/podpreset-a": "1",
+				"podpreset.admission.kubernetes.io/injected-a":  "env/web/HTTP_PROXY",
+			},
+			env:    []string{"HTTP_PROXY", "NO_PROXY"},
+			labels: map[string]string{"app": "web", "team": "payments"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := testPod(map[string]string{"app": "web", "team": "payments"}, corev1.EnvVar{Name: "HTTP_PROXY", Value: "proxy"}, corev1.EnvVar{Name: "NO_PROXY", Value: "localhost"})
+			pod.Annotations = tt.annotations
+
+			undoInjection(pod, testPodPreset("a", nil))
+
+			var env []string
+			for _, v := range pod.Spec.Containers[0].Env {
+				env = append(env, v.Name)
+			}
+			if !reflect.DeepEqual(env, tt.env) {
+				t.Errorf("expected env %v, got %v", tt.env, env)
+			}
+			if !reflect.DeepEqual(pod.Labels, tt.labels) {
+				t.Errorf("expected labels %v, got %v", tt.labels, pod.Labels)
+			}
+			for key := range pod.Annotations {
+				if key != "podpreset.admission.kubernetes.io/clusterinjected-b" {
+					t.Errorf("expected annotation %s to be removed", key)
+				}
+			}
+		})
+	}
+}
+
+func withTestContainers(pod *corev1.Pod, containers ...corev1.Container) *corev1.Pod {
+	pod.Spec.Containers = append(pod.Spec.Containers, containers...)
+	return pod
+}
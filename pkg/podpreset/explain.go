@@ -0,0 +1,97 @@
+package podpreset
+
+import (
+	"fmt"
+
+	redhatcopv1alpha1 "github.com/redhat-cop/podpreset-webhook/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Reasons a pod is excluded from PodPresets.
+const (
+	ExclusionMirrorPod = "MirrorPod"
+	ExclusionOptOut    = "OptOut"
+	ExclusionNamespace = "NamespaceExcluded"
+)
+
+// Reasons a PodPreset is not applied to a pod.
+const (
+	ReasonInvalidSelector                = "InvalidSelector"
+	ReasonSelectorMismatch               = "SelectorMismatch"
+	ReasonNamespaceSelectorMismatch      = "NamespaceSelectorMismatch"
+	ReasonAnnotationSelectorMismatch     = "AnnotationSelectorMismatch"
+	ReasonImageSelectorMismatch          = "ImageSelectorMismatch"
+	ReasonOwnerSelectorMismatch          = "OwnerSelectorMismatch"
+	ReasonServiceAccountSelectorMismatch = "ServiceAccountSelectorMismatch"
+	ReasonExcludedByPod                  = "ExcludedByPod"
+	ReasonShadowed                       = "ShadowedByPodPreset"
+	ReasonAlreadyInjected                = "AlreadyInjected"
+	ReasonSkipped                        = "SkippedOnConflict"
+	ReasonRejected                       = "Rejected"
+)
+
+// PresetExplanation describes whether a PodPreset or ClusterPodPreset applies
+// to a pod.
+type PresetExplanation struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+
+	// Reason is set when the PodPreset is not applied.
+	Reason  string `json:"reason,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// Explanation describes how PodPresets and ClusterPodPresets apply to a pod.
+type Explanation struct {
+	// Excluded is the reason the pod is excluded from PodPresets, if any.
+	Excluded string `json:"excluded,omitempty"`
+
+	Applied    []PresetExplanation `json:"applied,omitempty"`
+	NotApplied []PresetExplanation `json:"notApplied,omitempty"`
+	Conflicts  []string            `json:"conflicts,omitempty"`
+
+	// Rejected describes why the pod is rejected, if it is.
+	Rejected string `json:"rejected,omitempty"`
+
+	// Pod is the pod after injection, or nil when it is excluded or rejected.
+	Pod *corev1.Pod `json:"-"`
+}
+
+// Explain evaluates the PodPresets and ClusterPodPresets for a pod of the given
+// namespace, running as the given ServiceAccount, like the admission webhook
+// does, and explains the outcome. serviceAccount is nil when it is unknown.
+// The given pod is not modified.
+func Explain(pod *corev1.Pod, podPresets redhatcopv1alpha1.PodPresetList, clusterPodPresets redhatcopv1alpha1.ClusterPodPresetList, namespace *corev1.Namespace, serviceAccount *corev1.ServiceAccount, selection NamespaceSelection) *Explanation {
+	explanation := &Explanation{}
+
+	if !selection.Selects(namespace) {
+		explanation.Excluded = ExclusionNamespace
+		return explanation
+	}
+
+	if _, isMirrorPod := pod.Annotations[corev1.MirrorPodAnnotationKey]; isMirrorPod {
+		explanation.Excluded = ExclusionMirrorPod
+		return explanation
+	}
+	if IsOptedOut(pod) {
+		explanation.Excluded = ExclusionOptOut
+		return explanation
+	}
+
+	// the PodPresets with an invalid selector are explained like the others
+	injection, _ := Inject(pod, namespace, serviceAccount, podPresets, clusterPodPresets)
+	explanation.NotApplied = injection.NotApplied
+	explanation.Conflicts = DescribeConflicts(injection.Conflicts)
+
+	if rejection := injection.Rejection; rejection != nil {
+		explanation.Rejected = fmt.Sprintf("%s %s conflicts with pod: %s", Kind(rejection.PodPreset), rejection.PodPreset.GetName(), rejection.Error())
+		return explanation
+	}
+
+	for _, pp := range injection.Applied {
+		explanation.Applied = append(explanation.Applied, PresetExplanation{Kind: Kind(pp), Name: pp.GetName()})
+	}
+	explanation.Pod = injection.Pod
+
+	return explanation
+}
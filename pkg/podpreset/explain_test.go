@@ -0,0 +1,247 @@
+package podpreset
+
+import (
+	"reflect"
+	"testing"
+
+	redhatcopv1alpha1 "github.com/redhat-cop/podpreset-webhook/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestExplain(t *testing.T) {
+	web := map[string]string{"app": "web"}
+
+	tests := []struct {
+		name              string
+		pod               *corev1.Pod
+		namespaceLabels   map[string]string
+		selection         NamespaceSelection
+		podPresets        []redhatcopv1alpha1.PodPreset
+		clusterPodPresets []redhatcopv1alpha1.ClusterPodPreset
+		excluded          string
+		applied           []string
+		// notApplied are the reasons the PodPresets are not applied, by kind
+		// and name
+		notApplied map[string]string
+		rejected   bool
+	}{
+		{
+			name:       "applied",
+			pod:        testPod(web),
+			podPresets: []redhatcopv1alpha1.PodPreset{*testPodPreset("proxy", web)},
+			applied:    []string{"PodPreset/proxy"},
+		},
+		{
+			name:       "mirror pod",
+			pod:        withTestAnnotations(testPod(web), map[string]string{corev1.MirrorPodAnnotationKey: "mirror"}),
+			podPresets: []redhatcopv1alpha1.PodPreset{*testPodPreset("proxy", web)},
+			excluded:   ExclusionMirrorPod,
+		},
+		{
+			name:       "opted out",
+			pod:        withTestAnnotations(testPod(web), map[string]string{corev1.PodPresetOptOutAnnotationKey: "true"}),
+			podPresets: []redhatcopv1alpha1.PodPreset{*testPodPreset("proxy", web)},
+			excluded:   ExclusionOptOut,
+		},
+		{
+			name:            "namespace excluded",
+			pod:             testPod(web),
+			namespaceLabels: map[string]string{NamespaceInjectionLabel: NamespaceInjectionDisabled},
+			podPresets:      []redhatcopv1alpha1.PodPreset{*testPodPreset("proxy", web)},
+			excluded:        ExclusionNamespace,
+		},
+		{
+			name: "invalid selector",
+			pod:  testPod(web),
+			podPresets: []redhatcopv1alpha1.PodPreset{
+				*withTestSelector(testPodPreset("broken", web), metav1.LabelSelectorRequirement{Key: "app", Operator: "Unknown"}),
+				*testPodPreset("proxy", web),
+			},
+			applied:    []string{"PodPreset/proxy"},
+			notApplied: map[string]string{"PodPreset/broken": ReasonInvalidSelector},
+		},
+		{
+			name:       "selector mismatch",
+			pod:        testPod(web),
+			podPresets: []redhatcopv1alpha1.PodPreset{*testPodPreset("db", map[string]string{"app": "db"})},
+			notApplied: map[string]string{"PodPreset/db": ReasonSelectorMismatch},
+		},
+		{
+			name:              "namespace selector mismatch",
+			pod:               testPod(web),
+			clusterPodPresets: []redhatcopv1alpha1.ClusterPodPreset{*testClusterPodPreset("tracing", map[string]string{"tracing": "enabled"}, web)},
+			notApplied:        map[string]string{"ClusterPodPreset/tracing": ReasonNamespaceSelectorMismatch},
+		},
+		{
+			name: "annotation selector mismatch",
+			pod:  testPod(web),
+			podPresets: []redhatcopv1alpha1.PodPreset{*withTestSpec(testPodPreset("sidecar", web), func(spec *redhatcopv1alpha1.PodPresetSpec) {
+				spec.AnnotationSelector = &metav1.LabelSelector{MatchLabels: map[string]string{"example.com/sidecar": "true"}}
+			})},
+			notApplied: map[string]string{"PodPreset/sidecar": ReasonAnnotationSelectorMismatch},
+		},
+		{
+			name: "image selector mismatch",
+			pod:  testPod(web),
+			podPresets: []redhatcopv1alpha1.PodPreset{*withTestSpec(testPodPreset("java", web), func(spec *redhatcopv1alpha1.PodPresetSpec) {
+				spec.ImageSelector = &redhatcopv1alpha1.ImageSelector{Patterns: []string{"openjdk:*"}}
+			})},
+			notApplied: map[string]string{"PodPreset/java": ReasonImageSelectorMismatch},
+		},
+		{
+			name: "owner selector mismatch",
+			pod:  testPod(web),
+			podPresets: []redhatcopv1alpha1.PodPreset{*withTestSpec(testPodPreset("batch", web), func(spec *redhatcopv1alpha1.PodPresetSpec) {
+				spec.OwnerSelector = &redhatcopv1alpha1.OwnerSelector{Include: []redhatcopv1alpha1.WorkloadSelector{{Kind: "Job"}}}
+			})},
+			notApplied: map[string]string{"PodPreset/batch": ReasonOwnerSelectorMismatch},
+		},
+		{
+			name: "service account selector mismatch",
+			pod:  testPod(web),
+			podPresets: []redhatcopv1alpha1.PodPreset{*withTestSpec(testPodPreset("builder", web), func(spec *redhatcopv1alpha1.PodPresetSpec) {
+				spec.ServiceAccountSelector = &redhatcopv1alpha1.ServiceAccountSelector{Names: []string{"builder"}}
+			})},
+			notApplied: map[string]string{"PodPreset/builder": ReasonServiceAccountSelectorMismatch},
+		},
+		{
+			name:       "excluded by pod",
+			pod:        withTestAnnotations(testPod(web), map[string]string{ExcludeAnnotationKey: "proxy, tracing"}),
+			podPresets: []redhatcopv1alpha1.PodPreset{*testPodPreset("proxy", web), *testPodPreset("log-level", web)},
+			applied:    []string{"PodPreset/log-level"},
+			notApplied: map[string]string{"PodPreset/proxy": ReasonExcludedByPod},
+		},
+		{
+			name:              "shadowed by podpreset",
+			pod:               testPod(web),
+			podPresets:        []redhatcopv1alpha1.PodPreset{*testPodPreset("tracing", web)},
+			clusterPodPresets: []redhatcopv1alpha1.ClusterPodPreset{*testClusterPodPreset("tracing", nil, web)},
+			applied:           []string{"PodPreset/tracing"},
+			notApplied:        map[string]string{"ClusterPodPreset/tracing": ReasonShadowed},
+		},
+		{
+			name:              "already injected",
+			pod:               withTestAnnotations(testPod(web), map[string]string{annotationPrefix + "/clusterpodpreset-tracing": "3"}),
+			podPresets:        []redhatcopv1alpha1.PodPreset{*testPodPreset("proxy", web)},
+			clusterPodPresets: []redhatcopv1alpha1.ClusterPodPreset{*testClusterPodPreset("tracing", nil, web)},
+			applied:           []string{"PodPreset/proxy"},
+			notApplied:        map[string]string{"ClusterPodPreset/tracing": ReasonAlreadyInjected},
+		},
+		{
+			name: "skipped on conflict",
+			pod:  testPod(web, corev1.EnvVar{Name: "LOG_LEVEL", Value: "debug"}),
+			podPresets: []redhatcopv1alpha1.PodPreset{
+				*withTestConflictPolicy(testPodPreset("log-level", web, corev1.EnvVar{Name: "LOG_LEVEL", Value: "info"}), redhatcopv1alpha1.ConflictPolicySkipPreset),
+				*testPodPreset("proxy", web),
+			},
+			applied:    []string{"PodPreset/proxy"},
+			notApplied: map[string]string{"PodPreset/log-level": ReasonSkipped},
+		},
+		{
+			name: "rejected",
+			pod:  testPod(web, corev1.EnvVar{Name: "LOG_LEVEL", Value: "debug"}),
+			podPresets: []redhatcopv1alpha1.PodPreset{
+				*withTestConflictPolicy(testPodPreset("log-level", web, corev1.EnvVar{Name: "LOG_LEVEL", Value: "info"}), redhatcopv1alpha1.ConflictPolicyReject),
+				*testPodPreset("proxy", web),
+			},
+			notApplied: map[string]string{"PodPreset/log-level": ReasonRejected, "PodPreset/proxy": ReasonRejected},
+			rejected:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default", Labels: tt.namespaceLabels}}
+			original := tt.pod.DeepCopy()
+
+			explanation := Explain(tt.pod, redhatcopv1alpha1.PodPresetList{Items: tt.podPresets}, redhatcopv1alpha1.ClusterPodPresetList{Items: tt.clusterPodPresets}, namespace, nil, tt.selection)
+
+			if !reflect.DeepEqual(tt.pod, original) {
+				t.Errorf("expected the pod not to be modified")
+			}
+			if explanation.Excluded != tt.excluded {
+				t.Errorf("expected excluded to be %q, got %q", tt.excluded, explanation.Excluded)
+			}
+
+			var applied []string
+			for _, pp := range explanation.Applied {
+				applied = append(applied, pp.Kind+"/"+pp.Name)
+			}
+			if !reflect.DeepEqual(applied, tt.applied) {
+				t.Errorf("expected applied %v, got %v", tt.applied, applied)
+			}
+
+			notApplied := map[string]string{}
+			for _, pp := range explanation.NotApplied {
+				notApplied[pp.Kind+"/"+pp.Name] = pp.Reason
+				if pp.Message == "" {
+					t.Errorf("expected a message explaining why %s %s is not applied", pp.Kind, pp.Name)
+				}
+			}
+			if len(notApplied) != len(tt.notApplied) || (len(notApplied) > 0 && !reflect.DeepEqual(notApplied, tt.notApplied)) {
+				t.Errorf("expected not applied %v, got %v", tt.notApplied, notApplied)
+			}
+
+			if rejected := explanation.Rejected != ""; rejected != tt.rejected {
+				t.Errorf("expected rejected to be %t, got %q", tt.rejected, explanation.Rejected)
+			}
+			if injected := explanation.Pod != nil; injected != (tt.excluded == "" && !tt.rejected) {
+				t.Errorf("expected the injected pod only when the pod is neither excluded nor rejected")
+			}
+		})
+	}
+}
+
+func testPod(lbls map[string]string, envVars ...corev1.EnvVar) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "web-0", Namespace: "default", Labels: lbls},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{Name: "web", Image: "nginx:1.19", Env: envVars}},
+		},
+	}
+}
+
+func withTestAnnotations(pod *corev1.Pod, annotations map[string]string) *corev1.Pod {
+	pod.Annotations = annotations
+	return pod
+}
+
+func testPodPreset(name string, lbls map[string]string, envVars ...corev1.EnvVar) *redhatcopv1alpha1.PodPreset {
+	if len(envVars) == 0 {
+		envVars = []corev1.EnvVar{{Name: name, Value: "true"}}
+	}
+	return &redhatcopv1alpha1.PodPreset{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", ResourceVersion: "3"},
+		Spec: redhatcopv1alpha1.PodPresetSpec{
+			Selector: metav1.LabelSelector{MatchLabels: lbls},
+			Env:      envVars,
+		},
+	}
+}
+
+func testClusterPodPreset(name string, namespaceLabels, lbls map[string]string) *redhatcopv1alpha1.ClusterPodPreset {
+	pp := testPodPreset(name, lbls)
+	return &redhatcopv1alpha1.ClusterPodPreset{
+		ObjectMeta: metav1.ObjectMeta{Name: name, ResourceVersion: pp.ResourceVersion},
+		Spec: redhatcopv1alpha1.ClusterPodPresetSpec{
+			PodPresetSpec:     pp.Spec,
+			NamespaceSelector: metav1.LabelSelector{MatchLabels: namespaceLabels},
+		},
+	}
+}
+
+func withTestSpec(pp *redhatcopv1alpha1.PodPreset, update func(spec *redhatcopv1alpha1.PodPresetSpec)) *redhatcopv1alpha1.PodPreset {
+	update(&pp.Spec)
+	return pp
+}
+
+func withTestSelector(pp *redhatcopv1alpha1.PodPreset, requirements ...metav1.LabelSelectorRequirement) *redhatcopv1alpha1.PodPreset {
+	pp.Spec.Selector.MatchExpressions = requirements
+	return pp
+}
+
+func withTestConflictPolicy(pp *redhatcopv1alpha1.PodPreset, policy redhatcopv1alpha1.ConflictPolicy) *redhatcopv1alpha1.PodPreset {
+	pp.Spec.ConflictPolicy = policy
+	return pp
+}
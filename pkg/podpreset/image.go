@@ -0,0 +1,85 @@
+package podpreset
+
+import (
+	"fmt"
+	"regexp"
+
+	redhatcopv1alpha1 "github.com/redhat-cop/podpreset-webhook/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// ImageMatcher matches the images of containers against the image selector of
+// a PodPreset. A nil ImageMatcher matches every image.
+type ImageMatcher struct {
+	containerSelector *redhatcopv1alpha1.ContainerSelector
+	patterns          []string
+	regexps           []*regexp.Regexp
+}
+
+// NewImageMatcher returns the ImageMatcher of the image selector of the
+// PodPreset, or nil when the PodPreset has no image selector.
+func NewImageMatcher(spec *redhatcopv1alpha1.PodPresetSpec) (*ImageMatcher, error) {
+	if spec.ImageSelector == nil {
+		return nil, nil
+	}
+
+	m := &ImageMatcher{
+		containerSelector: spec.ContainerSelector,
+		patterns:          spec.ImageSelector.Patterns,
+	}
+	for _, expr := range spec.ImageSelector.Regexps {
+		re, err := CompileImageRegexp(expr)
+		if err != nil {
+			return nil, err
+		}
+		m.regexps = append(m.regexps, re)
+	}
+	return m, nil
+}
+
+// CompileImageRegexp compiles a regular expression of an image selector, which
+// has to match the whole image.
+func CompileImageRegexp(expr string) (*regexp.Regexp, error) {
+	re, err := regexp.Compile(fmt.Sprintf("^(?:%s)$", expr))
+	if err != nil {
+		return nil, fmt.Errorf("invalid image regexp %q: %v", expr, err)
+	}
+	return re, nil
+}
+
+// Matches returns whether the image matches one of the patterns or regular
+// expressions. Every image matches when there are none.
+func (m *ImageMatcher) Matches(image string) bool {
+	if m == nil || len(m.patterns)+len(m.regexps) == 0 {
+		return true
+	}
+	if matchesAnyName(m.patterns, image) {
+		return true
+	}
+	for _, re := range m.regexps {
+		if re.MatchString(image) {
+			return true
+		}
+	}
+	return false
+}
+
+// SelectsPod returns whether one of the containers or init containers of the
+// pod selected by the container selector of the PodPreset runs a matching
+// image.
+func (m *ImageMatcher) SelectsPod(pod *corev1.Pod) bool {
+	if m == nil {
+		return true
+	}
+	for _, ctr := range pod.Spec.Containers {
+		if selectsContainer(m.containerSelector, ctr.Name, containerKindRegular) && m.Matches(ctr.Image) {
+			return true
+		}
+	}
+	for _, ctr := range pod.Spec.InitContainers {
+		if selectsContainer(m.containerSelector, ctr.Name, containerKindInit) && m.Matches(ctr.Image) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,141 @@
+package podpreset
+
+import (
+	"testing"
+
+	redhatcopv1alpha1 "github.com/redhat-cop/podpreset-webhook/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestNewImageMatcher(t *testing.T) {
+	tests := []struct {
+		name     string
+		selector *redhatcopv1alpha1.ImageSelector
+		isNil    bool
+		err      bool
+	}{
+		{name: "no image selector", isNil: true},
+		{name: "empty image selector", selector: &redhatcopv1alpha1.ImageSelector{}},
+		{name: "valid regexp", selector: &redhatcopv1alpha1.ImageSelector{Regexps: []string{"registry.corp/.+"}}},
+		{name: "invalid regexp", selector: &redhatcopv1alpha1.ImageSelector{Regexps: []string{"registry.corp/(java"}}, isNil: true, err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := NewImageMatcher(&redhatcopv1alpha1.PodPresetSpec{ImageSelector: tt.selector})
+			if (err != nil) != tt.err {
+				t.Fatalf("expected error %v, got %v", tt.err, err)
+			}
+			if (m == nil) != tt.isNil {
+				t.Errorf("expected nil matcher %v, got %v", tt.isNil, m)
+			}
+		})
+	}
+}
+
+func TestImageMatcherMatches(t *testing.T) {
+	tests := []struct {
+		name     string
+		selector *redhatcopv1alpha1.ImageSelector
+		image    string
+		expected bool
+	}{
+		{name: "nil matcher", image: "nginx:1.19", expected: true},
+		{name: "empty selector", selector: &redhatcopv1alpha1.ImageSelector{}, image: "nginx:1.19", expected: true},
+		{name: "pattern", selector: &redhatcopv1alpha1.ImageSelector{Patterns: []string{"registry.corp/java-*"}}, image: "registry.corp/java-11:latest", expected: true},
+		{name: "pattern mismatch", selector: &redhatcopv1alpha1.ImageSelector{Patterns: []string{"registry.corp/java-*"}}, image: "registry.corp/python-3", expected: false},
+		{name: "pattern star across slash", selector: &redhatcopv1alpha1.ImageSelector{Patterns: []string{"registry.corp/*"}}, image: "registry.corp/team/java-11", expected: false},
+		{name: "regexp", selector: &redhatcopv1alpha1.ImageSelector{Regexps: []string{"registry.corp/.+/java-.*"}}, image: "registry.corp/team/java-11", expected: true},
+		{name: "regexp anchored at start", selector: &redhatcopv1alpha1.ImageSelector{Regexps: []string{"registry.corp/.+"}}, image: "mirror/registry.corp/java", expected: false},
+		{name: "regexp anchored at end", selector: &redhatcopv1alpha1.ImageSelector{Regexps: []string{"registry.corp/java"}}, image: "registry.corp/java:11", expected: false},
+		{name: "regexp alternation anchored", selector: &redhatcopv1alpha1.ImageSelector{Regexps: []string{"nginx|java"}}, image: "nginx-unprivileged", expected: false},
+		{name: "pattern or regexp", selector: &redhatcopv1alpha1.ImageSelector{Patterns: []string{"nginx:*"}, Regexps: []string{"java"}}, image: "nginx:1.19", expected: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := NewImageMatcher(&redhatcopv1alpha1.PodPresetSpec{ImageSelector: tt.selector})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if matched := m.Matches(tt.image); matched != tt.expected {
+				t.Errorf("expected matched %v, got %v", tt.expected, matched)
+			}
+		})
+	}
+}
+
+func TestImageMatcherSelectsPod(t *testing.T) {
+	java := &redhatcopv1alpha1.ImageSelector{Patterns: []string{"java:*"}}
+	noInit := false
+
+	tests := []struct {
+		name              string
+		containerSelector *redhatcopv1alpha1.ContainerSelector
+		containers        []corev1.Container
+		initContainers    []corev1.Container
+		expected          bool
+	}{
+		{
+			name:       "container",
+			containers: []corev1.Container{{Name: "web", Image: "nginx:1.19"}, {Name: "app", Image: "java:11"}},
+			expected:   true,
+		},
+		{
+			name:       "no matching container",
+			containers: []corev1.Container{{Name: "web", Image: "nginx:1.19"}},
+			expected:   false,
+		},
+		{
+			name:           "init container",
+			containers:     []corev1.Container{{Name: "web", Image: "nginx:1.19"}},
+			initContainers: []corev1.Container{{Name: "migrate", Image: "java:11"}},
+			expected:       true,
+		},
+		{
+			name:              "init containers not selected",
+			containerSelector: &redhatcopv1alpha1.ContainerSelector{InitContainers: &noInit},
+			containers:        []corev1.Container{{Name: "web", Image: "nginx:1.19"}},
+			initContainers:    []corev1.Container{{Name: "migrate", Image: "java:11"}},
+			expected:          false,
+		},
+		{
+			name:              "included container",
+			containerSelector: &redhatcopv1alpha1.ContainerSelector{Include: []string{"app"}},
+			containers:        []corev1.Container{{Name: "app", Image: "java:11"}},
+			expected:          true,
+		},
+		{
+			name:              "matching container not included",
+			containerSelector: &redhatcopv1alpha1.ContainerSelector{Include: []string{"web"}},
+			containers:        []corev1.Container{{Name: "web", Image: "nginx:1.19"}, {Name: "app", Image: "java:11"}},
+			expected:          false,
+		},
+		{
+			name:              "matching container excluded",
+			containerSelector: &redhatcopv1alpha1.ContainerSelector{Exclude: []string{"app*"}},
+			containers:        []corev1.Container{{Name: "web", Image: "nginx:1.19"}, {Name: "app", Image: "java:11"}},
+			expected:          false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := NewImageMatcher(&redhatcopv1alpha1.PodPresetSpec{ImageSelector: java, ContainerSelector: tt.containerSelector})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			pod := &corev1.Pod{Spec: corev1.PodSpec{Containers: tt.containers, InitContainers: tt.initContainers}}
+			if selected := m.SelectsPod(pod); selected != tt.expected {
+				t.Errorf("expected selected %v, got %v", tt.expected, selected)
+			}
+		})
+	}
+
+	t.Run("nil matcher", func(t *testing.T) {
+		var m *ImageMatcher
+		if !m.SelectsPod(&corev1.Pod{}) {
+			t.Errorf("expected a nil matcher to select every pod")
+		}
+	})
+}
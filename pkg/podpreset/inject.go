@@ -0,0 +1,158 @@
+package podpreset
+
+import (
+	"fmt"
+
+	redhatcopv1alpha1 "github.com/redhat-cop/podpreset-webhook/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+// Injection is the outcome of the injection of PodPresets and
+// ClusterPodPresets into a pod.
+type Injection struct {
+	// Candidates are the PodPresets and ClusterPodPresets selecting the pod
+	// which have not been injected into it yet, in the order they are
+	// applied.
+	Candidates []*redhatcopv1alpha1.PodPreset
+
+	// Applied are the candidates injected into the pod.
+	Applied []*redhatcopv1alpha1.PodPreset
+
+	// NotApplied explains why the other PodPresets and ClusterPodPresets are
+	// not injected into the pod.
+	NotApplied []PresetExplanation
+
+	Conflicts []*Conflict
+
+	// Rejection is the conflict rejecting the pod, if any. The pod is then
+	// not injected.
+	Rejection *Conflict
+
+	// Warnings describe the PodPresets skipped because of an invalid selector
+	// and the conflicts.
+	Warnings []string
+
+	// Pod is the pod after injection, or nil when it is rejected.
+	Pod *corev1.Pod
+}
+
+// Inject injects the PodPresets and ClusterPodPresets selecting the pod of the
+// given namespace, running as the given ServiceAccount, like the admission
+// webhook does. serviceAccount is nil when it is unknown. The given pod is not
+// modified. The entries injected by an earlier version of a PodPreset are
+// removed before its current version is injected.
+//
+// The returned error reports the PodPresets with an invalid selector, which do
+// not prevent the injection of the others: the injection is returned in any
+// case.
+func Inject(pod *corev1.Pod, namespace *corev1.Namespace, serviceAccount *corev1.ServiceAccount, podPresets redhatcopv1alpha1.PodPresetList, clusterPodPresets redhatcopv1alpha1.ClusterPodPresetList) (*Injection, error) {
+	injection := &Injection{}
+	var errs []error
+
+	notApplied := func(pp *redhatcopv1alpha1.PodPreset, reason, format string, args ...interface{}) {
+		injection.NotApplied = append(injection.NotApplied, PresetExplanation{
+			Kind:    Kind(pp),
+			Name:    pp.GetName(),
+			Reason:  reason,
+			Message: fmt.Sprintf(format, args...),
+		})
+	}
+	skipped := func(pp *redhatcopv1alpha1.PodPreset, err error) {
+		err = fmt.Errorf("%s %s skipped: %v", Kind(pp), pp.GetName(), err)
+		injection.Warnings = append(injection.Warnings, err.Error())
+		errs = append(errs, err)
+	}
+
+	var matchingPPs []*redhatcopv1alpha1.PodPreset
+	for i := range podPresets.Items {
+		// take the address of the item rather than of the loop variable, which
+		// is reused by every iteration
+		pp := &podPresets.Items[i]
+		selected, mismatch, err := Selects(pp, pod, serviceAccount)
+		if err != nil {
+			skipped(pp, err)
+		}
+		if !selected {
+			notApplied(pp, mismatch.Reason, "%s", mismatch.Message)
+			continue
+		}
+		matchingPPs = append(matchingPPs, pp)
+	}
+
+	var matchingCPPs []*redhatcopv1alpha1.PodPreset
+	for i := range clusterPodPresets.Items {
+		cpp := FromClusterPodPreset(&clusterPodPresets.Items[i])
+		selected, mismatch, err := SelectsClusterPodPreset(&clusterPodPresets.Items[i], pod, namespace, serviceAccount)
+		if err != nil {
+			skipped(cpp, err)
+		}
+		if !selected {
+			notApplied(cpp, mismatch.Reason, "%s", mismatch.Message)
+			continue
+		}
+		matchingCPPs = append(matchingCPPs, cpp)
+	}
+
+	merged := MergeClusterPodPresets(matchingCPPs, matchingPPs)
+	if len(merged) < len(matchingCPPs)+len(matchingPPs) {
+		for _, cpp := range matchingCPPs {
+			if !containsPodPreset(merged, cpp) {
+				notApplied(cpp, ReasonShadowed, "PodPreset %s of namespace %s has the same name", cpp.GetName(), namespace.GetName())
+			}
+		}
+	}
+
+	// skip the PodPresets already injected into the template of the workload
+	injection.Candidates = WithoutInjected(pod, merged)
+	for _, pp := range merged {
+		if !containsPodPreset(injection.Candidates, pp) {
+			notApplied(pp, ReasonAlreadyInjected, "the pod template has been injected with the current version of the %s already", Kind(pp))
+		}
+	}
+
+	// undo the injection of an earlier version of the candidates, whose values
+	// would otherwise conflict with the values of the current version
+	base := pod.DeepCopy()
+	for _, pp := range injection.Candidates {
+		if _, ok := pod.Annotations[AnnotationKey(pp)]; ok {
+			undoInjection(base, pp)
+		}
+	}
+
+	// detect merge conflicts and resolve them according to the conflict policy
+	// of each PodPreset
+	applied, conflicts, rejection := ResolveConflicts(base, injection.Candidates)
+	injection.Conflicts = conflicts
+	injection.Warnings = append(injection.Warnings, DescribeConflicts(conflicts)...)
+
+	if rejection != nil {
+		injection.Rejection = rejection
+		for _, pp := range injection.Candidates {
+			notApplied(pp, ReasonRejected, "the pod is rejected")
+		}
+		return injection, utilerrors.NewAggregate(errs)
+	}
+
+	for _, pp := range injection.Candidates {
+		if !containsPodPreset(applied, pp) {
+			notApplied(pp, ReasonSkipped, "the PodPreset conflicts with the pod and its conflict policy is %s", pp.Spec.GetConflictPolicy())
+		}
+	}
+	injection.Applied = applied
+
+	injection.Pod = base
+	Apply(injection.Pod, applied)
+	AnnotateConflicts(injection.Pod, conflicts)
+
+	return injection, utilerrors.NewAggregate(errs)
+}
+
+func containsPodPreset(podPresets []*redhatcopv1alpha1.PodPreset, pp *redhatcopv1alpha1.PodPreset) bool {
+	for _, p := range podPresets {
+		if p == pp {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,827 @@
+package podpreset
+
+import (
+	"fmt"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+
+	redhatcopv1alpha1 "github.com/redhat-cop/podpreset-webhook/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+// safeToApplyPodPresetsOnPod determines if there is any conflict in information
+// injected by given PodPresets in the Pod, rendering their templates with r.
+// Conflicts are attributed to the given PodPresets rather than their rendered
+// copies.
+func safeToApplyPodPresetsOnPod(pod *corev1.Pod, podPresets []*redhatcopv1alpha1.PodPreset, r *renderer) error {
+	var errs []error
+
+	podPresets, err := r.renderPod(podPresets)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	// volumes attribute is defined at the Pod level, so determine if volumes
+	// injection is causing any conflict.
+	if _, err := mergeLabels(pod.Labels, podPresets); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := mergeAnnotations(pod.Annotations, podPresets); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := mergeVolumes(pod.Spec.Volumes, podPresets); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := mergeTolerations(pod.Spec.Tolerations, podPresets); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := mergeNodeSelector(pod.Spec.NodeSelector, podPresets); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := mergeAffinity(pod.Spec.Affinity, podPresets); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := mergeTopologySpreadConstraints(pod.Spec.TopologySpreadConstraints, podPresets); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := mergeContainers(pod.Spec.Containers, podPresets); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := mergeInitContainers(pod.Spec.InitContainers, podPresets); err != nil {
+		errs = append(errs, err)
+	}
+
+	injected := injectedContainerNames(podPresets)
+	for i := range pod.Spec.Containers {
+		ctr := &pod.Spec.Containers[i]
+		if injected[ctr.Name] {
+			continue
+		}
+		if err := safeToApplyPodPresetsOnContainer(ctr, podPresetsForContainer(podPresets, ctr.Name, ctr.Image, containerKindRegular), r); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for i := range pod.Spec.InitContainers {
+		ctr := &pod.Spec.InitContainers[i]
+		if injected[ctr.Name] {
+			continue
+		}
+		if err := safeToApplyPodPresetsOnContainer(ctr, podPresetsForContainer(podPresets, ctr.Name, ctr.Image, containerKindInit), r); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for i := range pod.Spec.EphemeralContainers {
+		ctr := corev1.Container(pod.Spec.EphemeralContainers[i].EphemeralContainerCommon)
+		if err := safeToApplyPodPresetsOnContainer(&ctr, podPresetsForContainer(podPresets, ctr.Name, ctr.Image, containerKindEphemeral), r); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return r.restoreOrigins(utilerrors.NewAggregate(errs))
+}
+
+// safeToApplyPodPresetsOnContainer determines if there is any conflict in
+// information injected by given PodPresets in the given container, rendering
+// their templates with r.
+func safeToApplyPodPresetsOnContainer(ctr *corev1.Container, podPresets []*redhatcopv1alpha1.PodPreset, r *renderer) error {
+	var errs []error
+
+	podPresets, err := r.renderContainer(podPresets, ctr)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	// check if it is safe to merge env vars and volume mounts from given podpresets and
+	// container's existing env vars.
+	if _, err := mergeEnv(ctr.Env, podPresets); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := mergeEnvFrom(ctr.EnvFrom, podPresets); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := mergeVolumeMounts(ctr.VolumeMounts, podPresets); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := mergeResources(ctr.Resources, podPresets); err != nil {
+		errs = append(errs, err)
+	}
+
+	return utilerrors.NewAggregate(errs)
+}
+
+// mergeEnv merges a list of env vars with the env vars injected by given list podPresets.
+// It returns an error describing every conflict detected during the merge. Conflicting
+// env vars are replaced when the conflict policy of the PodPreset is Override.
+func mergeEnv(envVars []corev1.EnvVar, podPresets []*redhatcopv1alpha1.PodPreset) ([]corev1.EnvVar, error) {
+	origEnv := map[string]int{}
+	for i, v := range envVars {
+		origEnv[v.Name] = i
+	}
+
+	mergedEnv := make([]corev1.EnvVar, len(envVars))
+	copy(mergedEnv, envVars)
+
+	var errs []error
+
+	for _, pp := range podPresets {
+		for _, v := range pp.Spec.Env {
+			i, ok := origEnv[v.Name]
+			if !ok {
+				// if we don't already have it append it and continue
+				origEnv[v.Name] = len(mergedEnv)
+				mergedEnv = append(mergedEnv, v)
+				continue
+			}
+
+			// make sure they are identical or throw an error
+			if found := mergedEnv[i]; !reflect.DeepEqual(found, v) {
+				errs = append(errs, newConflict(pp, ConflictFieldEnv, v.Name, "merging env for %s has a conflict on %s: \n%#v\ndoes not match\n%#v\n in container", pp.GetName(), v.Name, v, found))
+				if pp.Spec.GetConflictPolicy() == redhatcopv1alpha1.ConflictPolicyOverride {
+					mergedEnv[i] = v
+				}
+			}
+		}
+	}
+
+	return mergedEnv, utilerrors.NewAggregate(errs)
+}
+
+type envFromMergeKey struct {
+	prefix           string
+	configMapRefName string
+	secretRefName    string
+}
+
+func newEnvFromMergeKey(e corev1.EnvFromSource) envFromMergeKey {
+	k := envFromMergeKey{prefix: e.Prefix}
+	if e.ConfigMapRef != nil {
+		k.configMapRefName = e.ConfigMapRef.Name
+	}
+	if e.SecretRef != nil {
+		k.secretRefName = e.SecretRef.Name
+	}
+	return k
+}
+
+// String returns a human readable representation of the merge key.
+func (k envFromMergeKey) String() string {
+	var refs []string
+	if k.configMapRefName != "" {
+		refs = append(refs, "configMap "+k.configMapRefName)
+	}
+	if k.secretRefName != "" {
+		refs = append(refs, "secret "+k.secretRefName)
+	}
+	if k.prefix != "" {
+		refs = append(refs, "prefix "+k.prefix)
+	}
+	return strings.Join(refs, ", ")
+}
+
+// mergeEnvFrom merges a list of env sources with the env sources injected by
+// given podPresets. It returns an error describing every conflict detected
+// during the merge. Conflicting env sources are replaced when the conflict
+// policy of the PodPreset is Override.
+func mergeEnvFrom(envSources []corev1.EnvFromSource, podPresets []*redhatcopv1alpha1.PodPreset) ([]corev1.EnvFromSource, error) {
+	var mergedEnvFrom []corev1.EnvFromSource
+
+	// merge envFrom using a identify key to ensure Admit reinvocations are idempotent
+	origEnvSources := map[envFromMergeKey]int{}
+	for i, envSource := range envSources {
+		origEnvSources[newEnvFromMergeKey(envSource)] = i
+	}
+	mergedEnvFrom = append(mergedEnvFrom, envSources...)
+	var errs []error
+	for _, pp := range podPresets {
+		for _, envFromSource := range pp.Spec.EnvFrom {
+			key := newEnvFromMergeKey(envFromSource)
+			i, ok := origEnvSources[key]
+			if !ok {
+				origEnvSources[key] = len(mergedEnvFrom)
+				mergedEnvFrom = append(mergedEnvFrom, envFromSource)
+				continue
+			}
+			if found := mergedEnvFrom[i]; !reflect.DeepEqual(found, envFromSource) {
+				errs = append(errs, newConflict(pp, ConflictFieldEnvFrom, key.String(), "merging envFrom for %s has a conflict: \n%#v\ndoes not match\n%#v\n in container", pp.GetName(), envFromSource, found))
+				if pp.Spec.GetConflictPolicy() == redhatcopv1alpha1.ConflictPolicyOverride {
+					mergedEnvFrom[i] = envFromSource
+				}
+			}
+		}
+	}
+
+	return mergedEnvFrom, utilerrors.NewAggregate(errs)
+}
+
+// mergeVolumeMounts merges given list of VolumeMounts with the volumeMounts
+// injected by given podPresets. It returns an error describing every conflict
+// detected during the merge. Conflicting volume mounts are replaced when the
+// conflict policy of the PodPreset is Override.
+func mergeVolumeMounts(volumeMounts []corev1.VolumeMount, podPresets []*redhatcopv1alpha1.PodPreset) ([]corev1.VolumeMount, error) {
+	origVolumeMounts := map[string]corev1.VolumeMount{}
+	volumeMountsByPath := map[string]corev1.VolumeMount{}
+	for _, v := range volumeMounts {
+		origVolumeMounts[v.Name] = v
+		volumeMountsByPath[v.MountPath] = v
+	}
+
+	mergedVolumeMounts := make([]corev1.VolumeMount, len(volumeMounts))
+	copy(mergedVolumeMounts, volumeMounts)
+
+	var errs []error
+
+	for _, pp := range podPresets {
+		for _, v := range pp.Spec.VolumeMounts {
+			var conflicts []error
+
+			// make sure they are identical or throw an error
+			// shall we throw an error for identical volumeMounts ?
+			found, ok := origVolumeMounts[v.Name]
+			if ok && !reflect.DeepEqual(found, v) {
+				conflicts = append(conflicts, newConflict(pp, ConflictFieldVolumeMount, v.Name, "merging volume mounts for %s has a conflict on %s: \n%#v\ndoes not match\n%#v\n in container", pp.GetName(), v.Name, v, found))
+			}
+			foundByPath, okByPath := volumeMountsByPath[v.MountPath]
+			if okByPath && !reflect.DeepEqual(foundByPath, v) {
+				conflicts = append(conflicts, newConflict(pp, ConflictFieldVolumeMount, v.MountPath, "merging volume mounts for %s has a conflict on mount path %s: \n%#v\ndoes not match\n%#v\n in container", pp.GetName(), v.MountPath, v, foundByPath))
+			}
+
+			if len(conflicts) == 0 {
+				if !ok {
+					// if we don't already have it append it and continue
+					origVolumeMounts[v.Name] = v
+					volumeMountsByPath[v.MountPath] = v
+					mergedVolumeMounts = append(mergedVolumeMounts, v)
+				}
+				continue
+			}
+
+			errs = append(errs, conflicts...)
+			if pp.Spec.GetConflictPolicy() != redhatcopv1alpha1.ConflictPolicyOverride {
+				continue
+			}
+
+			// replace every volume mount sharing the name or the mount path
+			var overridden []corev1.VolumeMount
+			for _, m := range mergedVolumeMounts {
+				if m.Name == v.Name || m.MountPath == v.MountPath {
+					delete(origVolumeMounts, m.Name)
+					delete(volumeMountsByPath, m.MountPath)
+					continue
+				}
+				overridden = append(overridden, m)
+			}
+			origVolumeMounts[v.Name] = v
+			volumeMountsByPath[v.MountPath] = v
+			mergedVolumeMounts = append(overridden, v)
+		}
+	}
+
+	return mergedVolumeMounts, utilerrors.NewAggregate(errs)
+}
+
+// mergeVolumes merges given list of Volumes with the volumes injected by given
+// podPresets. It returns an error describing every conflict detected during the
+// merge. Conflicting volumes are replaced when the conflict policy of the
+// PodPreset is Override.
+func mergeVolumes(volumes []corev1.Volume, podPresets []*redhatcopv1alpha1.PodPreset) ([]corev1.Volume, error) {
+	origVolumes := map[string]int{}
+	for i, v := range volumes {
+		origVolumes[v.Name] = i
+	}
+
+	mergedVolumes := make([]corev1.Volume, len(volumes))
+	copy(mergedVolumes, volumes)
+
+	var errs []error
+
+	for _, pp := range podPresets {
+		for _, v := range pp.Spec.Volumes {
+			i, ok := origVolumes[v.Name]
+			if !ok {
+				// if we don't already have it append it and continue
+				origVolumes[v.Name] = len(mergedVolumes)
+				mergedVolumes = append(mergedVolumes, v)
+				continue
+			}
+
+			// make sure they are identical or throw an error
+			if found := mergedVolumes[i]; !reflect.DeepEqual(found, v) {
+				errs = append(errs, newConflict(pp, ConflictFieldVolume, v.Name, "merging volumes for %s has a conflict on %s: \n%#v\ndoes not match\n%#v\n in container", pp.GetName(), v.Name, v, found))
+				if pp.Spec.GetConflictPolicy() == redhatcopv1alpha1.ConflictPolicyOverride {
+					mergedVolumes[i] = v
+				}
+			}
+		}
+	}
+
+	if len(mergedVolumes) == 0 {
+		return nil, utilerrors.NewAggregate(errs)
+	}
+
+	return mergedVolumes, utilerrors.NewAggregate(errs)
+}
+
+type tolerationMergeKey struct {
+	key    string
+	effect corev1.TaintEffect
+}
+
+// String returns a human readable representation of the merge key.
+func (k tolerationMergeKey) String() string {
+	key := k.key
+	if key == "" {
+		key = "*"
+	}
+	if k.effect == "" {
+		return key
+	}
+	return fmt.Sprintf("%s:%s", key, k.effect)
+}
+
+// mergeTolerations merges given list of Tolerations with the tolerations
+// injected by given podPresets, using the key and effect of a toleration as
+// its identity. It returns an error describing every conflict detected during
+// the merge. Conflicting tolerations are replaced when the conflict policy of
+// the PodPreset is Override.
+func mergeTolerations(tolerations []corev1.Toleration, podPresets []*redhatcopv1alpha1.PodPreset) ([]corev1.Toleration, error) {
+	origTolerations := map[tolerationMergeKey]int{}
+	for i, t := range tolerations {
+		origTolerations[tolerationMergeKey{key: t.Key, effect: t.Effect}] = i
+	}
+
+	mergedTolerations := make([]corev1.Toleration, len(tolerations))
+	copy(mergedTolerations, tolerations)
+
+	var errs []error
+
+	for _, pp := range podPresets {
+		for _, t := range pp.Spec.Tolerations {
+			key := tolerationMergeKey{key: t.Key, effect: t.Effect}
+			i, ok := origTolerations[key]
+			if !ok {
+				// if we don't already have it append it and continue
+				origTolerations[key] = len(mergedTolerations)
+				mergedTolerations = append(mergedTolerations, t)
+				continue
+			}
+
+			// make sure they are identical or throw an error
+			if found := mergedTolerations[i]; !reflect.DeepEqual(found, t) {
+				errs = append(errs, newConflict(pp, ConflictFieldToleration, key.String(), "merging tolerations for %s has a conflict on %s: \n%#v\ndoes not match\n%#v\n in pod", pp.GetName(), key, t, found))
+				if pp.Spec.GetConflictPolicy() == redhatcopv1alpha1.ConflictPolicyOverride {
+					mergedTolerations[i] = t
+				}
+			}
+		}
+	}
+
+	if len(mergedTolerations) == 0 {
+		return nil, utilerrors.NewAggregate(errs)
+	}
+
+	return mergedTolerations, utilerrors.NewAggregate(errs)
+}
+
+// mergeNodeSelector merges given node selector with the node selectors
+// injected by given podPresets. It returns an error describing every conflict
+// detected during the merge. Conflicting keys are replaced when the conflict
+// policy of the PodPreset is Override.
+func mergeNodeSelector(nodeSelector map[string]string, podPresets []*redhatcopv1alpha1.PodPreset) (map[string]string, error) {
+	return mergeStringMap(nodeSelector, podPresets, ConflictFieldNodeSelector, func(pp *redhatcopv1alpha1.PodPreset) map[string]string {
+		return pp.Spec.NodeSelector
+	})
+}
+
+// mergeLabels merges given pod labels with the labels injected by given
+// podPresets. It returns an error describing every conflict detected during
+// the merge. Conflicting labels are replaced when the conflict policy of the
+// PodPreset is Override.
+func mergeLabels(labels map[string]string, podPresets []*redhatcopv1alpha1.PodPreset) (map[string]string, error) {
+	return mergeStringMap(labels, podPresets, ConflictFieldLabel, func(pp *redhatcopv1alpha1.PodPreset) map[string]string {
+		return pp.Spec.Labels
+	})
+}
+
+// mergeAnnotations merges given pod annotations with the annotations injected
+// by given podPresets. It returns an error describing every conflict detected
+// during the merge. Conflicting annotations are replaced when the conflict
+// policy of the PodPreset is Override.
+func mergeAnnotations(annotations map[string]string, podPresets []*redhatcopv1alpha1.PodPreset) (map[string]string, error) {
+	return mergeStringMap(annotations, podPresets, ConflictFieldAnnotation, func(pp *redhatcopv1alpha1.PodPreset) map[string]string {
+		return pp.Spec.Annotations
+	})
+}
+
+// mergeStringMap merges m with the entries returned for each podPreset by
+// injected.
+func mergeStringMap(m map[string]string, podPresets []*redhatcopv1alpha1.PodPreset, field string, injected func(*redhatcopv1alpha1.PodPreset) map[string]string) (map[string]string, error) {
+	var merged map[string]string
+	if m != nil {
+		merged = make(map[string]string, len(m))
+		for k, v := range m {
+			merged[k] = v
+		}
+	}
+
+	var errs []error
+
+	for _, pp := range podPresets {
+		entries := injected(pp)
+
+		// iterate in key order so that conflicts are reported consistently
+		keys := make([]string, 0, len(entries))
+		for k := range entries {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			v := entries[k]
+			found, ok := merged[k]
+			if !ok {
+				if merged == nil {
+					merged = map[string]string{}
+				}
+				merged[k] = v
+				continue
+			}
+
+			if found != v {
+				errs = append(errs, newConflict(pp, field, k, "merging %s for %s has a conflict on %s: %q does not match %q in pod", field, pp.GetName(), k, v, found))
+				if pp.Spec.GetConflictPolicy() == redhatcopv1alpha1.ConflictPolicyOverride {
+					merged[k] = v
+				}
+			}
+		}
+	}
+
+	return merged, utilerrors.NewAggregate(errs)
+}
+
+// mergeAffinity merges given affinity with the affinity injected by given
+// podPresets. Node affinity, pod affinity and pod anti-affinity are each
+// merged as a whole: a podPreset sets them when the pod does not define them
+// and otherwise conflicts unless they are identical. Conflicting affinities
+// are replaced when the conflict policy of the PodPreset is Override.
+func mergeAffinity(affinity *corev1.Affinity, podPresets []*redhatcopv1alpha1.PodPreset) (*corev1.Affinity, error) {
+	mergedAffinity := affinity.DeepCopy()
+
+	var errs []error
+
+	for _, pp := range podPresets {
+		if pp.Spec.Affinity == nil {
+			continue
+		}
+		if mergedAffinity == nil {
+			mergedAffinity = &corev1.Affinity{}
+		}
+
+		override := pp.Spec.GetConflictPolicy() == redhatcopv1alpha1.ConflictPolicyOverride
+
+		if v := pp.Spec.Affinity.NodeAffinity; v != nil {
+			switch found := mergedAffinity.NodeAffinity; {
+			case found == nil:
+				mergedAffinity.NodeAffinity = v.DeepCopy()
+			case !reflect.DeepEqual(found, v):
+				errs = append(errs, newConflict(pp, ConflictFieldAffinity, "nodeAffinity", "merging affinity for %s has a conflict on nodeAffinity: \n%#v\ndoes not match\n%#v\n in pod", pp.GetName(), v, found))
+				if override {
+					mergedAffinity.NodeAffinity = v.DeepCopy()
+				}
+			}
+		}
+		if v := pp.Spec.Affinity.PodAffinity; v != nil {
+			switch found := mergedAffinity.PodAffinity; {
+			case found == nil:
+				mergedAffinity.PodAffinity = v.DeepCopy()
+			case !reflect.DeepEqual(found, v):
+				errs = append(errs, newConflict(pp, ConflictFieldAffinity, "podAffinity", "merging affinity for %s has a conflict on podAffinity: \n%#v\ndoes not match\n%#v\n in pod", pp.GetName(), v, found))
+				if override {
+					mergedAffinity.PodAffinity = v.DeepCopy()
+				}
+			}
+		}
+		if v := pp.Spec.Affinity.PodAntiAffinity; v != nil {
+			switch found := mergedAffinity.PodAntiAffinity; {
+			case found == nil:
+				mergedAffinity.PodAntiAffinity = v.DeepCopy()
+			case !reflect.DeepEqual(found, v):
+				errs = append(errs, newConflict(pp, ConflictFieldAffinity, "podAntiAffinity", "merging affinity for %s has a conflict on podAntiAffinity: \n%#v\ndoes not match\n%#v\n in pod", pp.GetName(), v, found))
+				if override {
+					mergedAffinity.PodAntiAffinity = v.DeepCopy()
+				}
+			}
+		}
+	}
+
+	return mergedAffinity, utilerrors.NewAggregate(errs)
+}
+
+type topologySpreadConstraintMergeKey struct {
+	topologyKey       string
+	whenUnsatisfiable corev1.UnsatisfiableConstraintAction
+}
+
+// String returns a human readable representation of the merge key.
+func (k topologySpreadConstraintMergeKey) String() string {
+	return fmt.Sprintf("%s:%s", k.topologyKey, k.whenUnsatisfiable)
+}
+
+// mergeTopologySpreadConstraints merges given list of TopologySpreadConstraints
+// with the constraints injected by given podPresets, using the topology key
+// and unsatisfiable action of a constraint as its identity. It returns an
+// error describing every conflict detected during the merge. Conflicting
+// constraints are replaced when the conflict policy of the PodPreset is
+// Override.
+func mergeTopologySpreadConstraints(constraints []corev1.TopologySpreadConstraint, podPresets []*redhatcopv1alpha1.PodPreset) ([]corev1.TopologySpreadConstraint, error) {
+	origConstraints := map[topologySpreadConstraintMergeKey]int{}
+	for i, c := range constraints {
+		origConstraints[topologySpreadConstraintMergeKey{topologyKey: c.TopologyKey, whenUnsatisfiable: c.WhenUnsatisfiable}] = i
+	}
+
+	mergedConstraints := make([]corev1.TopologySpreadConstraint, len(constraints))
+	copy(mergedConstraints, constraints)
+
+	var errs []error
+
+	for _, pp := range podPresets {
+		for _, c := range pp.Spec.TopologySpreadConstraints {
+			key := topologySpreadConstraintMergeKey{topologyKey: c.TopologyKey, whenUnsatisfiable: c.WhenUnsatisfiable}
+			i, ok := origConstraints[key]
+			if !ok {
+				// if we don't already have it append it and continue
+				origConstraints[key] = len(mergedConstraints)
+				mergedConstraints = append(mergedConstraints, c)
+				continue
+			}
+
+			// make sure they are identical or throw an error
+			if found := mergedConstraints[i]; !reflect.DeepEqual(found, c) {
+				errs = append(errs, newConflict(pp, ConflictFieldTopologySpreadConstraint, key.String(), "merging topology spread constraints for %s has a conflict on %s: \n%#v\ndoes not match\n%#v\n in pod", pp.GetName(), key, c, found))
+				if pp.Spec.GetConflictPolicy() == redhatcopv1alpha1.ConflictPolicyOverride {
+					mergedConstraints[i] = c
+				}
+			}
+		}
+	}
+
+	if len(mergedConstraints) == 0 {
+		return nil, utilerrors.NewAggregate(errs)
+	}
+
+	return mergedConstraints, utilerrors.NewAggregate(errs)
+}
+
+// containerKind identifies the list of the pod a container belongs to.
+type containerKind int
+
+const (
+	containerKindRegular containerKind = iota
+	containerKindInit
+	containerKindEphemeral
+)
+
+// podPresetsForContainer returns the podPresets whose container selector
+// selects the given container and whose image selector matches its image.
+func podPresetsForContainer(podPresets []*redhatcopv1alpha1.PodPreset, name, image string, kind containerKind) []*redhatcopv1alpha1.PodPreset {
+	var selected []*redhatcopv1alpha1.PodPreset
+	for _, pp := range podPresets {
+		if !selectsContainer(pp.Spec.ContainerSelector, name, kind) {
+			continue
+		}
+		// an invalid image selector has already excluded the PodPreset from
+		// the pod
+		if imageMatcher, err := NewImageMatcher(&pp.Spec); err != nil || !imageMatcher.Matches(image) {
+			continue
+		}
+		selected = append(selected, pp)
+	}
+	return selected
+}
+
+// selectsContainer returns whether the container selector selects the given
+// container. A nil selector selects every container and init container.
+func selectsContainer(selector *redhatcopv1alpha1.ContainerSelector, name string, kind containerKind) bool {
+	if selector == nil {
+		return kind != containerKindEphemeral
+	}
+
+	switch kind {
+	case containerKindInit:
+		if selector.InitContainers != nil && !*selector.InitContainers {
+			return false
+		}
+	case containerKindEphemeral:
+		if !selector.EphemeralContainers {
+			return false
+		}
+	}
+
+	if matchesAnyName(selector.Exclude, name) {
+		return false
+	}
+
+	return len(selector.Include) == 0 || matchesAnyName(selector.Include, name)
+}
+
+// matchesAnyName returns whether name matches one of the given names or glob
+// patterns.
+func matchesAnyName(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if matched, err := path.Match(pattern, name); err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
+
+// injectedContainerNames returns the names of the containers and init
+// containers injected by given podPresets.
+func injectedContainerNames(podPresets []*redhatcopv1alpha1.PodPreset) map[string]bool {
+	names := map[string]bool{}
+	for _, pp := range podPresets {
+		for _, c := range pp.Spec.Containers {
+			names[c.Name] = true
+		}
+		for _, c := range pp.Spec.InitContainers {
+			names[c.Name] = true
+		}
+	}
+	return names
+}
+
+// mergeContainers merges given list of Containers with the containers
+// injected by given podPresets, which are appended to the list. It returns an
+// error describing every conflict detected during the merge. Conflicting
+// containers are replaced when the conflict policy of the PodPreset is
+// Override.
+func mergeContainers(containers []corev1.Container, podPresets []*redhatcopv1alpha1.PodPreset) ([]corev1.Container, error) {
+	return mergeContainerList(containers, podPresets, ConflictFieldContainer, func(pp *redhatcopv1alpha1.PodPreset) ([]corev1.Container, bool) {
+		return pp.Spec.Containers, false
+	})
+}
+
+// mergeInitContainers merges given list of init Containers with the init
+// containers injected by given podPresets. Init containers of a PodPreset
+// whose InitContainersOrder is Before are placed in front of the init
+// containers of the pod, the others are appended. It returns an error
+// describing every conflict detected during the merge. Conflicting init
+// containers are replaced when the conflict policy of the PodPreset is
+// Override.
+func mergeInitContainers(initContainers []corev1.Container, podPresets []*redhatcopv1alpha1.PodPreset) ([]corev1.Container, error) {
+	return mergeContainerList(initContainers, podPresets, ConflictFieldInitContainer, func(pp *redhatcopv1alpha1.PodPreset) ([]corev1.Container, bool) {
+		return pp.Spec.InitContainers, pp.Spec.InitContainersOrder == redhatcopv1alpha1.InitContainersOrderBefore
+	})
+}
+
+// mergeContainerList merges containers with the containers returned for each
+// podPreset by injected, which also reports whether the containers go in
+// front of the existing ones.
+func mergeContainerList(containers []corev1.Container, podPresets []*redhatcopv1alpha1.PodPreset, field string, injected func(*redhatcopv1alpha1.PodPreset) ([]corev1.Container, bool)) ([]corev1.Container, error) {
+	origContainers := map[string]int{}
+	for i, c := range containers {
+		origContainers[c.Name] = i
+	}
+
+	mergedContainers := make([]corev1.Container, len(containers))
+	copy(mergedContainers, containers)
+
+	// containers placed in front of the existing ones are collected apart
+	beforeContainers := map[string]int{}
+	var before []corev1.Container
+
+	var errs []error
+
+	for _, pp := range podPresets {
+		ppContainers, inFront := injected(pp)
+		for _, c := range ppContainers {
+			list := mergedContainers
+			i, ok := origContainers[c.Name]
+			if !ok {
+				list = before
+				i, ok = beforeContainers[c.Name]
+			}
+
+			if !ok {
+				// if we don't already have it add it and continue
+				if inFront {
+					beforeContainers[c.Name] = len(before)
+					before = append(before, c)
+				} else {
+					origContainers[c.Name] = len(mergedContainers)
+					mergedContainers = append(mergedContainers, c)
+				}
+				continue
+			}
+
+			// make sure they are identical or throw an error
+			if found := list[i]; !reflect.DeepEqual(found, c) {
+				errs = append(errs, newConflict(pp, field, c.Name, "merging %ss for %s has a conflict on %s: \n%#v\ndoes not match\n%#v\n in pod", field, pp.GetName(), c.Name, c, found))
+				if pp.Spec.GetConflictPolicy() == redhatcopv1alpha1.ConflictPolicyOverride {
+					list[i] = c
+				}
+			}
+		}
+	}
+
+	mergedContainers = append(before, mergedContainers...)
+	if len(mergedContainers) == 0 {
+		return nil, utilerrors.NewAggregate(errs)
+	}
+
+	return mergedContainers, utilerrors.NewAggregate(errs)
+}
+
+// mergeResources sets the default resource requests and limits injected by
+// given podPresets on the resources of a container which leave them unset and
+// clamps the result to the bounds of the podPresets. Values set by the
+// container are never replaced by defaults. It returns an error describing
+// every conflict between the defaults of the podPresets; conflicting defaults
+// are replaced when the conflict policy of the PodPreset is Override.
+//
+// Clamping a value set by the container is not a conflict: the bounds are
+// enforced whatever the conflict policy of the PodPreset, which would
+// otherwise never be injected into the containers exceeding them.
+func mergeResources(resources corev1.ResourceRequirements, podPresets []*redhatcopv1alpha1.PodPreset) (corev1.ResourceRequirements, error) {
+	mergedResources := *resources.DeepCopy()
+
+	var errs []error
+
+	for _, pp := range podPresets {
+		if pp.Spec.Resources == nil {
+			continue
+		}
+		if err := mergeResourceList(&mergedResources.Requests, resources.Requests, pp.Spec.Resources.Requests, pp, "requests"); err != nil {
+			errs = append(errs, err)
+		}
+		if err := mergeResourceList(&mergedResources.Limits, resources.Limits, pp.Spec.Resources.Limits, pp, "limits"); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	for _, pp := range podPresets {
+		if pp.Spec.Resources == nil {
+			continue
+		}
+		clampResourceList(mergedResources.Requests, pp.Spec.Resources.Min, pp.Spec.Resources.Max)
+		clampResourceList(mergedResources.Limits, pp.Spec.Resources.Min, pp.Spec.Resources.Max)
+	}
+
+	// requests may not exceed limits, which may happen when a default request
+	// is larger than a limit set by the container.
+	for name, request := range mergedResources.Requests {
+		if limit, ok := mergedResources.Limits[name]; ok && request.Cmp(limit) > 0 {
+			mergedResources.Requests[name] = limit.DeepCopy()
+		}
+	}
+
+	return mergedResources, utilerrors.NewAggregate(errs)
+}
+
+// mergeResourceList adds the default quantities of a PodPreset to merged for
+// every resource which is not part of the container resources orig.
+func mergeResourceList(merged *corev1.ResourceList, orig, defaults corev1.ResourceList, pp *redhatcopv1alpha1.PodPreset, kind string) error {
+	var errs []error
+
+	for name, quantity := range defaults {
+		if _, ok := orig[name]; ok {
+			// the container value always wins over a default
+			continue
+		}
+
+		if *merged == nil {
+			*merged = corev1.ResourceList{}
+		}
+
+		found, ok := (*merged)[name]
+		if !ok {
+			(*merged)[name] = quantity.DeepCopy()
+			continue
+		}
+
+		// make sure they are identical or throw an error
+		if found.Cmp(quantity) != 0 {
+			key := fmt.Sprintf("%s.%s", kind, name)
+			errs = append(errs, newConflict(pp, ConflictFieldResources, key, "merging resources for %s has a conflict on %s: %s does not match %s in container", pp.GetName(), key, quantity.String(), found.String()))
+			if pp.Spec.GetConflictPolicy() == redhatcopv1alpha1.ConflictPolicyOverride {
+				(*merged)[name] = quantity.DeepCopy()
+			}
+		}
+	}
+
+	return utilerrors.NewAggregate(errs)
+}
+
+// clampResourceList raises the quantities of list below min and lowers the
+// quantities of list above max.
+func clampResourceList(list, min, max corev1.ResourceList) {
+	for name, quantity := range list {
+		if lower, ok := min[name]; ok && quantity.Cmp(lower) < 0 {
+			list[name] = lower.DeepCopy()
+		}
+		if upper, ok := max[name]; ok && quantity.Cmp(upper) > 0 {
+			list[name] = upper.DeepCopy()
+		}
+	}
+}
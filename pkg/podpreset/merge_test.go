@@ -0,0 +1,620 @@
+package podpreset
+
+import (
+	"reflect"
+	"testing"
+
+	redhatcopv1alpha1 "github.com/redhat-cop/podpreset-webhook/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestMergeResources(t *testing.T) {
+	tests := []struct {
+		name       string
+		resources  corev1.ResourceRequirements
+		podPresets []*redhatcopv1alpha1.PodPreset
+		expected   corev1.ResourceRequirements
+		conflict   bool
+	}{
+		{
+			name: "defaults added",
+			podPresets: []*redhatcopv1alpha1.PodPreset{testResourcesPodPreset("a", redhatcopv1alpha1.ResourcesPreset{
+				Requests: testResourceList("cpu", "100m"),
+				Limits:   testResourceList("memory", "256Mi"),
+			})},
+			expected: corev1.ResourceRequirements{
+				Requests: testResourceList("cpu", "100m"),
+				Limits:   testResourceList("memory", "256Mi"),
+			},
+		},
+		{
+			name:      "value of the container kept",
+			resources: corev1.ResourceRequirements{Requests: testResourceList("cpu", "250m")},
+			podPresets: []*redhatcopv1alpha1.PodPreset{testResourcesPodPreset("a", redhatcopv1alpha1.ResourcesPreset{
+				Requests: testResourceList("cpu", "100m", "memory", "128Mi"),
+			})},
+			expected: corev1.ResourceRequirements{Requests: testResourceList("cpu", "250m", "memory", "128Mi")},
+		},
+		{
+			name: "identical defaults",
+			podPresets: []*redhatcopv1alpha1.PodPreset{
+				testResourcesPodPreset("a", redhatcopv1alpha1.ResourcesPreset{Requests: testResourceList("cpu", "100m")}),
+				testResourcesPodPreset("b", redhatcopv1alpha1.ResourcesPreset{Requests: testResourceList("cpu", "0.1")}),
+			},
+			expected: corev1.ResourceRequirements{Requests: testResourceList("cpu", "100m")},
+		},
+		{
+			name: "conflicting defaults",
+			podPresets: []*redhatcopv1alpha1.PodPreset{
+				testResourcesPodPreset("a", redhatcopv1alpha1.ResourcesPreset{Requests: testResourceList("cpu", "100m")}),
+				testResourcesPodPreset("b", redhatcopv1alpha1.ResourcesPreset{Requests: testResourceList("cpu", "200m")}),
+			},
+			expected: corev1.ResourceRequirements{Requests: testResourceList("cpu", "100m")},
+			conflict: true,
+		},
+		{
+			name: "conflicting defaults overridden",
+			podPresets: []*redhatcopv1alpha1.PodPreset{
+				testResourcesPodPreset("a", redhatcopv1alpha1.ResourcesPreset{Requests: testResourceList("cpu", "100m")}),
+				withTestConflictPolicy(testResourcesPodPreset("b", redhatcopv1alpha1.ResourcesPreset{Requests: testResourceList("cpu", "200m")}), redhatcopv1alpha1.ConflictPolicyOverride),
+			},
+			expected: corev1.ResourceRequirements{Requests: testResourceList("cpu", "200m")},
+			conflict: true,
+		},
+		{
+			name:      "raised to min",
+			resources: corev1.ResourceRequirements{Requests: testResourceList("memory", "32Mi"), Limits: testResourceList("memory", "64Mi")},
+			podPresets: []*redhatcopv1alpha1.PodPreset{testResourcesPodPreset("a", redhatcopv1alpha1.ResourcesPreset{
+				Min: testResourceList("memory", "128Mi"),
+			})},
+			expected: corev1.ResourceRequirements{Requests: testResourceList("memory", "128Mi"), Limits: testResourceList("memory", "128Mi")},
+		},
+		{
+			name:      "lowered to max",
+			resources: corev1.ResourceRequirements{Requests: testResourceList("cpu", "500m"), Limits: testResourceList("cpu", "4")},
+			podPresets: []*redhatcopv1alpha1.PodPreset{testResourcesPodPreset("a", redhatcopv1alpha1.ResourcesPreset{
+				Max: testResourceList("cpu", "1"),
+			})},
+			expected: corev1.ResourceRequirements{Requests: testResourceList("cpu", "500m"), Limits: testResourceList("cpu", "1")},
+		},
+		{
+			name: "default clamped",
+			podPresets: []*redhatcopv1alpha1.PodPreset{testResourcesPodPreset("a", redhatcopv1alpha1.ResourcesPreset{
+				Requests: testResourceList("cpu", "2"),
+				Max:      testResourceList("cpu", "1"),
+			})},
+			expected: corev1.ResourceRequirements{Requests: testResourceList("cpu", "1")},
+		},
+		{
+			name: "bounds of every podpreset",
+			resources: corev1.ResourceRequirements{
+				Requests: testResourceList("cpu", "10m", "memory", "4Gi"),
+			},
+			podPresets: []*redhatcopv1alpha1.PodPreset{
+				testResourcesPodPreset("a", redhatcopv1alpha1.ResourcesPreset{Min: testResourceList("cpu", "50m")}),
+				testResourcesPodPreset("b", redhatcopv1alpha1.ResourcesPreset{Max: testResourceList("memory", "1Gi")}),
+			},
+			expected: corev1.ResourceRequirements{Requests: testResourceList("cpu", "50m", "memory", "1Gi")},
+		},
+		{
+			name:      "default request above the limit of the container",
+			resources: corev1.ResourceRequirements{Limits: testResourceList("memory", "64Mi")},
+			podPresets: []*redhatcopv1alpha1.PodPreset{testResourcesPodPreset("a", redhatcopv1alpha1.ResourcesPreset{
+				Requests: testResourceList("memory", "128Mi"),
+			})},
+			expected: corev1.ResourceRequirements{Requests: testResourceList("memory", "64Mi"), Limits: testResourceList("memory", "64Mi")},
+		},
+		{
+			name:      "request of the container above its limit",
+			resources: corev1.ResourceRequirements{Requests: testResourceList("cpu", "2"), Limits: testResourceList("cpu", "1")},
+			podPresets: []*redhatcopv1alpha1.PodPreset{testResourcesPodPreset("a", redhatcopv1alpha1.ResourcesPreset{
+				Requests: testResourceList("memory", "128Mi"),
+			})},
+			expected: corev1.ResourceRequirements{Requests: testResourceList("cpu", "1", "memory", "128Mi"), Limits: testResourceList("cpu", "1")},
+		},
+		{
+			name:       "no resources",
+			resources:  corev1.ResourceRequirements{Requests: testResourceList("cpu", "100m")},
+			podPresets: []*redhatcopv1alpha1.PodPreset{testPodPreset("a", nil)},
+			expected:   corev1.ResourceRequirements{Requests: testResourceList("cpu", "100m")},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			orig := tt.resources.DeepCopy()
+
+			merged, err := mergeResources(tt.resources, tt.podPresets)
+			if conflict := err != nil; conflict != tt.conflict {
+				t.Errorf("expected conflict %v, got %v", tt.conflict, err)
+			}
+			if !equality.Semantic.DeepEqual(merged, tt.expected) {
+				t.Errorf("expected resources %v, got %v", tt.expected, merged)
+			}
+			if !equality.Semantic.DeepEqual(tt.resources, *orig) {
+				t.Errorf("expected the resources of the container not to be modified, got %v", tt.resources)
+			}
+		})
+	}
+}
+
+func TestMergeTolerations(t *testing.T) {
+	dedicated := corev1.Toleration{Key: "dedicated", Operator: corev1.TolerationOpEqual, Value: "web", Effect: corev1.TaintEffectNoSchedule}
+	gpu := corev1.Toleration{Key: "dedicated", Operator: corev1.TolerationOpEqual, Value: "gpu", Effect: corev1.TaintEffectNoSchedule}
+	dedicatedNoExecute := corev1.Toleration{Key: "dedicated", Operator: corev1.TolerationOpEqual, Value: "gpu", Effect: corev1.TaintEffectNoExecute}
+	all := corev1.Toleration{Operator: corev1.TolerationOpExists}
+
+	tests := []struct {
+		name        string
+		tolerations []corev1.Toleration
+		podPresets  []*redhatcopv1alpha1.PodPreset
+		expected    []corev1.Toleration
+		conflicts   []string
+	}{
+		{
+			name:       "added",
+			podPresets: []*redhatcopv1alpha1.PodPreset{testSchedulingPodPreset("a", func(spec *redhatcopv1alpha1.PodPresetSpec) { spec.Tolerations = []corev1.Toleration{dedicated, all} })},
+			expected:   []corev1.Toleration{dedicated, all},
+		},
+		{
+			name:        "duplicate",
+			tolerations: []corev1.Toleration{dedicated},
+			podPresets: []*redhatcopv1alpha1.PodPreset{
+				testSchedulingPodPreset("a", func(spec *redhatcopv1alpha1.PodPresetSpec) { spec.Tolerations = []corev1.Toleration{dedicated} }),
+				testSchedulingPodPreset("b", func(spec *redhatcopv1alpha1.PodPresetSpec) { spec.Tolerations = []corev1.Toleration{dedicated} }),
+			},
+			expected: []corev1.Toleration{dedicated},
+		},
+		{
+			name:        "same key with another effect",
+			tolerations: []corev1.Toleration{dedicated},
+			podPresets: []*redhatcopv1alpha1.PodPreset{testSchedulingPodPreset("a", func(spec *redhatcopv1alpha1.PodPresetSpec) {
+				spec.Tolerations = []corev1.Toleration{dedicatedNoExecute}
+			})},
+			expected: []corev1.Toleration{dedicated, dedicatedNoExecute},
+		},
+		{
+			name:        "conflict",
+			tolerations: []corev1.Toleration{dedicated},
+			podPresets:  []*redhatcopv1alpha1.PodPreset{testSchedulingPodPreset("a", func(spec *redhatcopv1alpha1.PodPresetSpec) { spec.Tolerations = []corev1.Toleration{gpu, all} })},
+			expected:    []corev1.Toleration{dedicated, all},
+			conflicts:   []string{"dedicated:NoSchedule"},
+		},
+		{
+			name:        "conflict overridden",
+			tolerations: []corev1.Toleration{dedicated},
+			podPresets: []*redhatcopv1alpha1.PodPreset{withTestConflictPolicy(testSchedulingPodPreset("a", func(spec *redhatcopv1alpha1.PodPresetSpec) {
+				spec.Tolerations = []corev1.Toleration{gpu}
+			}), redhatcopv1alpha1.ConflictPolicyOverride)},
+			expected:  []corev1.Toleration{gpu},
+			conflicts: []string{"dedicated:NoSchedule"},
+		},
+		{
+			name: "conflict between podpresets",
+			podPresets: []*redhatcopv1alpha1.PodPreset{
+				testSchedulingPodPreset("a", func(spec *redhatcopv1alpha1.PodPresetSpec) { spec.Tolerations = []corev1.Toleration{dedicated} }),
+				testSchedulingPodPreset("b", func(spec *redhatcopv1alpha1.PodPresetSpec) { spec.Tolerations = []corev1.Toleration{gpu} }),
+			},
+			expected:  []corev1.Toleration{dedicated},
+			conflicts: []string{"dedicated:NoSchedule"},
+		},
+		{
+			name:       "no tolerations",
+			podPresets: []*redhatcopv1alpha1.PodPreset{testPodPreset("a", nil)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			orig := make([]corev1.Toleration, len(tt.tolerations))
+			copy(orig, tt.tolerations)
+
+			merged, err := mergeTolerations(tt.tolerations, tt.podPresets)
+			if keys := testConflictKeys(err); !reflect.DeepEqual(keys, tt.conflicts) {
+				t.Errorf("expected conflicts on %q, got %v", tt.conflicts, err)
+			}
+			if !equality.Semantic.DeepEqual(merged, tt.expected) {
+				t.Errorf("expected tolerations %v, got %v", tt.expected, merged)
+			}
+			if !equality.Semantic.DeepEqual(tt.tolerations, orig) {
+				t.Errorf("expected the tolerations of the pod not to be modified, got %v", tt.tolerations)
+			}
+		})
+	}
+}
+
+func TestMergeNodeSelector(t *testing.T) {
+	tests := []struct {
+		name         string
+		nodeSelector map[string]string
+		podPresets   []*redhatcopv1alpha1.PodPreset
+		expected     map[string]string
+		conflicts    []string
+	}{
+		{
+			name: "added",
+			podPresets: []*redhatcopv1alpha1.PodPreset{testSchedulingPodPreset("a", func(spec *redhatcopv1alpha1.PodPresetSpec) {
+				spec.NodeSelector = map[string]string{"disktype": "ssd"}
+			})},
+			expected: map[string]string{"disktype": "ssd"},
+		},
+		{
+			name:         "merged",
+			nodeSelector: map[string]string{"kubernetes.io/os": "linux", "disktype": "ssd"},
+			podPresets: []*redhatcopv1alpha1.PodPreset{testSchedulingPodPreset("a", func(spec *redhatcopv1alpha1.PodPresetSpec) {
+				spec.NodeSelector = map[string]string{"disktype": "ssd", "zone": "a"}
+			})},
+			expected: map[string]string{"kubernetes.io/os": "linux", "disktype": "ssd", "zone": "a"},
+		},
+		{
+			name:         "conflicting key",
+			nodeSelector: map[string]string{"disktype": "hdd"},
+			podPresets: []*redhatcopv1alpha1.PodPreset{testSchedulingPodPreset("a", func(spec *redhatcopv1alpha1.PodPresetSpec) {
+				spec.NodeSelector = map[string]string{"disktype": "ssd", "zone": "a"}
+			})},
+			expected:  map[string]string{"disktype": "hdd", "zone": "a"},
+			conflicts: []string{"disktype"},
+		},
+		{
+			name:         "conflicting key overridden",
+			nodeSelector: map[string]string{"disktype": "hdd"},
+			podPresets: []*redhatcopv1alpha1.PodPreset{withTestConflictPolicy(testSchedulingPodPreset("a", func(spec *redhatcopv1alpha1.PodPresetSpec) {
+				spec.NodeSelector = map[string]string{"disktype": "ssd"}
+			}), redhatcopv1alpha1.ConflictPolicyOverride)},
+			expected:  map[string]string{"disktype": "ssd"},
+			conflicts: []string{"disktype"},
+		},
+		{
+			name: "conflicting keys between podpresets",
+			podPresets: []*redhatcopv1alpha1.PodPreset{
+				testSchedulingPodPreset("a", func(spec *redhatcopv1alpha1.PodPresetSpec) {
+					spec.NodeSelector = map[string]string{"disktype": "ssd", "zone": "a"}
+				}),
+				testSchedulingPodPreset("b", func(spec *redhatcopv1alpha1.PodPresetSpec) {
+					spec.NodeSelector = map[string]string{"zone": "b", "disktype": "hdd"}
+				}),
+			},
+			expected:  map[string]string{"disktype": "ssd", "zone": "a"},
+			conflicts: []string{"disktype", "zone"},
+		},
+		{
+			name:         "no node selector",
+			nodeSelector: map[string]string{"disktype": "ssd"},
+			podPresets:   []*redhatcopv1alpha1.PodPreset{testPodPreset("a", nil)},
+			expected:     map[string]string{"disktype": "ssd"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var orig map[string]string
+			if tt.nodeSelector != nil {
+				orig = map[string]string{}
+				for k, v := range tt.nodeSelector {
+					orig[k] = v
+				}
+			}
+
+			merged, err := mergeNodeSelector(tt.nodeSelector, tt.podPresets)
+			if keys := testConflictKeys(err); !reflect.DeepEqual(keys, tt.conflicts) {
+				t.Errorf("expected conflicts on %q, got %v", tt.conflicts, err)
+			}
+			if !reflect.DeepEqual(merged, tt.expected) {
+				t.Errorf("expected node selector %v, got %v", tt.expected, merged)
+			}
+			if !reflect.DeepEqual(tt.nodeSelector, orig) {
+				t.Errorf("expected the node selector of the pod not to be modified, got %v", tt.nodeSelector)
+			}
+		})
+	}
+}
+
+func TestMergeAffinity(t *testing.T) {
+	nodeAffinity := func(zone string) *corev1.NodeAffinity {
+		return &corev1.NodeAffinity{RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{NodeSelectorTerms: []corev1.NodeSelectorTerm{{
+			MatchExpressions: []corev1.NodeSelectorRequirement{{Key: "topology.kubernetes.io/zone", Operator: corev1.NodeSelectorOpIn, Values: []string{zone}}},
+		}}}}
+	}
+	antiAffinity := &corev1.PodAntiAffinity{PreferredDuringSchedulingIgnoredDuringExecution: []corev1.WeightedPodAffinityTerm{{
+		Weight:          100,
+		PodAffinityTerm: corev1.PodAffinityTerm{TopologyKey: "kubernetes.io/hostname"},
+	}}}
+
+	tests := []struct {
+		name       string
+		affinity   *corev1.Affinity
+		podPresets []*redhatcopv1alpha1.PodPreset
+		expected   *corev1.Affinity
+		conflicts  []string
+	}{
+		{
+			name: "added",
+			podPresets: []*redhatcopv1alpha1.PodPreset{testSchedulingPodPreset("a", func(spec *redhatcopv1alpha1.PodPresetSpec) {
+				spec.Affinity = &corev1.Affinity{NodeAffinity: nodeAffinity("a")}
+			})},
+			expected: &corev1.Affinity{NodeAffinity: nodeAffinity("a")},
+		},
+		{
+			name:     "merged",
+			affinity: &corev1.Affinity{NodeAffinity: nodeAffinity("a")},
+			podPresets: []*redhatcopv1alpha1.PodPreset{testSchedulingPodPreset("a", func(spec *redhatcopv1alpha1.PodPresetSpec) {
+				spec.Affinity = &corev1.Affinity{NodeAffinity: nodeAffinity("a"), PodAntiAffinity: antiAffinity}
+			})},
+			expected: &corev1.Affinity{NodeAffinity: nodeAffinity("a"), PodAntiAffinity: antiAffinity},
+		},
+		{
+			name:     "conflict",
+			affinity: &corev1.Affinity{NodeAffinity: nodeAffinity("a")},
+			podPresets: []*redhatcopv1alpha1.PodPreset{testSchedulingPodPreset("a", func(spec *redhatcopv1alpha1.PodPresetSpec) {
+				spec.Affinity = &corev1.Affinity{NodeAffinity: nodeAffinity("b"), PodAntiAffinity: antiAffinity}
+			})},
+			expected:  &corev1.Affinity{NodeAffinity: nodeAffinity("a"), PodAntiAffinity: antiAffinity},
+			conflicts: []string{"nodeAffinity"},
+		},
+		{
+			name:     "conflict overridden",
+			affinity: &corev1.Affinity{NodeAffinity: nodeAffinity("a")},
+			podPresets: []*redhatcopv1alpha1.PodPreset{withTestConflictPolicy(testSchedulingPodPreset("a", func(spec *redhatcopv1alpha1.PodPresetSpec) {
+				spec.Affinity = &corev1.Affinity{NodeAffinity: nodeAffinity("b")}
+			}), redhatcopv1alpha1.ConflictPolicyOverride)},
+			expected:  &corev1.Affinity{NodeAffinity: nodeAffinity("b")},
+			conflicts: []string{"nodeAffinity"},
+		},
+		{
+			name:       "no affinity",
+			affinity:   &corev1.Affinity{NodeAffinity: nodeAffinity("a")},
+			podPresets: []*redhatcopv1alpha1.PodPreset{testPodPreset("a", nil)},
+			expected:   &corev1.Affinity{NodeAffinity: nodeAffinity("a")},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			orig := tt.affinity.DeepCopy()
+
+			merged, err := mergeAffinity(tt.affinity, tt.podPresets)
+			if keys := testConflictKeys(err); !reflect.DeepEqual(keys, tt.conflicts) {
+				t.Errorf("expected conflicts on %q, got %v", tt.conflicts, err)
+			}
+			if !equality.Semantic.DeepEqual(merged, tt.expected) {
+				t.Errorf("expected affinity %v, got %v", tt.expected, merged)
+			}
+			if !equality.Semantic.DeepEqual(tt.affinity, orig) {
+				t.Errorf("expected the affinity of the pod not to be modified, got %v", tt.affinity)
+			}
+		})
+	}
+}
+
+func TestMergeTopologySpreadConstraints(t *testing.T) {
+	zone := func(maxSkew int32) corev1.TopologySpreadConstraint {
+		return corev1.TopologySpreadConstraint{MaxSkew: maxSkew, TopologyKey: "topology.kubernetes.io/zone", WhenUnsatisfiable: corev1.DoNotSchedule}
+	}
+	hostname := corev1.TopologySpreadConstraint{MaxSkew: 1, TopologyKey: "kubernetes.io/hostname", WhenUnsatisfiable: corev1.ScheduleAnyway}
+
+	tests := []struct {
+		name        string
+		constraints []corev1.TopologySpreadConstraint
+		podPresets  []*redhatcopv1alpha1.PodPreset
+		expected    []corev1.TopologySpreadConstraint
+		conflicts   []string
+	}{
+		{
+			name:        "added",
+			constraints: []corev1.TopologySpreadConstraint{zone(1)},
+			podPresets: []*redhatcopv1alpha1.PodPreset{testSchedulingPodPreset("a", func(spec *redhatcopv1alpha1.PodPresetSpec) {
+				spec.TopologySpreadConstraints = []corev1.TopologySpreadConstraint{zone(1), hostname}
+			})},
+			expected: []corev1.TopologySpreadConstraint{zone(1), hostname},
+		},
+		{
+			name:        "conflict",
+			constraints: []corev1.TopologySpreadConstraint{zone(1)},
+			podPresets: []*redhatcopv1alpha1.PodPreset{testSchedulingPodPreset("a", func(spec *redhatcopv1alpha1.PodPresetSpec) {
+				spec.TopologySpreadConstraints = []corev1.TopologySpreadConstraint{zone(2)}
+			})},
+			expected:  []corev1.TopologySpreadConstraint{zone(1)},
+			conflicts: []string{"topology.kubernetes.io/zone:DoNotSchedule"},
+		},
+		{
+			name:        "conflict overridden",
+			constraints: []corev1.TopologySpreadConstraint{zone(1)},
+			podPresets: []*redhatcopv1alpha1.PodPreset{withTestConflictPolicy(testSchedulingPodPreset("a", func(spec *redhatcopv1alpha1.PodPresetSpec) {
+				spec.TopologySpreadConstraints = []corev1.TopologySpreadConstraint{zone(2)}
+			}), redhatcopv1alpha1.ConflictPolicyOverride)},
+			expected:  []corev1.TopologySpreadConstraint{zone(2)},
+			conflicts: []string{"topology.kubernetes.io/zone:DoNotSchedule"},
+		},
+		{
+			name:       "no constraints",
+			podPresets: []*redhatcopv1alpha1.PodPreset{testPodPreset("a", nil)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			orig := make([]corev1.TopologySpreadConstraint, len(tt.constraints))
+			copy(orig, tt.constraints)
+
+			merged, err := mergeTopologySpreadConstraints(tt.constraints, tt.podPresets)
+			if keys := testConflictKeys(err); !reflect.DeepEqual(keys, tt.conflicts) {
+				t.Errorf("expected conflicts on %q, got %v", tt.conflicts, err)
+			}
+			if !equality.Semantic.DeepEqual(merged, tt.expected) {
+				t.Errorf("expected topology spread constraints %v, got %v", tt.expected, merged)
+			}
+			if !equality.Semantic.DeepEqual(tt.constraints, orig) {
+				t.Errorf("expected the topology spread constraints of the pod not to be modified, got %v", tt.constraints)
+			}
+		})
+	}
+}
+
+func TestSelectsContainer(t *testing.T) {
+	disabled := false
+
+	tests := []struct {
+		name     string
+		selector *redhatcopv1alpha1.ContainerSelector
+		// expected lists the selected containers among web, istio-proxy,
+		// the init container setup and the ephemeral container debug
+		expected []string
+	}{
+		{
+			name:     "no selector",
+			expected: []string{"web", "istio-proxy", "setup"},
+		},
+		{
+			name:     "include only",
+			selector: &redhatcopv1alpha1.ContainerSelector{Include: []string{"web", "set*"}},
+			expected: []string{"web", "setup"},
+		},
+		{
+			name:     "exclude only",
+			selector: &redhatcopv1alpha1.ContainerSelector{Exclude: []string{"istio-*"}},
+			expected: []string{"web", "setup"},
+		},
+		{
+			name:     "include and exclude",
+			selector: &redhatcopv1alpha1.ContainerSelector{Include: []string{"*"}, Exclude: []string{"web", "setup"}},
+			expected: []string{"istio-proxy"},
+		},
+		{
+			name:     "excluded even when included",
+			selector: &redhatcopv1alpha1.ContainerSelector{Include: []string{"web"}, Exclude: []string{"web"}},
+		},
+		{
+			name:     "init containers disabled",
+			selector: &redhatcopv1alpha1.ContainerSelector{InitContainers: &disabled},
+			expected: []string{"web", "istio-proxy"},
+		},
+		{
+			name:     "ephemeral containers enabled",
+			selector: &redhatcopv1alpha1.ContainerSelector{EphemeralContainers: true},
+			expected: []string{"web", "istio-proxy", "setup", "debug"},
+		},
+		{
+			name:     "ephemeral containers enabled and excluded",
+			selector: &redhatcopv1alpha1.ContainerSelector{Exclude: []string{"debug"}, EphemeralContainers: true},
+			expected: []string{"web", "istio-proxy", "setup"},
+		},
+		{
+			name:     "ephemeral containers included but disabled",
+			selector: &redhatcopv1alpha1.ContainerSelector{Include: []string{"debug"}},
+		},
+	}
+
+	containers := []struct {
+		name string
+		kind containerKind
+	}{
+		{"web", containerKindRegular},
+		{"istio-proxy", containerKindRegular},
+		{"setup", containerKindInit},
+		{"debug", containerKindEphemeral},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var selected []string
+			for _, c := range containers {
+				if selectsContainer(tt.selector, c.name, c.kind) {
+					selected = append(selected, c.name)
+				}
+			}
+			if !reflect.DeepEqual(selected, tt.expected) {
+				t.Errorf("expected containers %q to be selected, got %q", tt.expected, selected)
+			}
+		})
+	}
+}
+
+func TestApplyContainerSelector(t *testing.T) {
+	proxy := corev1.EnvVar{Name: "HTTP_PROXY", Value: "proxy"}
+
+	tests := []struct {
+		name     string
+		selector *redhatcopv1alpha1.ContainerSelector
+		// expected lists the containers into which the env is injected
+		expected []string
+	}{
+		{
+			name:     "ephemeral containers disabled",
+			expected: []string{"web", "setup"},
+		},
+		{
+			name:     "ephemeral containers enabled",
+			selector: &redhatcopv1alpha1.ContainerSelector{EphemeralContainers: true},
+			expected: []string{"web", "setup", "debug"},
+		},
+		{
+			name:     "include and exclude",
+			selector: &redhatcopv1alpha1.ContainerSelector{Include: []string{"*"}, Exclude: []string{"setup"}, EphemeralContainers: true},
+			expected: []string{"web", "debug"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := testPod(nil)
+			pod.Spec.InitContainers = []corev1.Container{{Name: "setup", Image: "busybox"}}
+			pod.Spec.EphemeralContainers = []corev1.EphemeralContainer{{EphemeralContainerCommon: corev1.EphemeralContainerCommon{Name: "debug", Image: "busybox"}}}
+			pp := withTestSpec(testPodPreset("proxy", nil, proxy), func(spec *redhatcopv1alpha1.PodPresetSpec) {
+				spec.ContainerSelector = tt.selector
+			})
+
+			Apply(pod, []*redhatcopv1alpha1.PodPreset{pp})
+
+			var injected []string
+			for _, c := range pod.Spec.Containers {
+				if len(c.Env) > 0 {
+					injected = append(injected, c.Name)
+				}
+			}
+			for _, c := range pod.Spec.InitContainers {
+				if len(c.Env) > 0 {
+					injected = append(injected, c.Name)
+				}
+			}
+			for _, c := range pod.Spec.EphemeralContainers {
+				if len(c.Env) > 0 {
+					injected = append(injected, c.Name)
+				}
+			}
+			if !reflect.DeepEqual(injected, tt.expected) {
+				t.Errorf("expected env to be injected into %q, got %q", tt.expected, injected)
+			}
+		})
+	}
+}
+
+func testResourcesPodPreset(name string, resources redhatcopv1alpha1.ResourcesPreset) *redhatcopv1alpha1.PodPreset {
+	return withTestSpec(testPodPreset(name, nil), func(spec *redhatcopv1alpha1.PodPresetSpec) {
+		spec.Resources = &resources
+	})
+}
+
+// testResourceList builds a ResourceList from pairs of resource names and
+// quantities.
+func testResourceList(pairs ...string) corev1.ResourceList {
+	list := corev1.ResourceList{}
+	for i := 0; i+1 < len(pairs); i += 2 {
+		list[corev1.ResourceName(pairs[i])] = resource.MustParse(pairs[i+1])
+	}
+	return list
+}
+
+func testSchedulingPodPreset(name string, update func(spec *redhatcopv1alpha1.PodPresetSpec)) *redhatcopv1alpha1.PodPreset {
+	return withTestSpec(testPodPreset(name, nil), update)
+}
+
+// testConflictKeys returns the keys of the conflicts described by err.
+func testConflictKeys(err error) []string {
+	var keys []string
+	for _, c := range conflictsFromError(err) {
+		keys = append(keys, c.Key)
+	}
+	return keys
+}
@@ -0,0 +1,63 @@
+package podpreset
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// NamespaceInjectionLabel is the namespace label enabling or disabling the
+// injection of PodPresets into the pods of the namespace.
+const NamespaceInjectionLabel = annotationPrefix + "/injection"
+
+// Values of the NamespaceInjectionLabel.
+const (
+	NamespaceInjectionEnabled  = "enabled"
+	NamespaceInjectionDisabled = "disabled"
+)
+
+// NamespaceInjectionMode describes which namespaces are subject to PodPresets.
+type NamespaceInjectionMode string
+
+const (
+	// NamespaceInjectionOptOut processes every namespace which is not labeled
+	// with the NamespaceInjectionLabel set to disabled.
+	NamespaceInjectionOptOut NamespaceInjectionMode = "opt-out"
+
+	// NamespaceInjectionOptIn only processes the namespaces labeled with the
+	// NamespaceInjectionLabel set to enabled.
+	NamespaceInjectionOptIn NamespaceInjectionMode = "opt-in"
+)
+
+// ParseNamespaceInjectionMode returns the NamespaceInjectionMode with the
+// given name.
+func ParseNamespaceInjectionMode(mode string) (NamespaceInjectionMode, error) {
+	switch NamespaceInjectionMode(mode) {
+	case NamespaceInjectionOptOut, NamespaceInjectionOptIn:
+		return NamespaceInjectionMode(mode), nil
+	}
+	return "", fmt.Errorf("unknown namespace injection mode %q, expected %s or %s", mode, NamespaceInjectionOptOut, NamespaceInjectionOptIn)
+}
+
+// NamespaceSelection selects the namespaces whose pods are subject to
+// PodPresets. The zero value selects every namespace which did not opt out.
+type NamespaceSelection struct {
+	Mode NamespaceInjectionMode
+
+	// ExcludedNamespaces are never selected, whatever their labels.
+	ExcludedNamespaces []string
+}
+
+// Selects returns whether the pods of the namespace are subject to PodPresets.
+func (s NamespaceSelection) Selects(namespace *corev1.Namespace) bool {
+	for _, excluded := range s.ExcludedNamespaces {
+		if namespace.GetName() == excluded {
+			return false
+		}
+	}
+
+	if s.Mode == NamespaceInjectionOptIn {
+		return namespace.GetLabels()[NamespaceInjectionLabel] == NamespaceInjectionEnabled
+	}
+	return namespace.GetLabels()[NamespaceInjectionLabel] != NamespaceInjectionDisabled
+}
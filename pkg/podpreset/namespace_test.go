@@ -0,0 +1,118 @@
+package podpreset
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestParseNamespaceInjectionMode(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     string
+		expected NamespaceInjectionMode
+		err      bool
+	}{
+		{name: "opt-out", mode: "opt-out", expected: NamespaceInjectionOptOut},
+		{name: "opt-in", mode: "opt-in", expected: NamespaceInjectionOptIn},
+		{name: "empty", mode: "", err: true},
+		{name: "unknown", mode: "optin", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mode, err := ParseNamespaceInjectionMode(tt.mode)
+			if (err != nil) != tt.err {
+				t.Fatalf("expected error %v, got %v", tt.err, err)
+			}
+			if mode != tt.expected {
+				t.Errorf("expected mode %q, got %q", tt.expected, mode)
+			}
+		})
+	}
+}
+
+func TestNamespaceSelectionSelects(t *testing.T) {
+	excluded := []string{"kube-system", "openshift-*"}
+
+	tests := []struct {
+		name      string
+		selection NamespaceSelection
+		namespace *corev1.Namespace
+		expected  bool
+	}{
+		{
+			name:      "opt-out by default",
+			namespace: testNamespace("shop", ""),
+			expected:  true,
+		},
+		{
+			name:      "opt-out enabled",
+			selection: NamespaceSelection{Mode: NamespaceInjectionOptOut},
+			namespace: testNamespace("shop", NamespaceInjectionEnabled),
+			expected:  true,
+		},
+		{
+			name:      "opt-out disabled",
+			selection: NamespaceSelection{Mode: NamespaceInjectionOptOut},
+			namespace: testNamespace("shop", NamespaceInjectionDisabled),
+			expected:  false,
+		},
+		{
+			name:      "opt-in enabled",
+			selection: NamespaceSelection{Mode: NamespaceInjectionOptIn},
+			namespace: testNamespace("shop", NamespaceInjectionEnabled),
+			expected:  true,
+		},
+		{
+			name:      "opt-in not labeled",
+			selection: NamespaceSelection{Mode: NamespaceInjectionOptIn},
+			namespace: testNamespace("shop", ""),
+			expected:  false,
+		},
+		{
+			name:      "opt-in unknown label value",
+			selection: NamespaceSelection{Mode: NamespaceInjectionOptIn},
+			namespace: testNamespace("shop", "true"),
+			expected:  false,
+		},
+		{
+			name:      "excluded opt-out",
+			selection: NamespaceSelection{ExcludedNamespaces: excluded},
+			namespace: testNamespace("kube-system", ""),
+			expected:  false,
+		},
+		{
+			name:      "excluded opt-in enabled",
+			selection: NamespaceSelection{Mode: NamespaceInjectionOptIn, ExcludedNamespaces: excluded},
+			namespace: testNamespace("kube-system", NamespaceInjectionEnabled),
+			expected:  false,
+		},
+		{
+			// excluded namespaces are names, not glob patterns
+			name:      "excluded pattern",
+			selection: NamespaceSelection{ExcludedNamespaces: excluded},
+			namespace: testNamespace("openshift-monitoring", ""),
+			expected:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if selected := tt.selection.Selects(tt.namespace); selected != tt.expected {
+				t.Errorf("expected selected %v, got %v", tt.expected, selected)
+			}
+		})
+	}
+}
+
+// testNamespace returns a namespace labeled with the given value of the
+// NamespaceInjectionLabel, or not labeled when it is empty.
+func testNamespace(name, injection string) *corev1.Namespace {
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name}}
+	if injection != "" {
+		ns.Labels = map[string]string{NamespaceInjectionLabel: injection}
+	}
+	return ns
+}
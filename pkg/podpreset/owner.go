@@ -0,0 +1,69 @@
+package podpreset
+
+import (
+	"strings"
+
+	redhatcopv1alpha1 "github.com/redhat-cop/podpreset-webhook/api/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// OwnerKindPod is the kind of the workload of the pods without controller.
+const OwnerKindPod = "Pod"
+
+// Workload identifies the workload controlling a pod.
+type Workload struct {
+	Kind string
+	Name string
+}
+
+// PodWorkload returns the workload controlling the pod, according to its
+// controller owner reference. Pods of a ReplicaSet created by a Deployment are
+// attributed to the Deployment, which is identified without reading the
+// ReplicaSet: its name is the name of the Deployment followed by the
+// pod-template-hash label of the pod. Pods without controller are their own
+// workload.
+func PodWorkload(pod *corev1.Pod) Workload {
+	ref := metav1.GetControllerOf(pod)
+	if ref == nil {
+		return Workload{Kind: OwnerKindPod, Name: pod.GetName()}
+	}
+
+	if ref.Kind == "ReplicaSet" && ref.APIVersion == appsv1.SchemeGroupVersion.String() {
+		if hash := pod.Labels[appsv1.DefaultDeploymentUniqueLabelKey]; hash != "" && strings.HasSuffix(ref.Name, "-"+hash) {
+			return Workload{Kind: "Deployment", Name: strings.TrimSuffix(ref.Name, "-"+hash)}
+		}
+	}
+
+	return Workload{Kind: ref.Kind, Name: ref.Name}
+}
+
+// SelectsOwner returns whether the owner selector selects the workload
+// controlling the pod. A nil selector selects every pod.
+func SelectsOwner(selector *redhatcopv1alpha1.OwnerSelector, pod *corev1.Pod) bool {
+	if selector == nil {
+		return true
+	}
+
+	workload := PodWorkload(pod)
+	if matchesAnyWorkload(selector.Exclude, workload) {
+		return false
+	}
+
+	return len(selector.Include) == 0 || matchesAnyWorkload(selector.Include, workload)
+}
+
+// matchesAnyWorkload returns whether the workload matches one of the given
+// workload selectors.
+func matchesAnyWorkload(selectors []redhatcopv1alpha1.WorkloadSelector, workload Workload) bool {
+	for _, s := range selectors {
+		if s.Kind != workload.Kind {
+			continue
+		}
+		if s.Name == "" || matchesAnyName([]string{s.Name}, workload.Name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,174 @@
+package podpreset
+
+import (
+	"testing"
+
+	redhatcopv1alpha1 "github.com/redhat-cop/podpreset-webhook/api/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestPodWorkload(t *testing.T) {
+	tests := []struct {
+		name     string
+		pod      *corev1.Pod
+		workload Workload
+	}{
+		{
+			name:     "pod without controller",
+			pod:      newOwnedPod(nil),
+			workload: Workload{Kind: OwnerKindPod, Name: "web-0"},
+		},
+		{
+			name:     "pod of a deployment",
+			pod:      withTemplateHash(newOwnedPod(ownerReference("apps/v1", "ReplicaSet", "web-5d4f8c7b9")), "5d4f8c7b9"),
+			workload: Workload{Kind: "Deployment", Name: "web"},
+		},
+		{
+			name:     "pod of a replicaset",
+			pod:      newOwnedPod(ownerReference("apps/v1", "ReplicaSet", "web-5d4f8c7b9")),
+			workload: Workload{Kind: "ReplicaSet", Name: "web-5d4f8c7b9"},
+		},
+		{
+			name:     "pod of a statefulset",
+			pod:      newOwnedPod(ownerReference("apps/v1", "StatefulSet", "db")),
+			workload: Workload{Kind: "StatefulSet", Name: "db"},
+		},
+		{
+			name:     "pod of a job",
+			pod:      newOwnedPod(ownerReference("batch/v1", "Job", "nightly-27810360")),
+			workload: Workload{Kind: "Job", Name: "nightly-27810360"},
+		},
+		{
+			name:     "pod template of a cronjob",
+			pod:      newTemplatePod(&batchv1beta1.CronJob{ObjectMeta: metav1.ObjectMeta{Name: "nightly"}}),
+			workload: Workload{Kind: "Job", Name: "nightly"},
+		},
+		{
+			name:     "pod template of a deployment",
+			pod:      newTemplatePod(&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "web"}}),
+			workload: Workload{Kind: "Deployment", Name: "web"},
+		},
+		{
+			name:     "pod template of a job",
+			pod:      newTemplatePod(&batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "migrate"}}),
+			workload: Workload{Kind: "Job", Name: "migrate"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if workload := PodWorkload(tt.pod); workload != tt.workload {
+				t.Errorf("expected workload %v, got %v", tt.workload, workload)
+			}
+		})
+	}
+}
+
+func TestSelectsOwner(t *testing.T) {
+	jobPod := newOwnedPod(ownerReference("batch/v1", "Job", "nightly-27810360"))
+	cronJobTemplatePod := newTemplatePod(&batchv1beta1.CronJob{ObjectMeta: metav1.ObjectMeta{Name: "nightly"}})
+	daemonSetPod := newOwnedPod(ownerReference("apps/v1", "DaemonSet", "node-exporter"))
+
+	tests := []struct {
+		name     string
+		selector *redhatcopv1alpha1.OwnerSelector
+		pod      *corev1.Pod
+		selected bool
+	}{
+		{
+			name:     "no selector",
+			pod:      daemonSetPod,
+			selected: true,
+		},
+		{
+			name:     "included kind",
+			selector: &redhatcopv1alpha1.OwnerSelector{Include: []redhatcopv1alpha1.WorkloadSelector{{Kind: "Job"}}},
+			pod:      jobPod,
+			selected: true,
+		},
+		{
+			name:     "other kind not included",
+			selector: &redhatcopv1alpha1.OwnerSelector{Include: []redhatcopv1alpha1.WorkloadSelector{{Kind: "Job"}}},
+			pod:      daemonSetPod,
+		},
+		{
+			name:     "excluded kind",
+			selector: &redhatcopv1alpha1.OwnerSelector{Exclude: []redhatcopv1alpha1.WorkloadSelector{{Kind: "DaemonSet"}}},
+			pod:      daemonSetPod,
+		},
+		{
+			name: "exclusion over inclusion",
+			selector: &redhatcopv1alpha1.OwnerSelector{
+				Include: []redhatcopv1alpha1.WorkloadSelector{{Kind: "DaemonSet"}},
+				Exclude: []redhatcopv1alpha1.WorkloadSelector{{Kind: "DaemonSet", Name: "node-*"}},
+			},
+			pod: daemonSetPod,
+		},
+		{
+			name:     "pod without controller",
+			selector: &redhatcopv1alpha1.OwnerSelector{Include: []redhatcopv1alpha1.WorkloadSelector{{Kind: OwnerKindPod}}},
+			pod:      newOwnedPod(nil),
+			selected: true,
+		},
+		{
+			name:     "cronjob name selects the template only",
+			selector: &redhatcopv1alpha1.OwnerSelector{Include: []redhatcopv1alpha1.WorkloadSelector{{Kind: "Job", Name: "nightly"}}},
+			pod:      cronJobTemplatePod,
+			selected: true,
+		},
+		{
+			name:     "cronjob name does not select the pods of its jobs",
+			selector: &redhatcopv1alpha1.OwnerSelector{Include: []redhatcopv1alpha1.WorkloadSelector{{Kind: "Job", Name: "nightly"}}},
+			pod:      jobPod,
+		},
+		{
+			name:     "cronjob pattern selects the template",
+			selector: &redhatcopv1alpha1.OwnerSelector{Include: []redhatcopv1alpha1.WorkloadSelector{{Kind: "Job", Name: "nightly*"}}},
+			pod:      cronJobTemplatePod,
+			selected: true,
+		},
+		{
+			name:     "cronjob pattern selects the pods of its jobs",
+			selector: &redhatcopv1alpha1.OwnerSelector{Include: []redhatcopv1alpha1.WorkloadSelector{{Kind: "Job", Name: "nightly*"}}},
+			pod:      jobPod,
+			selected: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if selected := SelectsOwner(tt.selector, tt.pod); selected != tt.selected {
+				t.Errorf("expected selected to be %t", tt.selected)
+			}
+		})
+	}
+}
+
+func newOwnedPod(owner *metav1.OwnerReference) *corev1.Pod {
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "web-0", Namespace: "default"}}
+	if owner != nil {
+		pod.OwnerReferences = []metav1.OwnerReference{*owner}
+	}
+	return pod
+}
+
+func newTemplatePod(obj runtime.Object) *corev1.Pod {
+	pod := newOwnedPod(nil)
+	pod.OwnerReferences = TemplateOwners(obj)
+	return pod
+}
+
+func ownerReference(apiVersion, kind, name string) *metav1.OwnerReference {
+	controller := true
+	return &metav1.OwnerReference{APIVersion: apiVersion, Kind: kind, Name: name, Controller: &controller}
+}
+
+func withTemplateHash(pod *corev1.Pod, hash string) *corev1.Pod {
+	pod.Labels = map[string]string{appsv1.DefaultDeploymentUniqueLabelKey: hash}
+	return pod
+}
@@ -0,0 +1,322 @@
+// Package podpreset implements the selection of PodPresets and
+// ClusterPodPresets for a pod and the injection of their data into the pod.
+// It is used by the admission webhook and can be used offline.
+package podpreset
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	redhatcopv1alpha1 "github.com/redhat-cop/podpreset-webhook/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+const (
+	annotationPrefix = "podpreset.admission.kubernetes.io"
+
+	// PodPresetKind is the kind of namespaced PodPresets.
+	PodPresetKind = "PodPreset"
+
+	// ClusterPodPresetKind is the kind of ClusterPodPresets.
+	ClusterPodPresetKind = "ClusterPodPreset"
+
+	// TemplateInjectionLabel is the label opting a workload into the
+	// injection of PodPresets into its pod template.
+	TemplateInjectionLabel = annotationPrefix + "/inject-template"
+
+	// ExcludeAnnotationKey is the pod annotation listing the names of the
+	// PodPresets and ClusterPodPresets which are not applied to the pod.
+	ExcludeAnnotationKey = annotationPrefix + "/exclude-presets"
+)
+
+// Mismatch explains why a PodPreset does not select a pod.
+type Mismatch struct {
+	// Reason is one of the reasons a PodPreset is not applied, such as
+	// ReasonSelectorMismatch.
+	Reason  string
+	Message string
+}
+
+// Selects returns whether the PodPreset selects the pod, running as the given
+// ServiceAccount, or nil when it is unknown. When it does not, the Mismatch
+// explains why. An invalid selector selects nothing and returns an error.
+func Selects(pp *redhatcopv1alpha1.PodPreset, pod *corev1.Pod, serviceAccount *corev1.ServiceAccount) (bool, Mismatch, error) {
+	selector, err := NewSelector(pp)
+	if err != nil {
+		return false, Mismatch{Reason: ReasonInvalidSelector, Message: err.Error()}, err
+	}
+	selected, mismatch := selector.Selects(pod, nil, serviceAccount)
+	return selected, mismatch, nil
+}
+
+// SelectsClusterPodPreset returns whether the ClusterPodPreset selects the pod
+// of the given namespace, like Selects.
+func SelectsClusterPodPreset(cpp *redhatcopv1alpha1.ClusterPodPreset, pod *corev1.Pod, namespace *corev1.Namespace, serviceAccount *corev1.ServiceAccount) (bool, Mismatch, error) {
+	selector, err := NewClusterPodPresetSelector(cpp)
+	if err != nil {
+		return false, Mismatch{Reason: ReasonInvalidSelector, Message: err.Error()}, err
+	}
+	selected, mismatch := selector.Selects(pod, namespace, serviceAccount)
+	return selected, mismatch, nil
+}
+
+// Selector selects the pods a PodPreset or a ClusterPodPreset applies to.
+type Selector struct {
+	name string
+	spec *redhatcopv1alpha1.PodPresetSpec
+
+	// namespaceSelector is nil for namespaced PodPresets.
+	namespaceSelector      labels.Selector
+	selector               labels.Selector
+	annotationSelector     labels.Selector
+	imageMatcher           *ImageMatcher
+	serviceAccountSelector labels.Selector
+}
+
+// NewSelector returns the Selector of the PodPreset, or an error when one of
+// its selectors is invalid.
+func NewSelector(pp *redhatcopv1alpha1.PodPreset) (*Selector, error) {
+	return newSelector(pp.GetName(), &pp.Spec, nil)
+}
+
+// NewClusterPodPresetSelector returns the Selector of the ClusterPodPreset, or
+// an error when one of its selectors is invalid.
+func NewClusterPodPresetSelector(cpp *redhatcopv1alpha1.ClusterPodPreset) (*Selector, error) {
+	return newSelector(cpp.GetName(), &cpp.Spec.PodPresetSpec, &cpp.Spec.NamespaceSelector)
+}
+
+func newSelector(name string, spec *redhatcopv1alpha1.PodPresetSpec, namespaceSelector *metav1.LabelSelector) (*Selector, error) {
+	s := &Selector{name: name, spec: spec}
+
+	var err error
+	if namespaceSelector != nil {
+		if s.namespaceSelector, err = metav1.LabelSelectorAsSelector(namespaceSelector); err != nil {
+			return nil, fmt.Errorf("invalid namespaceSelector: %v", err)
+		}
+	}
+	if s.selector, err = metav1.LabelSelectorAsSelector(&spec.Selector); err != nil {
+		return nil, fmt.Errorf("invalid selector: %v", err)
+	}
+	if s.annotationSelector, err = AnnotationSelector(spec); err != nil {
+		return nil, fmt.Errorf("invalid annotationSelector: %v", err)
+	}
+	if s.imageMatcher, err = NewImageMatcher(spec); err != nil {
+		return nil, fmt.Errorf("invalid imageSelector: %v", err)
+	}
+	if s.serviceAccountSelector, err = ServiceAccountLabelSelector(spec); err != nil {
+		return nil, fmt.Errorf("invalid serviceAccountSelector: %v", err)
+	}
+	return s, nil
+}
+
+// Selects returns whether the pod of the given namespace, running as the given
+// ServiceAccount, is selected. namespace is only used by ClusterPodPresets and
+// serviceAccount is nil when it is unknown. When the pod is not selected, the
+// Mismatch explains why: the first check failing among the exclusion of the
+// PodPreset by the pod and each selector in turn.
+func (s *Selector) Selects(pod *corev1.Pod, namespace *corev1.Namespace, serviceAccount *corev1.ServiceAccount) (bool, Mismatch) {
+	if ExcludedPodPresets(pod)[s.name] {
+		return false, Mismatch{Reason: ReasonExcludedByPod, Message: fmt.Sprintf("the pod excludes it through the %s annotation", ExcludeAnnotationKey)}
+	}
+
+	// check if the namespace labels match the namespace selector
+	if !s.SelectsNamespace(namespace) {
+		return false, selectorMismatch(ReasonNamespaceSelectorMismatch, "namespaceSelector", s.namespaceSelector, "labels of the namespace")
+	}
+
+	// check if the pod labels match the selector
+	if !s.selector.Matches(labels.Set(pod.Labels)) {
+		return false, selectorMismatch(ReasonSelectorMismatch, "selector", s.selector, "labels")
+	}
+
+	// check if the pod annotations match the annotation selector
+	if !s.annotationSelector.Matches(labels.Set(pod.Annotations)) {
+		return false, selectorMismatch(ReasonAnnotationSelectorMismatch, "annotationSelector", s.annotationSelector, "annotations")
+	}
+
+	// check if the containers of the pod run an image matching the image
+	// selector
+	if !s.imageMatcher.SelectsPod(pod) {
+		return false, Mismatch{Reason: ReasonImageSelectorMismatch, Message: "the imageSelector does not match the image of any selected container"}
+	}
+
+	// check if the workload controlling the pod matches the owner selector
+	if !SelectsOwner(s.spec.OwnerSelector, pod) {
+		workload := PodWorkload(pod)
+		return false, Mismatch{Reason: ReasonOwnerSelectorMismatch, Message: fmt.Sprintf("the ownerSelector does not select the %s %s controlling the pod", workload.Kind, workload.Name)}
+	}
+
+	// check if the service account of the pod matches the service account
+	// selector
+	if !SelectsServiceAccount(s.spec, s.serviceAccountSelector, pod, serviceAccount) {
+		return false, Mismatch{Reason: ReasonServiceAccountSelectorMismatch, Message: fmt.Sprintf("the serviceAccountSelector does not select the service account %s", ServiceAccountName(pod))}
+	}
+
+	return true, Mismatch{}
+}
+
+// SelectsNamespace returns whether the namespaceSelector of a ClusterPodPreset
+// selects the namespace. It selects every namespace for PodPresets.
+func (s *Selector) SelectsNamespace(namespace *corev1.Namespace) bool {
+	return s.namespaceSelector == nil || s.namespaceSelector.Matches(labels.Set(namespace.Labels))
+}
+
+// selectorMismatch returns the Mismatch of a label selector which does not
+// match the labels or annotations of the target.
+func selectorMismatch(reason, field string, selector labels.Selector, target string) Mismatch {
+	return Mismatch{Reason: reason, Message: fmt.Sprintf("the %s %q does not match the %s", field, selector.String(), target)}
+}
+
+// AnnotationSelector returns the selector matching the annotations of the pods
+// the PodPreset applies to. Every pod is matched when the PodPreset has no
+// annotation selector.
+func AnnotationSelector(spec *redhatcopv1alpha1.PodPresetSpec) (labels.Selector, error) {
+	if spec.AnnotationSelector == nil {
+		return labels.Everything(), nil
+	}
+	return metav1.LabelSelectorAsSelector(spec.AnnotationSelector)
+}
+
+// IsOptedOut returns whether the pod opted out of every PodPreset, by setting
+// the PodPresetOptOutAnnotationKey annotation to "true".
+func IsOptedOut(pod *corev1.Pod) bool {
+	return pod.Annotations[corev1.PodPresetOptOutAnnotationKey] == "true"
+}
+
+// ExcludedPodPresets returns the names of the PodPresets and ClusterPodPresets
+// the pod excludes through the ExcludeAnnotationKey annotation, which holds a
+// comma separated list of names such as "proxy,ca-bundle".
+func ExcludedPodPresets(pod *corev1.Pod) map[string]bool {
+	value, ok := pod.Annotations[ExcludeAnnotationKey]
+	if !ok {
+		return nil
+	}
+
+	excluded := map[string]bool{}
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			excluded[name] = true
+		}
+	}
+	return excluded
+}
+
+// FromClusterPodPreset converts a ClusterPodPreset into a PodPreset
+// whose Kind identifies the ClusterPodPreset it originates from.
+func FromClusterPodPreset(cpp *redhatcopv1alpha1.ClusterPodPreset) *redhatcopv1alpha1.PodPreset {
+	return &redhatcopv1alpha1.PodPreset{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: redhatcopv1alpha1.GroupVersion.String(),
+			Kind:       ClusterPodPresetKind,
+		},
+		ObjectMeta: *cpp.ObjectMeta.DeepCopy(),
+		Spec:       *cpp.Spec.PodPresetSpec.DeepCopy(),
+		Status:     *cpp.Status.DeepCopy(),
+	}
+}
+
+// MergeClusterPodPresets combines the matching ClusterPodPresets with the
+// matching namespaced PodPresets. A namespaced PodPreset takes precedence over
+// a ClusterPodPreset of the same name, which is then dropped. The result is
+// sorted in the order the PodPresets are applied.
+func MergeClusterPodPresets(clusterPodPresets, podPresets []*redhatcopv1alpha1.PodPreset) []*redhatcopv1alpha1.PodPreset {
+	names := map[string]bool{}
+	for _, pp := range podPresets {
+		names[pp.GetName()] = true
+	}
+
+	var merged []*redhatcopv1alpha1.PodPreset
+	for _, cpp := range clusterPodPresets {
+		if !names[cpp.GetName()] {
+			merged = append(merged, cpp)
+		}
+	}
+
+	merged = append(merged, podPresets...)
+	Sort(merged)
+	return merged
+}
+
+// Sort sorts PodPresets in the order they are applied to a pod: by ascending
+// priority, then ClusterPodPresets before namespaced PodPresets so that the
+// latter are merged on top of the former, then by name. Applying PodPresets
+// in a stable order makes the injected env vars, volumes and containers of
+// repeated admissions identical.
+func Sort(podPresets []*redhatcopv1alpha1.PodPreset) {
+	sort.SliceStable(podPresets, func(i, j int) bool {
+		first, second := podPresets[i], podPresets[j]
+		if first.Spec.Priority != second.Spec.Priority {
+			return first.Spec.Priority < second.Spec.Priority
+		}
+		if IsClusterPodPreset(first) != IsClusterPodPreset(second) {
+			return IsClusterPodPreset(first)
+		}
+		return first.GetName() < second.GetName()
+	})
+}
+
+// IsClusterPodPreset returns whether the PodPreset originates from a
+// ClusterPodPreset.
+func IsClusterPodPreset(pp *redhatcopv1alpha1.PodPreset) bool {
+	return pp.Kind == ClusterPodPresetKind
+}
+
+// Kind returns the kind of the resource the PodPreset originates from.
+func Kind(pp *redhatcopv1alpha1.PodPreset) string {
+	if IsClusterPodPreset(pp) {
+		return ClusterPodPresetKind
+	}
+	return PodPresetKind
+}
+
+// AnnotationKey returns the key of the pod annotation recording the
+// resourceVersion of the applied PodPreset.
+func AnnotationKey(pp *redhatcopv1alpha1.PodPreset) string {
+	if IsClusterPodPreset(pp) {
+		return fmt.Sprintf("%s/clusterpodpreset-%s", annotationPrefix, pp.GetName())
+	}
+	return fmt.Sprintf("%s/podpreset-%s", annotationPrefix, pp.GetName())
+}
+
+// SpecResourceVersion returns the resourceVersion identifying the current spec
+// of the PodPreset, which is recorded on the pods it is injected into. As the
+// resourceVersion also changes with status updates, the one recorded in the
+// status is used once the current generation has been observed.
+func SpecResourceVersion(pp *redhatcopv1alpha1.PodPreset) string {
+	if pp.Status.SpecResourceVersion != "" && pp.Status.ObservedGeneration == pp.GetGeneration() {
+		return pp.Status.SpecResourceVersion
+	}
+	return pp.GetResourceVersion()
+}
+
+// ConflictAnnotationKey returns the key of the pod annotation recording the
+// conflict policy applied for the PodPreset.
+func ConflictAnnotationKey(pp *redhatcopv1alpha1.PodPreset) string {
+	if IsClusterPodPreset(pp) {
+		return fmt.Sprintf("%s/clusterconflict-%s", annotationPrefix, pp.GetName())
+	}
+	return fmt.Sprintf("%s/conflict-%s", annotationPrefix, pp.GetName())
+}
+
+// InjectedAnnotationKey returns the key of the pod annotation recording the
+// entries of the pod injected by the PodPreset, which are removed before a
+// new version of the PodPreset is injected.
+func InjectedAnnotationKey(pp *redhatcopv1alpha1.PodPreset) string {
+	if IsClusterPodPreset(pp) {
+		return fmt.Sprintf("%s/clusterinjected-%s", annotationPrefix, pp.GetName())
+	}
+	return fmt.Sprintf("%s/injected-%s", annotationPrefix, pp.GetName())
+}
+
+// RolloutAnnotationKey returns the key of the pod template annotation
+// recording the resourceVersion of the PodPreset which triggered the last
+// restart of a workload.
+func RolloutAnnotationKey(pp *redhatcopv1alpha1.PodPreset) string {
+	if IsClusterPodPreset(pp) {
+		return fmt.Sprintf("%s/clusterrollout-%s", annotationPrefix, pp.GetName())
+	}
+	return fmt.Sprintf("%s/rollout-%s", annotationPrefix, pp.GetName())
+}
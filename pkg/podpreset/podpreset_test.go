@@ -0,0 +1,153 @@
+package podpreset
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	redhatcopv1alpha1 "github.com/redhat-cop/podpreset-webhook/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSelectsClusterPodPreset(t *testing.T) {
+	web := map[string]string{"app": "web"}
+	invalid := metav1.LabelSelectorRequirement{Key: "app", Operator: "Unknown"}
+
+	tests := []struct {
+		name             string
+		clusterPodPreset *redhatcopv1alpha1.ClusterPodPreset
+		selected         bool
+		reason           string
+		err              string
+	}{
+		{
+			name:             "selected",
+			clusterPodPreset: testClusterPodPreset("tracing", map[string]string{"tracing": "enabled"}, web),
+			selected:         true,
+		},
+		{
+			name:             "empty selectors",
+			clusterPodPreset: testClusterPodPreset("tracing", nil, nil),
+			selected:         true,
+		},
+		{
+			name:             "selector mismatch",
+			clusterPodPreset: testClusterPodPreset("tracing", nil, map[string]string{"app": "db"}),
+			reason:           ReasonSelectorMismatch,
+		},
+		{
+			name:             "namespace selector mismatch",
+			clusterPodPreset: testClusterPodPreset("tracing", map[string]string{"tracing": "disabled"}, web),
+			reason:           ReasonNamespaceSelectorMismatch,
+		},
+		{
+			name: "invalid selector",
+			clusterPodPreset: func() *redhatcopv1alpha1.ClusterPodPreset {
+				cpp := testClusterPodPreset("tracing", nil, web)
+				cpp.Spec.Selector.MatchExpressions = []metav1.LabelSelectorRequirement{invalid}
+				return cpp
+			}(),
+			reason: ReasonInvalidSelector,
+			err:    "invalid selector",
+		},
+		{
+			name: "invalid namespace selector",
+			clusterPodPreset: func() *redhatcopv1alpha1.ClusterPodPreset {
+				cpp := testClusterPodPreset("tracing", nil, web)
+				cpp.Spec.NamespaceSelector.MatchExpressions = []metav1.LabelSelectorRequirement{invalid}
+				return cpp
+			}(),
+			reason: ReasonInvalidSelector,
+			err:    "invalid namespaceSelector",
+		},
+		{
+			name: "invalid image regexp",
+			clusterPodPreset: func() *redhatcopv1alpha1.ClusterPodPreset {
+				cpp := testClusterPodPreset("tracing", nil, web)
+				cpp.Spec.ImageSelector = &redhatcopv1alpha1.ImageSelector{Regexps: []string{"nginx:("}}
+				return cpp
+			}(),
+			reason: ReasonInvalidSelector,
+			err:    "invalid imageSelector",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default", Labels: map[string]string{"tracing": "enabled"}}}
+
+			selected, mismatch, err := SelectsClusterPodPreset(tt.clusterPodPreset, testPod(web), namespace, nil)
+
+			if selected != tt.selected {
+				t.Errorf("expected selected to be %t", tt.selected)
+			}
+			if mismatch.Reason != tt.reason {
+				t.Errorf("expected reason %q, got %q", tt.reason, mismatch.Reason)
+			}
+			if tt.err == "" && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if tt.err != "" && (err == nil || !strings.HasPrefix(err.Error(), tt.err)) {
+				t.Errorf("expected error %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestInject(t *testing.T) {
+	web := map[string]string{"app": "web"}
+	namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}}
+
+	list := redhatcopv1alpha1.PodPresetList{Items: []redhatcopv1alpha1.PodPreset{
+		*testPodPreset("tracing", web, corev1.EnvVar{Name: "TRACING", Value: "true"}),
+		*withTestSelector(testPodPreset("broken", web), metav1.LabelSelectorRequirement{Key: "app", Operator: "Unknown"}),
+		*testPodPreset("db", map[string]string{"app": "db"}),
+		*testPodPreset("proxy", web, corev1.EnvVar{Name: "HTTP_PROXY", Value: "proxy"}),
+	}}
+	list.Items[3].Spec.Priority = -10
+
+	injection, err := Inject(testPod(web), namespace, nil, list, redhatcopv1alpha1.ClusterPodPresetList{})
+
+	var names []string
+	for _, pp := range injection.Applied {
+		names = append(names, pp.GetName())
+	}
+	if expected := []string{"proxy", "tracing"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected the podpresets %v in the order they are applied, got %v", expected, names)
+	}
+	if err == nil || !strings.HasPrefix(err.Error(), "PodPreset broken skipped: invalid selector") {
+		t.Errorf("expected the invalid podpreset to be reported, got %v", err)
+	}
+	if len(injection.Warnings) != 1 || !strings.HasPrefix(injection.Warnings[0], "PodPreset broken skipped: invalid selector") {
+		t.Errorf("expected a warning about the invalid podpreset, got %q", injection.Warnings)
+	}
+	if injection.Rejection != nil || injection.Pod == nil || len(injection.Pod.Spec.Containers[0].Env) != 2 {
+		t.Errorf("expected the pod to be injected, got %v", injection.Pod)
+	}
+}
+
+func TestInjectRejected(t *testing.T) {
+	web := map[string]string{"app": "web"}
+	namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}}
+
+	list := redhatcopv1alpha1.PodPresetList{Items: []redhatcopv1alpha1.PodPreset{
+		*testPodPreset("tracing", web, corev1.EnvVar{Name: "TRACING", Value: "true"}),
+		*withTestConflictPolicy(testPodPreset("proxy", web, corev1.EnvVar{Name: "HTTP_PROXY", Value: "proxy"}), redhatcopv1alpha1.ConflictPolicyReject),
+	}}
+
+	injection, err := Inject(testPod(web, corev1.EnvVar{Name: "HTTP_PROXY", Value: "other"}), namespace, nil, list, redhatcopv1alpha1.ClusterPodPresetList{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if injection.Rejection == nil || injection.Rejection.PodPreset.GetName() != "proxy" {
+		t.Fatalf("expected the pod to be rejected by podpreset proxy, got %v", injection.Rejection)
+	}
+	if injection.Pod != nil || len(injection.Applied) != 0 {
+		t.Errorf("expected the rejected pod not to be injected, got %v applied", injection.Applied)
+	}
+	if expected := DescribeConflicts(injection.Conflicts); len(expected) == 0 || !reflect.DeepEqual(injection.Warnings, expected) {
+		t.Errorf("expected the conflicts as warnings, got %q", injection.Warnings)
+	}
+}
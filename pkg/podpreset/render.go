@@ -0,0 +1,270 @@
+package podpreset
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+
+	redhatcopv1alpha1 "github.com/redhat-cop/podpreset-webhook/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+// templateData is the data the templates of PodPresets are rendered with, such
+// as {{ .Pod.Labels.app }} or {{ .Container.Name }}.
+type templateData struct {
+	Pod       templatePod
+	Container templateContainer
+}
+
+// templatePod describes the pod a PodPreset is applied to.
+type templatePod struct {
+	Name               string
+	GenerateName       string
+	Namespace          string
+	Labels             map[string]string
+	Annotations        map[string]string
+	ServiceAccountName string
+}
+
+// templateContainer describes the container container level data is injected
+// into.
+type templateContainer struct {
+	Name  string
+	Image string
+}
+
+// renderer renders the templates found in the env values, volume paths and
+// annotation values of PodPresets. Rendered PodPresets are copies, the
+// renderer keeps track of the PodPreset each copy originates from so that
+// conflicts are attributed to the original PodPreset. A nil renderer leaves
+// PodPresets untouched.
+type renderer struct {
+	pod     templatePod
+	origins map[*redhatcopv1alpha1.PodPreset]*redhatcopv1alpha1.PodPreset
+}
+
+// newRenderer returns a renderer for the given pod. The metadata of the pod is
+// copied, templates see the pod as it was before any PodPreset was applied.
+func newRenderer(pod *corev1.Pod) *renderer {
+	return &renderer{
+		pod: templatePod{
+			Name:               pod.Name,
+			GenerateName:       pod.GenerateName,
+			Namespace:          pod.Namespace,
+			Labels:             copyStringMap(pod.Labels),
+			Annotations:        copyStringMap(pod.Annotations),
+			ServiceAccountName: pod.Spec.ServiceAccountName,
+		},
+		origins: map[*redhatcopv1alpha1.PodPreset]*redhatcopv1alpha1.PodPreset{},
+	}
+}
+
+// renderPod renders the pod level templates of podPresets: the values of
+// annotations and the paths of hostPath volumes. An entry whose template
+// cannot be rendered is not injected and reported as a conflict.
+func (r *renderer) renderPod(podPresets []*redhatcopv1alpha1.PodPreset) ([]*redhatcopv1alpha1.PodPreset, error) {
+	if r == nil {
+		return podPresets, nil
+	}
+
+	data := &templateData{Pod: r.pod}
+	return r.render(podPresets, func(pp *redhatcopv1alpha1.PodPreset, spec *redhatcopv1alpha1.PodPresetSpec) []error {
+		var errs []error
+
+		if hasTemplatedValue(spec.Annotations) {
+			annotations := make(map[string]string, len(spec.Annotations))
+			for key, value := range spec.Annotations {
+				rendered, err := renderTemplate(value, data)
+				if err != nil {
+					errs = append(errs, newTemplateConflict(pp, ConflictFieldAnnotation, key, err))
+					continue
+				}
+				annotations[key] = rendered
+			}
+			spec.Annotations = annotations
+		}
+
+		var volumes []corev1.Volume
+		for _, v := range spec.Volumes {
+			if v.HostPath != nil && isTemplate(v.HostPath.Path) {
+				rendered, err := renderTemplate(v.HostPath.Path, data)
+				if err != nil {
+					errs = append(errs, newTemplateConflict(pp, ConflictFieldVolume, v.Name, err))
+					continue
+				}
+				v.HostPath = v.HostPath.DeepCopy()
+				v.HostPath.Path = rendered
+			}
+			volumes = append(volumes, v)
+		}
+		spec.Volumes = volumes
+
+		return errs
+	})
+}
+
+// renderContainer renders the container level templates of podPresets for the
+// given container: the values of env vars and the paths of volume mounts. An
+// entry whose template cannot be rendered is not injected and reported as a
+// conflict.
+func (r *renderer) renderContainer(podPresets []*redhatcopv1alpha1.PodPreset, ctr *corev1.Container) ([]*redhatcopv1alpha1.PodPreset, error) {
+	if r == nil {
+		return podPresets, nil
+	}
+
+	data := &templateData{Pod: r.pod, Container: templateContainer{Name: ctr.Name, Image: ctr.Image}}
+	return r.render(podPresets, func(pp *redhatcopv1alpha1.PodPreset, spec *redhatcopv1alpha1.PodPresetSpec) []error {
+		var errs []error
+
+		var env []corev1.EnvVar
+		for _, e := range spec.Env {
+			if isTemplate(e.Value) {
+				rendered, err := renderTemplate(e.Value, data)
+				if err != nil {
+					errs = append(errs, newTemplateConflict(pp, ConflictFieldEnv, e.Name, err))
+					continue
+				}
+				e.Value = rendered
+			}
+			env = append(env, e)
+		}
+		spec.Env = env
+
+		var volumeMounts []corev1.VolumeMount
+		for _, m := range spec.VolumeMounts {
+			mountPath, err := renderTemplate(m.MountPath, data)
+			if err == nil {
+				m.SubPath, err = renderTemplate(m.SubPath, data)
+			}
+			if err != nil {
+				errs = append(errs, newTemplateConflict(pp, ConflictFieldVolumeMount, m.Name, err))
+				continue
+			}
+			m.MountPath = mountPath
+			volumeMounts = append(volumeMounts, m)
+		}
+		spec.VolumeMounts = volumeMounts
+
+		return errs
+	})
+}
+
+// render returns podPresets with their templates rendered by renderSpec, which
+// receives a copy of the spec of every PodPreset containing templates.
+func (r *renderer) render(podPresets []*redhatcopv1alpha1.PodPreset, renderSpec func(*redhatcopv1alpha1.PodPreset, *redhatcopv1alpha1.PodPresetSpec) []error) ([]*redhatcopv1alpha1.PodPreset, error) {
+	var errs []error
+
+	rendered := make([]*redhatcopv1alpha1.PodPreset, len(podPresets))
+	for i, pp := range podPresets {
+		rendered[i] = pp
+		if !hasTemplate(&pp.Spec) {
+			continue
+		}
+
+		origin := r.origin(pp)
+		renderedPP := pp.DeepCopy()
+		errs = append(errs, renderSpec(origin, &renderedPP.Spec)...)
+		r.origins[renderedPP] = origin
+		rendered[i] = renderedPP
+	}
+
+	return rendered, utilerrors.NewAggregate(errs)
+}
+
+// origin returns the PodPreset the given PodPreset has been rendered from.
+func (r *renderer) origin(pp *redhatcopv1alpha1.PodPreset) *redhatcopv1alpha1.PodPreset {
+	if origin, ok := r.origins[pp]; ok {
+		return origin
+	}
+	return pp
+}
+
+// restoreOrigins attributes the conflicts contained in err to the PodPresets
+// the rendered PodPresets originate from.
+func (r *renderer) restoreOrigins(err error) error {
+	if r == nil {
+		return err
+	}
+
+	for _, c := range conflictsFromError(err) {
+		c.PodPreset = r.origin(c.PodPreset)
+	}
+	return err
+}
+
+// hasTemplate returns whether the spec contains a value rendered from a
+// template.
+func hasTemplate(spec *redhatcopv1alpha1.PodPresetSpec) bool {
+	if hasTemplatedValue(spec.Annotations) {
+		return true
+	}
+	for _, v := range spec.Volumes {
+		if v.HostPath != nil && isTemplate(v.HostPath.Path) {
+			return true
+		}
+	}
+	for _, e := range spec.Env {
+		if isTemplate(e.Value) {
+			return true
+		}
+	}
+	for _, m := range spec.VolumeMounts {
+		if isTemplate(m.MountPath) || isTemplate(m.SubPath) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasTemplatedValue(m map[string]string) bool {
+	for _, value := range m {
+		if isTemplate(value) {
+			return true
+		}
+	}
+	return false
+}
+
+func isTemplate(value string) bool {
+	return strings.Contains(value, "{{")
+}
+
+// ParseTemplate parses a templated value of a PodPreset. Referencing a missing
+// key, such as a label the pod does not have, fails the rendering.
+func ParseTemplate(value string) (*template.Template, error) {
+	return template.New("").Option("missingkey=error").Parse(value)
+}
+
+// renderTemplate renders the value with the given data when it is a template.
+func renderTemplate(value string, data *templateData) (string, error) {
+	if !isTemplate(value) {
+		return value, nil
+	}
+
+	tmpl, err := ParseTemplate(value)
+	if err != nil {
+		return "", err
+	}
+
+	var rendered strings.Builder
+	if err := tmpl.Execute(&rendered, data); err != nil {
+		return "", err
+	}
+	return rendered.String(), nil
+}
+
+func newTemplateConflict(pp *redhatcopv1alpha1.PodPreset, field, key string, err error) *Conflict {
+	return newConflict(pp, ConflictFieldTemplate, fmt.Sprintf("%s %s", field, key), "rendering %s %s of %s failed: %v", field, key, pp.GetName(), err)
+}
+
+func copyStringMap(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	copied := make(map[string]string, len(m))
+	for key, value := range m {
+		copied[key] = value
+	}
+	return copied
+}
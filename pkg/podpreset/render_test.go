@@ -0,0 +1,153 @@
+package podpreset
+
+import (
+	"reflect"
+	"testing"
+
+	redhatcopv1alpha1 "github.com/redhat-cop/podpreset-webhook/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestApplyTemplates(t *testing.T) {
+	web := map[string]string{"app": "web"}
+
+	tests := []struct {
+		name string
+		spec func(spec *redhatcopv1alpha1.PodPresetSpec)
+		// conflict is the key of the template conflict expected, if any
+		conflict string
+		check    func(t *testing.T, pod *corev1.Pod)
+	}{
+		{
+			name: "env from pod and container",
+			spec: func(spec *redhatcopv1alpha1.PodPresetSpec) {
+				spec.Env = []corev1.EnvVar{
+					{Name: "SERVICE", Value: "{{ .Pod.Labels.app }}.{{ .Pod.Namespace }}"},
+					{Name: "CONTAINER", Value: "{{ .Container.Name }}@{{ .Container.Image }}"},
+					{Name: "PLAIN", Value: "plain"},
+				}
+			},
+			check: func(t *testing.T, pod *corev1.Pod) {
+				expectTestEnv(t, pod, corev1.EnvVar{Name: "SERVICE", Value: "web.default"}, corev1.EnvVar{Name: "CONTAINER", Value: "web@nginx:1.19"}, corev1.EnvVar{Name: "PLAIN", Value: "plain"})
+			},
+		},
+		{
+			name: "env with a missing label",
+			spec: func(spec *redhatcopv1alpha1.PodPresetSpec) {
+				spec.Env = []corev1.EnvVar{
+					{Name: "TEAM", Value: "{{ .Pod.Labels.team }}"},
+					{Name: "PLAIN", Value: "plain"},
+				}
+			},
+			conflict: "env TEAM",
+			check: func(t *testing.T, pod *corev1.Pod) {
+				expectTestEnv(t, pod, corev1.EnvVar{Name: "PLAIN", Value: "plain"})
+			},
+		},
+		{
+			name: "env with a malformed template",
+			spec: func(spec *redhatcopv1alpha1.PodPresetSpec) {
+				spec.Env = []corev1.EnvVar{{Name: "NAME", Value: "{{ .Pod.Name"}}
+			},
+			conflict: "env NAME",
+			check: func(t *testing.T, pod *corev1.Pod) {
+				expectTestEnv(t, pod)
+			},
+		},
+		{
+			name: "annotation from pod",
+			spec: func(spec *redhatcopv1alpha1.PodPresetSpec) {
+				spec.Annotations = map[string]string{"example.com/service": "{{ .Pod.Labels.app }}"}
+			},
+			check: func(t *testing.T, pod *corev1.Pod) {
+				if value := pod.Annotations["example.com/service"]; value != "web" {
+					t.Errorf("expected the annotation to be rendered, got %q", value)
+				}
+			},
+		},
+		{
+			name: "annotation with a missing annotation",
+			spec: func(spec *redhatcopv1alpha1.PodPresetSpec) {
+				spec.Annotations = map[string]string{"example.com/owner": "{{ .Pod.Annotations.team }}"}
+			},
+			conflict: "annotation example.com/owner",
+			check: func(t *testing.T, pod *corev1.Pod) {
+				if _, ok := pod.Annotations["example.com/owner"]; ok {
+					t.Errorf("expected the annotation not to be injected")
+				}
+			},
+		},
+		{
+			name: "volume mount and host path",
+			spec: func(spec *redhatcopv1alpha1.PodPresetSpec) {
+				spec.Volumes = []corev1.Volume{{Name: "logs", VolumeSource: corev1.VolumeSource{HostPath: &corev1.HostPathVolumeSource{Path: "/var/log/{{ .Pod.Namespace }}"}}}}
+				spec.VolumeMounts = []corev1.VolumeMount{{Name: "logs", MountPath: "/logs", SubPath: "{{ .Container.Name }}"}}
+			},
+			check: func(t *testing.T, pod *corev1.Pod) {
+				if len(pod.Spec.Volumes) != 1 || pod.Spec.Volumes[0].HostPath.Path != "/var/log/default" {
+					t.Errorf("expected the host path to be rendered, got %v", pod.Spec.Volumes)
+				}
+				mounts := pod.Spec.Containers[0].VolumeMounts
+				if len(mounts) != 1 || mounts[0].SubPath != "web" {
+					t.Errorf("expected the sub path to be rendered, got %v", mounts)
+				}
+			},
+		},
+		{
+			name: "volume mount with a missing field",
+			spec: func(spec *redhatcopv1alpha1.PodPresetSpec) {
+				spec.VolumeMounts = []corev1.VolumeMount{{Name: "logs", MountPath: "/logs/{{ .Pod.Node }}"}}
+			},
+			conflict: "volumeMount logs",
+			check: func(t *testing.T, pod *corev1.Pod) {
+				if mounts := pod.Spec.Containers[0].VolumeMounts; len(mounts) != 0 {
+					t.Errorf("expected the volume mount not to be injected, got %v", mounts)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := testPod(web)
+			pp := testPodPreset("templates", web)
+			pp.Spec.Env = nil
+			tt.spec(&pp.Spec)
+
+			applied, conflicts, rejection := ResolveConflicts(pod, []*redhatcopv1alpha1.PodPreset{pp})
+			if rejection != nil {
+				t.Fatalf("unexpected rejection: %v", rejection)
+			}
+
+			var keys []string
+			for _, c := range conflicts {
+				if c.Field != ConflictFieldTemplate || c.PodPreset != pp {
+					t.Errorf("unexpected conflict %v", c)
+				}
+				keys = append(keys, c.Key)
+			}
+			var expected []string
+			if tt.conflict != "" {
+				expected = []string{tt.conflict}
+			}
+			if !reflect.DeepEqual(keys, expected) {
+				t.Errorf("expected template conflicts %v, got %v", expected, keys)
+			}
+
+			Apply(pod, applied)
+			tt.check(t, pod)
+		})
+	}
+}
+
+func expectTestEnv(t *testing.T, pod *corev1.Pod, expected ...corev1.EnvVar) {
+	t.Helper()
+
+	env := pod.Spec.Containers[0].Env
+	if len(env) == 0 && len(expected) == 0 {
+		return
+	}
+	if !reflect.DeepEqual(env, expected) {
+		t.Errorf("expected env %v, got %v", expected, env)
+	}
+}
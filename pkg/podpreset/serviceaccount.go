@@ -0,0 +1,58 @@
+package podpreset
+
+import (
+	redhatcopv1alpha1 "github.com/redhat-cop/podpreset-webhook/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// defaultServiceAccountName is the ServiceAccount pods run as when they do not
+// set one.
+const defaultServiceAccountName = "default"
+
+// ServiceAccountName returns the name of the ServiceAccount the pod runs as.
+func ServiceAccountName(pod *corev1.Pod) string {
+	if pod.Spec.ServiceAccountName != "" {
+		return pod.Spec.ServiceAccountName
+	}
+	if pod.Spec.DeprecatedServiceAccount != "" {
+		return pod.Spec.DeprecatedServiceAccount
+	}
+	return defaultServiceAccountName
+}
+
+// ServiceAccountLabelSelector returns the selector matching the labels of the
+// ServiceAccounts the PodPreset applies to. Every ServiceAccount is matched
+// when the PodPreset does not select ServiceAccounts by labels.
+func ServiceAccountLabelSelector(spec *redhatcopv1alpha1.PodPresetSpec) (labels.Selector, error) {
+	if spec.ServiceAccountSelector == nil || spec.ServiceAccountSelector.Selector == nil {
+		return labels.Everything(), nil
+	}
+	return metav1.LabelSelectorAsSelector(spec.ServiceAccountSelector.Selector)
+}
+
+// SelectsServiceAccount returns whether the service account selector of the
+// PodPreset, whose label selector is returned by ServiceAccountLabelSelector,
+// selects the ServiceAccount the pod runs as. serviceAccount is nil when it is
+// unknown, the pod is then only selected when the PodPreset does not select
+// ServiceAccounts by labels. Every pod is selected when the PodPreset has no
+// service account selector.
+func SelectsServiceAccount(spec *redhatcopv1alpha1.PodPresetSpec, labelSelector labels.Selector, pod *corev1.Pod, serviceAccount *corev1.ServiceAccount) bool {
+	selector := spec.ServiceAccountSelector
+	if selector == nil {
+		return true
+	}
+
+	name := ServiceAccountName(pod)
+	if len(selector.Names) > 0 && !matchesAnyName(selector.Names, name) {
+		return false
+	}
+	if selector.Selector == nil {
+		return true
+	}
+
+	// labels are the only part of the selection pods cannot forge, a
+	// ServiceAccount which cannot be read is never selected
+	return serviceAccount != nil && serviceAccount.Name == name && labelSelector.Matches(labels.Set(serviceAccount.Labels))
+}
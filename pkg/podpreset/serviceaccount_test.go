@@ -0,0 +1,157 @@
+package podpreset
+
+import (
+	"testing"
+
+	redhatcopv1alpha1 "github.com/redhat-cop/podpreset-webhook/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestServiceAccountName(t *testing.T) {
+	tests := []struct {
+		name     string
+		spec     corev1.PodSpec
+		expected string
+	}{
+		{name: "service account name", spec: corev1.PodSpec{ServiceAccountName: "builder", DeprecatedServiceAccount: "deployer"}, expected: "builder"},
+		{name: "deprecated service account", spec: corev1.PodSpec{DeprecatedServiceAccount: "deployer"}, expected: "deployer"},
+		{name: "default", expected: "default"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if name := ServiceAccountName(&corev1.Pod{Spec: tt.spec}); name != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, name)
+			}
+		})
+	}
+}
+
+func TestSelectsServiceAccount(t *testing.T) {
+	trusted := &metav1.LabelSelector{MatchLabels: map[string]string{"trusted": "true"}}
+
+	tests := []struct {
+		name           string
+		selector       *redhatcopv1alpha1.ServiceAccountSelector
+		podSA          string
+		serviceAccount *corev1.ServiceAccount
+		expected       bool
+	}{
+		{
+			name:     "no selector",
+			podSA:    "builder",
+			expected: true,
+		},
+		{
+			name:     "empty selector",
+			selector: &redhatcopv1alpha1.ServiceAccountSelector{},
+			podSA:    "builder",
+			expected: true,
+		},
+		{
+			name:     "name",
+			selector: &redhatcopv1alpha1.ServiceAccountSelector{Names: []string{"builder"}},
+			podSA:    "builder",
+			expected: true,
+		},
+		{
+			name:     "name pattern",
+			selector: &redhatcopv1alpha1.ServiceAccountSelector{Names: []string{"app-*"}},
+			podSA:    "app-payments",
+			expected: true,
+		},
+		{
+			name:     "name mismatch",
+			selector: &redhatcopv1alpha1.ServiceAccountSelector{Names: []string{"app-*"}},
+			podSA:    "builder",
+			expected: false,
+		},
+		{
+			name:     "default name",
+			selector: &redhatcopv1alpha1.ServiceAccountSelector{Names: []string{"default"}},
+			expected: true,
+		},
+		{
+			name:           "labels",
+			selector:       &redhatcopv1alpha1.ServiceAccountSelector{Selector: trusted},
+			podSA:          "builder",
+			serviceAccount: testServiceAccount("builder", "true"),
+			expected:       true,
+		},
+		{
+			name:           "labels mismatch",
+			selector:       &redhatcopv1alpha1.ServiceAccountSelector{Selector: trusted},
+			podSA:          "builder",
+			serviceAccount: testServiceAccount("builder", "false"),
+			expected:       false,
+		},
+		{
+			name:     "labels of an unknown service account",
+			selector: &redhatcopv1alpha1.ServiceAccountSelector{Selector: trusted},
+			podSA:    "builder",
+			expected: false,
+		},
+		{
+			name:           "labels of another service account",
+			selector:       &redhatcopv1alpha1.ServiceAccountSelector{Selector: trusted},
+			podSA:          "builder",
+			serviceAccount: testServiceAccount("deployer", "true"),
+			expected:       false,
+		},
+		{
+			name:           "name and labels",
+			selector:       &redhatcopv1alpha1.ServiceAccountSelector{Names: []string{"app-*"}, Selector: trusted},
+			podSA:          "builder",
+			serviceAccount: testServiceAccount("builder", "true"),
+			expected:       false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := &redhatcopv1alpha1.PodPresetSpec{ServiceAccountSelector: tt.selector}
+			labelSelector, err := ServiceAccountLabelSelector(spec)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			pod := &corev1.Pod{Spec: corev1.PodSpec{ServiceAccountName: tt.podSA}}
+			if selected := SelectsServiceAccount(spec, labelSelector, pod, tt.serviceAccount); selected != tt.expected {
+				t.Errorf("expected selected %v, got %v", tt.expected, selected)
+			}
+		})
+	}
+}
+
+func TestServiceAccountLabelSelector(t *testing.T) {
+	invalid := &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "trusted", Operator: "Is"}}}
+
+	tests := []struct {
+		name     string
+		selector *redhatcopv1alpha1.ServiceAccountSelector
+		err      bool
+	}{
+		{name: "no selector"},
+		{name: "names only", selector: &redhatcopv1alpha1.ServiceAccountSelector{Names: []string{"builder"}}},
+		{name: "invalid label selector", selector: &redhatcopv1alpha1.ServiceAccountSelector{Selector: invalid}, err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ServiceAccountLabelSelector(&redhatcopv1alpha1.PodPresetSpec{ServiceAccountSelector: tt.selector})
+			if (err != nil) != tt.err {
+				t.Errorf("expected error %v, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func testServiceAccount(name, trusted string) *corev1.ServiceAccount {
+	return &corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "default",
+			Labels:    map[string]string{"trusted": trusted},
+		},
+	}
+}
@@ -0,0 +1,88 @@
+package podpreset
+
+import (
+	redhatcopv1alpha1 "github.com/redhat-cop/podpreset-webhook/api/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// PodTemplate returns the template of the pods created by a Deployment,
+// StatefulSet, DaemonSet, ReplicaSet, Job or CronJob, or nil for other
+// objects.
+func PodTemplate(obj runtime.Object) *corev1.PodTemplateSpec {
+	switch o := obj.(type) {
+	case *appsv1.Deployment:
+		return &o.Spec.Template
+	case *appsv1.StatefulSet:
+		return &o.Spec.Template
+	case *appsv1.DaemonSet:
+		return &o.Spec.Template
+	case *appsv1.ReplicaSet:
+		return &o.Spec.Template
+	case *batchv1.Job:
+		return &o.Spec.Template
+	case *batchv1beta1.CronJob:
+		return &o.Spec.JobTemplate.Spec.Template
+	}
+	return nil
+}
+
+// TemplateOwners returns the controller reference of the pods created from the
+// pod template of obj, so that owner selectors select the pod template like
+// its pods. It returns nil for other objects.
+//
+// The pods of a CronJob are controlled by its Jobs, named after the CronJob
+// followed by their scheduled time, which the pod template does not know: the
+// template is attributed to a Job named like the CronJob. A workload name
+// such as "nightly" only selects the template of the CronJob nightly, while
+// "nightly*" selects both the template and the pods of its Jobs.
+func TemplateOwners(obj runtime.Object) []metav1.OwnerReference {
+	var apiVersion, kind string
+	switch obj.(type) {
+	case *appsv1.Deployment:
+		apiVersion, kind = appsv1.SchemeGroupVersion.String(), "Deployment"
+	case *appsv1.StatefulSet:
+		apiVersion, kind = appsv1.SchemeGroupVersion.String(), "StatefulSet"
+	case *appsv1.DaemonSet:
+		apiVersion, kind = appsv1.SchemeGroupVersion.String(), "DaemonSet"
+	case *appsv1.ReplicaSet:
+		apiVersion, kind = appsv1.SchemeGroupVersion.String(), "ReplicaSet"
+	case *batchv1.Job, *batchv1beta1.CronJob:
+		apiVersion, kind = batchv1.SchemeGroupVersion.String(), "Job"
+	default:
+		return nil
+	}
+
+	controller := true
+	return []metav1.OwnerReference{{
+		APIVersion: apiVersion,
+		Kind:       kind,
+		Name:       obj.(metav1.Object).GetName(),
+		Controller: &controller,
+	}}
+}
+
+// WithoutInjected returns the PodPresets which have not been injected into the
+// pod yet, such as through the template of its workload. A PodPreset is only
+// considered injected when the pod records its current SpecResourceVersion:
+// the PodPresets injected in a previous version are injected again.
+func WithoutInjected(pod *corev1.Pod, podPresets []*redhatcopv1alpha1.PodPreset) []*redhatcopv1alpha1.PodPreset {
+	var remaining []*redhatcopv1alpha1.PodPreset
+	for _, pp := range podPresets {
+		if !IsInjected(pod, pp) {
+			remaining = append(remaining, pp)
+		}
+	}
+	return remaining
+}
+
+// IsInjected returns whether the pod records the injection of the current
+// version of the PodPreset.
+func IsInjected(pod *corev1.Pod, pp *redhatcopv1alpha1.PodPreset) bool {
+	resourceVersion, ok := pod.Annotations[AnnotationKey(pp)]
+	return ok && resourceVersion == SpecResourceVersion(pp)
+}
@@ -0,0 +1,160 @@
+package podpreset
+
+import (
+	"testing"
+
+	redhatcopv1alpha1 "github.com/redhat-cop/podpreset-webhook/api/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestPodTemplate(t *testing.T) {
+	deployment := &appsv1.Deployment{}
+	cronJob := &batchv1beta1.CronJob{}
+
+	tests := []struct {
+		name     string
+		obj      runtime.Object
+		template *corev1.PodTemplateSpec
+	}{
+		{name: "deployment", obj: deployment, template: &deployment.Spec.Template},
+		{name: "cronjob", obj: cronJob, template: &cronJob.Spec.JobTemplate.Spec.Template},
+		{name: "configmap", obj: &corev1.ConfigMap{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if template := PodTemplate(tt.obj); template != tt.template {
+				t.Errorf("expected the pod template of the %s", tt.name)
+			}
+		})
+	}
+}
+
+func TestTemplateOwners(t *testing.T) {
+	tests := []struct {
+		name  string
+		obj   runtime.Object
+		owner *metav1.OwnerReference
+	}{
+		{
+			name:  "deployment",
+			obj:   &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "web"}},
+			owner: ownerReference("apps/v1", "Deployment", "web"),
+		},
+		{
+			name:  "daemonset",
+			obj:   &appsv1.DaemonSet{ObjectMeta: metav1.ObjectMeta{Name: "node-exporter"}},
+			owner: ownerReference("apps/v1", "DaemonSet", "node-exporter"),
+		},
+		{
+			name:  "job",
+			obj:   &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "migrate"}},
+			owner: ownerReference("batch/v1", "Job", "migrate"),
+		},
+		{
+			name:  "cronjob",
+			obj:   &batchv1beta1.CronJob{ObjectMeta: metav1.ObjectMeta{Name: "nightly"}},
+			owner: ownerReference("batch/v1", "Job", "nightly"),
+		},
+		{
+			name: "pod",
+			obj:  &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "web-0"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			owners := TemplateOwners(tt.obj)
+			if tt.owner == nil {
+				if owners != nil {
+					t.Errorf("expected no owner, got %v", owners)
+				}
+				return
+			}
+			if len(owners) != 1 {
+				t.Fatalf("expected a single owner, got %v", owners)
+			}
+			owner := owners[0]
+			if owner.APIVersion != tt.owner.APIVersion || owner.Kind != tt.owner.Kind || owner.Name != tt.owner.Name || owner.Controller == nil || !*owner.Controller {
+				t.Errorf("expected controller %s %s, got %v", tt.owner.Kind, tt.owner.Name, owner)
+			}
+		})
+	}
+}
+
+func TestWithoutInjected(t *testing.T) {
+	podPreset := func(name, resourceVersion string) *redhatcopv1alpha1.PodPreset {
+		return &redhatcopv1alpha1.PodPreset{ObjectMeta: metav1.ObjectMeta{Name: name, ResourceVersion: resourceVersion}}
+	}
+	clusterPodPreset := func(name, resourceVersion string) *redhatcopv1alpha1.PodPreset {
+		pp := podPreset(name, resourceVersion)
+		pp.Kind = ClusterPodPresetKind
+		return pp
+	}
+	observed := func(pp *redhatcopv1alpha1.PodPreset, specResourceVersion string) *redhatcopv1alpha1.PodPreset {
+		pp.Generation = 2
+		pp.Status.ObservedGeneration = 2
+		pp.Status.SpecResourceVersion = specResourceVersion
+		return pp
+	}
+
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		podPreset   *redhatcopv1alpha1.PodPreset
+		injected    bool
+	}{
+		{
+			name:      "not annotated",
+			podPreset: podPreset("proxy", "10"),
+		},
+		{
+			name:        "annotated with the current resourceVersion",
+			annotations: map[string]string{annotationPrefix + "/podpreset-proxy": "10"},
+			podPreset:   podPreset("proxy", "10"),
+			injected:    true,
+		},
+		{
+			name:        "annotated with a previous resourceVersion",
+			annotations: map[string]string{annotationPrefix + "/podpreset-proxy": "9"},
+			podPreset:   podPreset("proxy", "10"),
+		},
+		{
+			name:        "annotated with the resourceVersion of the spec",
+			annotations: map[string]string{annotationPrefix + "/podpreset-proxy": "8"},
+			podPreset:   observed(podPreset("proxy", "10"), "8"),
+			injected:    true,
+		},
+		{
+			name:        "annotated with the resourceVersion of a status update",
+			annotations: map[string]string{annotationPrefix + "/podpreset-proxy": "10"},
+			podPreset:   observed(podPreset("proxy", "10"), "8"),
+		},
+		{
+			name:        "clusterpodpreset annotated",
+			annotations: map[string]string{annotationPrefix + "/clusterpodpreset-proxy": "10"},
+			podPreset:   clusterPodPreset("proxy", "10"),
+			injected:    true,
+		},
+		{
+			name:        "clusterpodpreset annotated as a podpreset",
+			annotations: map[string]string{annotationPrefix + "/podpreset-proxy": "10"},
+			podPreset:   clusterPodPreset("proxy", "10"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Annotations: tt.annotations}}
+			remaining := WithoutInjected(pod, []*redhatcopv1alpha1.PodPreset{tt.podPreset})
+			if injected := len(remaining) == 0; injected != tt.injected {
+				t.Errorf("expected injected to be %t", tt.injected)
+			}
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package podpreset
+
+import (
+	"path"
+	"time"
+
+	redhatcopv1alpha1 "github.com/redhat-cop/podpreset-webhook/api/v1alpha1"
+	apivalidation "k8s.io/apimachinery/pkg/api/validation"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	metav1validation "k8s.io/apimachinery/pkg/apis/meta/v1/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// ValidateClusterPodPresetSpec returns the errors found in the given
+// ClusterPodPresetSpec.
+func ValidateClusterPodPresetSpec(spec *redhatcopv1alpha1.ClusterPodPresetSpec, fldPath *field.Path) field.ErrorList {
+	errs := ValidatePodPresetSpec(&spec.PodPresetSpec, fldPath)
+
+	if _, err := metav1.LabelSelectorAsSelector(&spec.NamespaceSelector); err != nil {
+		errs = append(errs, field.Invalid(fldPath.Child("namespaceSelector"), spec.NamespaceSelector, err.Error()))
+	}
+
+	return errs
+}
+
+// ValidatePodPresetSpec returns the errors found in the given PodPresetSpec.
+func ValidatePodPresetSpec(spec *redhatcopv1alpha1.PodPresetSpec, fldPath *field.Path) field.ErrorList {
+	var errs field.ErrorList
+
+	if _, err := metav1.LabelSelectorAsSelector(&spec.Selector); err != nil {
+		errs = append(errs, field.Invalid(fldPath.Child("selector"), spec.Selector, err.Error()))
+	}
+
+	if _, err := AnnotationSelector(spec); err != nil {
+		errs = append(errs, field.Invalid(fldPath.Child("annotationSelector"), spec.AnnotationSelector, err.Error()))
+	}
+
+	envNames := map[string]bool{}
+	for i, env := range spec.Env {
+		if envNames[env.Name] {
+			errs = append(errs, field.Duplicate(fldPath.Child("env").Index(i).Child("name"), env.Name))
+		}
+		envNames[env.Name] = true
+		errs = append(errs, validateTemplate(env.Value, fldPath.Child("env").Index(i).Child("value"))...)
+	}
+
+	volumeNames := map[string]bool{}
+	for i, volume := range spec.Volumes {
+		volumeNames[volume.Name] = true
+		if volume.HostPath != nil {
+			errs = append(errs, validateTemplate(volume.HostPath.Path, fldPath.Child("volumes").Index(i).Child("hostPath", "path"))...)
+		}
+	}
+	for i, volumeMount := range spec.VolumeMounts {
+		if !volumeNames[volumeMount.Name] {
+			errs = append(errs, field.NotFound(fldPath.Child("volumeMounts").Index(i).Child("name"), volumeMount.Name))
+		}
+		errs = append(errs, validateTemplate(volumeMount.MountPath, fldPath.Child("volumeMounts").Index(i).Child("mountPath"))...)
+		errs = append(errs, validateTemplate(volumeMount.SubPath, fldPath.Child("volumeMounts").Index(i).Child("subPath"))...)
+	}
+
+	errs = append(errs, metav1validation.ValidateLabels(spec.Labels, fldPath.Child("labels"))...)
+	errs = append(errs, apivalidation.ValidateAnnotations(spec.Annotations, fldPath.Child("annotations"))...)
+	for key, value := range spec.Annotations {
+		errs = append(errs, validateTemplate(value, fldPath.Child("annotations").Key(key))...)
+	}
+
+	if spec.ContainerSelector != nil {
+		errs = append(errs, validatePatterns(spec.ContainerSelector.Include, fldPath.Child("containerSelector", "include"))...)
+		errs = append(errs, validatePatterns(spec.ContainerSelector.Exclude, fldPath.Child("containerSelector", "exclude"))...)
+	}
+
+	if spec.ImageSelector != nil {
+		errs = append(errs, validatePatterns(spec.ImageSelector.Patterns, fldPath.Child("imageSelector", "patterns"))...)
+		for i, expr := range spec.ImageSelector.Regexps {
+			if _, err := CompileImageRegexp(expr); err != nil {
+				errs = append(errs, field.Invalid(fldPath.Child("imageSelector", "regexps").Index(i), expr, err.Error()))
+			}
+		}
+	}
+
+	if spec.OwnerSelector != nil {
+		errs = append(errs, validateWorkloadSelectors(spec.OwnerSelector.Include, fldPath.Child("ownerSelector", "include"))...)
+		errs = append(errs, validateWorkloadSelectors(spec.OwnerSelector.Exclude, fldPath.Child("ownerSelector", "exclude"))...)
+	}
+
+	if spec.ServiceAccountSelector != nil {
+		errs = append(errs, validatePatterns(spec.ServiceAccountSelector.Names, fldPath.Child("serviceAccountSelector", "names"))...)
+		if _, err := ServiceAccountLabelSelector(spec); err != nil {
+			errs = append(errs, field.Invalid(fldPath.Child("serviceAccountSelector", "selector"), spec.ServiceAccountSelector.Selector, err.Error()))
+		}
+	}
+
+	if spec.RolloutPolicy != nil {
+		errs = append(errs, validateRolloutPolicy(spec.RolloutPolicy, fldPath.Child("rolloutPolicy"))...)
+	}
+
+	return errs
+}
+
+// validateRolloutPolicy returns the errors found in the given RolloutPolicy.
+func validateRolloutPolicy(policy *redhatcopv1alpha1.RolloutPolicy, fldPath *field.Path) field.ErrorList {
+	var errs field.ErrorList
+
+	if policy.MinInterval != nil && policy.MinInterval.Duration < 0 {
+		errs = append(errs, field.Invalid(fldPath.Child("minInterval"), policy.MinInterval.Duration.String(), "must not be negative"))
+	}
+
+	if window := policy.MaintenanceWindow; window != nil {
+		if _, err := time.Parse(redhatcopv1alpha1.MaintenanceWindowLayout, window.Start); err != nil {
+			errs = append(errs, field.Invalid(fldPath.Child("maintenanceWindow", "start"), window.Start, "must be formatted as HH:MM"))
+		}
+		if window.Duration.Duration <= 0 || window.Duration.Duration > 24*time.Hour {
+			errs = append(errs, field.Invalid(fldPath.Child("maintenanceWindow", "duration"), window.Duration.Duration.String(), "must be greater than 0 and at most 24h"))
+		}
+	}
+
+	return errs
+}
+
+// validateTemplate returns an error when a templated value is malformed.
+func validateTemplate(value string, fldPath *field.Path) field.ErrorList {
+	if _, err := ParseTemplate(value); err != nil {
+		return field.ErrorList{field.Invalid(fldPath, value, err.Error())}
+	}
+	return nil
+}
+
+// validatePatterns returns an error for each malformed glob pattern.
+func validatePatterns(patterns []string, fldPath *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	for i, pattern := range patterns {
+		if err := validatePattern(pattern); err != nil {
+			errs = append(errs, field.Invalid(fldPath.Index(i), pattern, err.Error()))
+		}
+	}
+	return errs
+}
+
+// validateWorkloadSelectors returns an error for every workload selector
+// without kind or whose name is a malformed glob pattern.
+func validateWorkloadSelectors(selectors []redhatcopv1alpha1.WorkloadSelector, fldPath *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	for i, selector := range selectors {
+		if selector.Kind == "" {
+			errs = append(errs, field.Required(fldPath.Index(i).Child("kind"), ""))
+		}
+		if err := validatePattern(selector.Name); err != nil {
+			errs = append(errs, field.Invalid(fldPath.Index(i).Child("name"), selector.Name, err.Error()))
+		}
+	}
+	return errs
+}
+
+// validatePattern returns an error when the glob pattern is malformed. The
+// pattern is matched against itself rather than an empty name, as path.Match
+// only reports the errors of the part of the pattern it scans before Go 1.16.
+func validatePattern(pattern string) error {
+	_, err := path.Match(pattern, pattern)
+	return err
+}
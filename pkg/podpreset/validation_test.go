@@ -0,0 +1,189 @@
+package podpreset
+
+import (
+	"testing"
+	"time"
+
+	redhatcopv1alpha1 "github.com/redhat-cop/podpreset-webhook/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+func TestValidatePodPresetSpec(t *testing.T) {
+	tests := []struct {
+		name   string
+		spec   redhatcopv1alpha1.PodPresetSpec
+		fields []string
+	}{
+		{
+			name: "valid labels and annotations",
+			spec: redhatcopv1alpha1.PodPresetSpec{
+				Labels:      map[string]string{"example.com/team": "payments"},
+				Annotations: map[string]string{"example.com/owner": "{{ .Pod.Name }}"},
+			},
+		},
+		{
+			name:   "invalid label key",
+			spec:   redhatcopv1alpha1.PodPresetSpec{Labels: map[string]string{"-team": "payments"}},
+			fields: []string{"spec.labels"},
+		},
+		{
+			name:   "invalid label value",
+			spec:   redhatcopv1alpha1.PodPresetSpec{Labels: map[string]string{"team": "payments and billing"}},
+			fields: []string{"spec.labels"},
+		},
+		{
+			name:   "invalid annotation key",
+			spec:   redhatcopv1alpha1.PodPresetSpec{Annotations: map[string]string{"example.com/owner/name": "payments"}},
+			fields: []string{"spec.annotations"},
+		},
+		{
+			name:   "malformed annotation template",
+			spec:   redhatcopv1alpha1.PodPresetSpec{Annotations: map[string]string{"example.com/owner": "{{ .Pod.Name"}},
+			fields: []string{"spec.annotations[example.com/owner]"},
+		},
+		{
+			name:   "invalid selector",
+			spec:   redhatcopv1alpha1.PodPresetSpec{Selector: metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "app", Operator: "Unknown"}}}},
+			fields: []string{"spec.selector"},
+		},
+		{
+			name:   "invalid annotation selector",
+			spec:   redhatcopv1alpha1.PodPresetSpec{AnnotationSelector: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "team", Operator: metav1.LabelSelectorOpIn}}}},
+			fields: []string{"spec.annotationSelector"},
+		},
+		{
+			name: "duplicate env",
+			spec: redhatcopv1alpha1.PodPresetSpec{Env: []corev1.EnvVar{
+				{Name: "HTTP_PROXY", Value: "proxy"},
+				{Name: "NO_PROXY", Value: "localhost"},
+				{Name: "HTTP_PROXY", Value: "other"},
+			}},
+			fields: []string{"spec.env[2].name"},
+		},
+		{
+			name:   "malformed env template",
+			spec:   redhatcopv1alpha1.PodPresetSpec{Env: []corev1.EnvVar{{Name: "POD_NAME", Value: "{{ .Pod.Name"}}},
+			fields: []string{"spec.env[0].value"},
+		},
+		{
+			name: "volume mount without volume",
+			spec: redhatcopv1alpha1.PodPresetSpec{
+				Volumes:      []corev1.Volume{{Name: "cache", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}}},
+				VolumeMounts: []corev1.VolumeMount{{Name: "cache", MountPath: "/cache"}, {Name: "certs", MountPath: "/certs"}},
+			},
+			fields: []string{"spec.volumeMounts[1].name"},
+		},
+		{
+			name: "malformed volume templates",
+			spec: redhatcopv1alpha1.PodPresetSpec{
+				Volumes:      []corev1.Volume{{Name: "logs", VolumeSource: corev1.VolumeSource{HostPath: &corev1.HostPathVolumeSource{Path: "/var/log/{{ .Pod.Name"}}}},
+				VolumeMounts: []corev1.VolumeMount{{Name: "logs", MountPath: "/logs/{{ .Pod.Name", SubPath: "{{ .Pod.Name"}},
+			},
+			fields: []string{"spec.volumes[0].hostPath.path", "spec.volumeMounts[0].mountPath", "spec.volumeMounts[0].subPath"},
+		},
+		{
+			name: "malformed container patterns",
+			spec: redhatcopv1alpha1.PodPresetSpec{ContainerSelector: &redhatcopv1alpha1.ContainerSelector{
+				Include: []string{"app-*", "app-["},
+				Exclude: []string{"["},
+			}},
+			fields: []string{"spec.containerSelector.include[1]", "spec.containerSelector.exclude[0]"},
+		},
+		{
+			name: "malformed image selector",
+			spec: redhatcopv1alpha1.PodPresetSpec{ImageSelector: &redhatcopv1alpha1.ImageSelector{
+				Patterns: []string{"nginx:["},
+				Regexps:  []string{"nginx:1\\.(19|20", "nginx:.*"},
+			}},
+			fields: []string{"spec.imageSelector.patterns[0]", "spec.imageSelector.regexps[0]"},
+		},
+		{
+			name: "invalid owner selector",
+			spec: redhatcopv1alpha1.PodPresetSpec{OwnerSelector: &redhatcopv1alpha1.OwnerSelector{
+				Include: []redhatcopv1alpha1.WorkloadSelector{{Name: "web"}},
+				Exclude: []redhatcopv1alpha1.WorkloadSelector{{Kind: "Deployment", Name: "web-["}},
+			}},
+			fields: []string{"spec.ownerSelector.include[0].kind", "spec.ownerSelector.exclude[0].name"},
+		},
+		{
+			name: "invalid service account selector",
+			spec: redhatcopv1alpha1.PodPresetSpec{ServiceAccountSelector: &redhatcopv1alpha1.ServiceAccountSelector{
+				Names:    []string{"builder-["},
+				Selector: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "trusted", Operator: "Unknown"}}},
+			}},
+			fields: []string{"spec.serviceAccountSelector.names[0]", "spec.serviceAccountSelector.selector"},
+		},
+		{
+			name: "invalid rollout policy",
+			spec: redhatcopv1alpha1.PodPresetSpec{RolloutPolicy: &redhatcopv1alpha1.RolloutPolicy{
+				Type:              redhatcopv1alpha1.RolloutPolicyRestart,
+				MinInterval:       &metav1.Duration{Duration: -time.Minute},
+				MaintenanceWindow: &redhatcopv1alpha1.MaintenanceWindow{Start: "10pm", Duration: metav1.Duration{Duration: 25 * time.Hour}},
+			}},
+			fields: []string{"spec.rolloutPolicy.minInterval", "spec.rolloutPolicy.maintenanceWindow.start", "spec.rolloutPolicy.maintenanceWindow.duration"},
+		},
+		{
+			name: "empty maintenance window",
+			spec: redhatcopv1alpha1.PodPresetSpec{RolloutPolicy: &redhatcopv1alpha1.RolloutPolicy{
+				Type:              redhatcopv1alpha1.RolloutPolicyRestart,
+				MaintenanceWindow: &redhatcopv1alpha1.MaintenanceWindow{Start: "22:00"},
+			}},
+			fields: []string{"spec.rolloutPolicy.maintenanceWindow.duration"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := ValidatePodPresetSpec(&tt.spec, field.NewPath("spec"))
+			if len(errs) != len(tt.fields) {
+				t.Fatalf("expected %d errors, got %v", len(tt.fields), errs)
+			}
+			for i, err := range errs {
+				if err.Field != tt.fields[i] {
+					t.Errorf("expected an error on %s, got %v", tt.fields[i], err)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateClusterPodPresetSpec(t *testing.T) {
+	tests := []struct {
+		name   string
+		spec   redhatcopv1alpha1.ClusterPodPresetSpec
+		fields []string
+	}{
+		{
+			name: "valid namespace selector",
+			spec: redhatcopv1alpha1.ClusterPodPresetSpec{NamespaceSelector: metav1.LabelSelector{MatchLabels: map[string]string{"team": "payments"}}},
+		},
+		{
+			name:   "invalid namespace selector",
+			spec:   redhatcopv1alpha1.ClusterPodPresetSpec{NamespaceSelector: metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "team", Operator: "Unknown"}}}},
+			fields: []string{"spec.namespaceSelector"},
+		},
+		{
+			name: "invalid podpreset spec",
+			spec: redhatcopv1alpha1.ClusterPodPresetSpec{PodPresetSpec: redhatcopv1alpha1.PodPresetSpec{
+				VolumeMounts: []corev1.VolumeMount{{Name: "certs", MountPath: "/certs"}},
+			}},
+			fields: []string{"spec.volumeMounts[0].name"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := ValidateClusterPodPresetSpec(&tt.spec, field.NewPath("spec"))
+			if len(errs) != len(tt.fields) {
+				t.Fatalf("expected %d errors, got %v", len(tt.fields), errs)
+			}
+			for i, err := range errs {
+				if err.Field != tt.fields[i] {
+					t.Errorf("expected an error on %s, got %v", tt.fields[i], err)
+				}
+			}
+		})
+	}
+}